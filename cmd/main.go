@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"hw1/internal/pkg/memcache"
 	"hw1/internal/pkg/parseduration"
+	"hw1/internal/pkg/resp"
 	"hw1/internal/pkg/server"
 	"hw1/internal/pkg/storage"
 	"log"
@@ -16,13 +18,36 @@ import (
 
 func main() {
 	SD, CD, filename, port := parseduration.ParseDuration()
-	store, err := storage.NewStorage(time.Second*time.Duration(SD), time.Second*time.Duration(CD), filename)
+
+	persister, err := newPersister(filename)
+	if err != nil {
+		log.Fatalf("Failed to create persister: %v", err)
+	}
+
+	store, err := storage.NewStorageWithPersister(time.Second*time.Duration(SD), time.Second*time.Duration(CD), persister)
 	if err != nil {
 		log.Fatalf("Failed to create storage: %v", err)
 	}
 
-	if err := store.LoadFromPostgres(); err != nil {
-		log.Fatalf("Ошибка загрузки состояния из базы данных: %v", err)
+	if err := store.SetMaxDatabases(parseduration.ParseDatabases()); err != nil {
+		log.Fatalf("Incorrect databases limit: %v", err)
+	}
+
+	if err := store.Load(); err != nil {
+		log.Fatalf("Ошибка загрузки состояния: %v", err)
+	}
+
+	// the log is replayed over the loaded state before the server starts
+	if aofFilename, fsync := parseduration.ParseAOF(); aofFilename != "" {
+		if err := store.EnableAOF(aofFilename, storage.FsyncPolicy(fsync)); err != nil {
+			log.Fatalf("Failed to enable append-only file: %v", err)
+		}
+	}
+
+	// the limit is applied after the load, so the replay neither evicts nor fails with out of memory
+	maxMemory, policy := parseduration.ParseMemory()
+	if err := store.SetMaxMemory(maxMemory, storage.EvictionPolicy(policy)); err != nil {
+		log.Fatalf("Incorrect memory limit: %v", err)
 	}
 
 	fmt.Println("Storage created successfully")
@@ -40,6 +65,31 @@ func main() {
 		os.Exit(0)
 	}()
 
+	respPort := parseduration.ParseRESP()
+	fmt.Println("Starting RESP server on " + respPort)
+	go resp.New(respPort, store).Start()
+
+	if memcachedPort := parseduration.ParseMemcached(); memcachedPort != "" {
+		fmt.Println("Starting memcached server on " + memcachedPort)
+		go memcache.New(memcachedPort, store).Start()
+	}
+
 	fmt.Println("Starting server on " + port)
 	s.Start()
 }
+
+// newPersister creates the snapshot persister chosen by the PERSISTENCE variable.
+func newPersister(filename string) (storage.Persister, error) {
+	persistence, dsn := parseduration.ParsePersistence()
+
+	switch persistence {
+	case "file":
+		return storage.NewFilePersister(filename), nil
+	case "postgres":
+		return storage.NewPostgresPersister(dsn)
+	case "memory":
+		return storage.NewMemoryPersister(), nil
+	default:
+		return nil, fmt.Errorf("unknown persistence %q", persistence)
+	}
+}
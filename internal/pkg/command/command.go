@@ -0,0 +1,149 @@
+// Package command is the table of the storage commands shared by the front-ends:
+// the HTTP routes, the generic POST /cmd endpoint and the redis protocol.
+// A front-end only converts its request to the arguments of a command and renders the reply.
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hw1/internal/pkg/storage"
+	"sort"
+	"strings"
+)
+
+// Flags describe what a command does with its keys.
+type Flags int
+
+const (
+	Read  Flags = 1 << iota // reads the keys
+	Write                   // changes the keys
+)
+
+// Handler runs the command, args[0] is the name of the command in lower case.
+// The reply is one of nil, Status, string, int64, []string, map[string]string or []any of them.
+type Handler func(st *storage.Storage, args []string) (any, error)
+
+// BlockingHandler runs a command which can wait, like BLPOP, it stops waiting when ctx is done.
+type BlockingHandler func(ctx context.Context, st *storage.Storage, args []string) (any, error)
+
+type Command struct {
+	Name string
+	// Arity is the number of arguments including the name,
+	// a negative one is the minimal number, like in redis
+	Arity int
+	Flags Flags
+	// FirstKey, LastKey and KeyStep are the positions of the keys in the arguments,
+	// a negative LastKey counts from the end, FirstKey 0 means that there are no keys
+	FirstKey int
+	LastKey  int
+	KeyStep  int
+	Handler  Handler
+	// Blocking is run instead of Handler if it is set
+	Blocking BlockingHandler
+}
+
+// Status is a short reply like OK, it is a simple string in RESP.
+type Status string
+
+const OK = Status("OK")
+
+var (
+	ErrUnknownCommand = errors.New("unknown command")
+	ErrWrongArity     = errors.New("wrong number of arguments")
+	ErrSyntax         = errors.New("syntax error")
+	ErrNotPositive    = errors.New("value is out of range, must be positive")
+	ErrInvalidExpire  = errors.New("invalid expire time")
+	ErrInvalidCursor  = errors.New("invalid cursor")
+
+	// ErrNotInteger and ErrNotFloat wrap the storage errors when an argument is not a number,
+	// not the stored value
+	ErrNotInteger = fmt.Errorf("%w", storage.ErrNotInteger)
+	ErrNotFloat   = fmt.Errorf("%w", storage.ErrNotFloat)
+)
+
+var commands = make(map[string]*Command)
+
+func register(cmds ...*Command) {
+	for _, cmd := range cmds {
+		commands[cmd.Name] = cmd
+	}
+}
+
+// Lookup finds the command by its name in any case.
+func Lookup(name string) (*Command, bool) {
+	cmd, ok := commands[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// All returns the commands sorted by name.
+func All() []*Command {
+	all := make([]*Command, 0, len(commands))
+	for _, cmd := range commands {
+		all = append(all, cmd)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Name < all[j].Name
+	})
+	return all
+}
+
+// Keys returns the keys among the arguments of the command.
+func (c *Command) Keys(args []string) []string {
+	if c.FirstKey == 0 || c.FirstKey >= len(args) {
+		return nil
+	}
+	last := c.LastKey
+	if last < 0 {
+		last += len(args)
+	}
+
+	keys := make([]string, 0, (last-c.FirstKey)/c.KeyStep+1)
+	for i := c.FirstKey; i <= last && i < len(args); i += c.KeyStep {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+func (c *Command) IsWrite() bool {
+	return c.Flags&Write != 0
+}
+
+// Execute checks the arguments and runs the command, args[0] is its name.
+func Execute(st *storage.Storage, args []string) (any, error) {
+	return ExecuteContext(context.Background(), st, args)
+}
+
+// ExecuteContext works like Execute, the blocking commands wait until ctx is done at most.
+func ExecuteContext(ctx context.Context, st *storage.Storage, args []string) (any, error) {
+	cmd, err := check(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// the handlers compare names in lower case
+	args = append([]string{cmd.Name}, args[1:]...)
+	if cmd.Blocking != nil {
+		return cmd.Blocking(ctx, st, args)
+	}
+	return cmd.Handler(st, args)
+}
+
+// check finds the command and checks the number of its arguments.
+func check(args []string) (*Command, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%w ''", ErrUnknownCommand)
+	}
+	cmd, ok := Lookup(args[0])
+	if !ok {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownCommand, args[0])
+	}
+	if (cmd.Arity > 0 && len(args) != cmd.Arity) || (cmd.Arity < 0 && len(args) < -cmd.Arity) {
+		return nil, arityError(cmd.Name)
+	}
+	return cmd, nil
+}
+
+func arityError(name string) error {
+	return fmt.Errorf("%w for '%s' command", ErrWrongArity, name)
+}
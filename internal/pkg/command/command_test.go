@@ -0,0 +1,370 @@
+package command
+
+import (
+	"context"
+	"hw1/internal/pkg/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStorage(t *testing.T) *storage.Storage {
+	st, err := storage.NewStorageWithPersister(time.Minute*20, time.Minute*60, storage.NewMemoryPersister())
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	return st
+}
+
+func TestExecuteErrors(t *testing.T) {
+	st := newTestStorage(t)
+
+	_, err := Execute(st, []string{"NOSUCH", "k"})
+	assert.ErrorIs(t, err, ErrUnknownCommand)
+	assert.EqualError(t, err, "unknown command 'NOSUCH'")
+
+	_, err = Execute(st, []string{"GET"})
+	assert.ErrorIs(t, err, ErrWrongArity)
+	assert.EqualError(t, err, "wrong number of arguments for 'get' command")
+
+	_, err = Execute(st, []string{"rpush", "k"})
+	assert.ErrorIs(t, err, ErrWrongArity)
+
+	_, err = Execute(st, []string{"lset", "k", "x", "1"})
+	assert.ErrorIs(t, err, ErrNotInteger)
+	assert.ErrorIs(t, err, storage.ErrNotInteger)
+
+	_, err = Execute(st, []string{"set", "k", "v", "EX", "0"})
+	assert.ErrorIs(t, err, ErrInvalidExpire)
+
+	// the times which overflow are rejected instead of deleting the key
+	for _, ex := range []string{"9223372036854776", "9223372036854775"} {
+		_, err = Execute(st, []string{"set", "k", "v", "EX", ex})
+		assert.ErrorIs(t, err, ErrInvalidExpire)
+	}
+	assert.NoError(t, st.Set("k", "v"))
+	for _, args := range [][]string{
+		{"expire", "k", "9223372036854775"},
+		{"expire", "k", "-9223372036854776"},
+		{"pexpire", "k", "9223372036854775807"},
+	} {
+		_, err = Execute(st, args)
+		assert.ErrorIs(t, err, ErrInvalidExpire)
+	}
+	assert.Equal(t, int64(-1), st.TTL("k"))
+}
+
+func TestExecute(t *testing.T) {
+	st := newTestStorage(t)
+
+	reply, err := Execute(st, []string{"Set", "k", "v"})
+	assert.NoError(t, err)
+	assert.Equal(t, OK, reply)
+
+	reply, err = Execute(st, []string{"get", "k"})
+	assert.NoError(t, err)
+	assert.Equal(t, "v", reply)
+
+	reply, err = Execute(st, []string{"get", "missing"})
+	assert.NoError(t, err)
+	assert.Nil(t, reply)
+
+	reply, err = Execute(st, []string{"LPUSH", "l", "1", "2", "3"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), reply)
+
+	reply, err = Execute(st, []string{"LPOP", "l", "2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3", "2"}, reply)
+
+	reply, err = Execute(st, []string{"LINDEX", "k", "0"})
+	assert.ErrorIs(t, err, storage.ErrKeyAlreadyExists)
+	assert.Nil(t, reply)
+}
+
+func TestKeys(t *testing.T) {
+	cmd, ok := Lookup("HSET")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"h"}, cmd.Keys([]string{"hset", "h", "f", "v"}))
+	assert.True(t, cmd.IsWrite())
+
+	cmd, ok = Lookup("mset")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "b"}, cmd.Keys([]string{"mset", "a", "1", "b", "2"}))
+
+	cmd, ok = Lookup("copy")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "b"}, cmd.Keys([]string{"copy", "a", "b", "replace"}))
+
+	cmd, ok = Lookup("blpop")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "b"}, cmd.Keys([]string{"blpop", "a", "b", "0"}))
+
+	cmd, ok = Lookup("ping")
+	assert.True(t, ok)
+	assert.Empty(t, cmd.Keys([]string{"ping"}))
+	assert.False(t, cmd.IsWrite())
+}
+
+func TestTransaction(t *testing.T) {
+	st := newTestStorage(t)
+	tx := NewTransaction()
+
+	_, err := tx.Exec(st)
+	assert.ErrorIs(t, err, ErrNoMulti)
+
+	assert.NoError(t, tx.Watch(st, "k"))
+	assert.NoError(t, tx.Multi())
+	assert.True(t, tx.Active())
+	assert.NoError(t, tx.Queue([]string{"SET", "k", "v"}))
+	assert.NoError(t, tx.Queue([]string{"LPUSH", "k", "1"}))
+	replies, err := tx.Exec(st)
+	assert.NoError(t, err)
+	assert.Equal(t, OK, replies[0])
+	assert.ErrorIs(t, replies[1].(error), storage.ErrKeyAlreadyExists)
+	assert.False(t, tx.Active())
+
+	tx.WatchVersion("k", st.KeyVersion("k")+1)
+	assert.NoError(t, tx.Multi())
+	assert.NoError(t, tx.Queue([]string{"SET", "k", "other"}))
+	_, err = tx.Exec(st)
+	assert.ErrorIs(t, err, ErrWatchedChange)
+
+	reply, err := Execute(st, []string{"GET", "k"})
+	assert.NoError(t, err)
+	assert.Equal(t, "v", reply)
+}
+
+func TestSortedSets(t *testing.T) {
+	st := newTestStorage(t)
+
+	reply, err := Execute(st, []string{"ZADD", "z", "1", "a", "2", "b", "3", "c"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), reply)
+	reply, err = Execute(st, []string{"zadd", "z", "xx", "ch", "5", "a", "1", "d"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), reply)
+	reply, err = Execute(st, []string{"zincrby", "z", "0.5", "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, "2.5", reply)
+
+	reply, err = Execute(st, []string{"zrange", "z", "0", "-1", "WITHSCORES"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "2.5", "c", "3", "a", "5"}, reply)
+	reply, err = Execute(st, []string{"zrevrange", "z", "0", "0"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, reply)
+	reply, err = Execute(st, []string{"zrangebyscore", "z", "(2.5", "+inf", "limit", "1", "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, reply)
+	reply, err = Execute(st, []string{"zrevrangebyscore", "z", "3", "-inf", "withscores"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c", "3", "b", "2.5"}, reply)
+
+	reply, err = Execute(st, []string{"zrank", "z", "a"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), reply)
+	reply, err = Execute(st, []string{"zrevrank", "z", "missing"})
+	assert.NoError(t, err)
+	assert.Nil(t, reply)
+	reply, err = Execute(st, []string{"zscore", "z", "c"})
+	assert.NoError(t, err)
+	assert.Equal(t, "3", reply)
+	reply, err = Execute(st, []string{"zrem", "z", "c", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), reply)
+	reply, err = Execute(st, []string{"zcard", "z"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), reply)
+
+	// missing keys are empty sets
+	reply, err = Execute(st, []string{"zcard", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), reply)
+	reply, err = Execute(st, []string{"zrange", "missing", "0", "-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, reply)
+
+	_, err = Execute(st, []string{"zadd", "z", "nx", "xx", "1", "a"})
+	assert.ErrorIs(t, err, ErrSyntax)
+	_, err = Execute(st, []string{"zadd", "z", "1", "a", "2"})
+	assert.ErrorIs(t, err, ErrSyntax)
+	_, err = Execute(st, []string{"zadd", "z", "one", "a"})
+	assert.ErrorIs(t, err, ErrNotFloat)
+	_, err = Execute(st, []string{"zrangebyscore", "z", "x", "1"})
+	assert.ErrorIs(t, err, ErrNotFloat)
+	assert.NoError(t, st.Set("s", "v"))
+	_, err = Execute(st, []string{"zscore", "s", "a"})
+	assert.ErrorIs(t, err, storage.ErrKeyAlreadyExists)
+}
+
+func TestSets(t *testing.T) {
+	st := newTestStorage(t)
+
+	reply, err := Execute(st, []string{"SADD", "s", "a", "b", "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), reply)
+	reply, err = Execute(st, []string{"sismember", "s", "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), reply)
+	reply, err = Execute(st, []string{"smembers", "s"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "a", "b"}, reply)
+	reply, err = Execute(st, []string{"srandmember", "s"})
+	assert.NoError(t, err)
+	assert.Contains(t, []string{"1", "a", "b"}, reply)
+	reply, err = Execute(st, []string{"srandmember", "s", "-5"})
+	assert.NoError(t, err)
+	assert.Len(t, reply, 5)
+
+	_, err = Execute(st, []string{"sadd", "t", "b", "c"})
+	assert.NoError(t, err)
+	reply, err = Execute(st, []string{"sinter", "s", "t"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, reply)
+	reply, err = Execute(st, []string{"sunionstore", "u", "s", "t"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), reply)
+	reply, err = Execute(st, []string{"sdiff", "u", "s"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c"}, reply)
+
+	reply, err = Execute(st, []string{"spop", "t", "5"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"b", "c"}, reply)
+	reply, err = Execute(st, []string{"spop", "t"})
+	assert.NoError(t, err)
+	assert.Nil(t, reply)
+	reply, err = Execute(st, []string{"scard", "t"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), reply)
+	reply, err = Execute(st, []string{"srem", "s", "a", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), reply)
+
+	_, err = Execute(st, []string{"spop", "s", "-1"})
+	assert.ErrorIs(t, err, ErrNotPositive)
+	_, err = Execute(st, []string{"spop", "s", "1", "2"})
+	assert.ErrorIs(t, err, ErrSyntax)
+
+	cmd, ok := Lookup("sinterstore")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"dst", "a", "b"}, cmd.Keys([]string{"sinterstore", "dst", "a", "b"}))
+}
+
+func TestLists(t *testing.T) {
+	st := newTestStorage(t)
+
+	reply, err := Execute(st, []string{"RPUSH", "l", "a", "b", "a", "c"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), reply)
+	reply, err = Execute(st, []string{"lrange", "l", "1", "-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "a", "c"}, reply)
+	reply, err = Execute(st, []string{"lindex", "l", "-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "c", reply)
+	reply, err = Execute(st, []string{"linsert", "l", "AFTER", "b", "x"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), reply)
+	reply, err = Execute(st, []string{"lpos", "l", "a", "RANK", "-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), reply)
+	reply, err = Execute(st, []string{"lpos", "l", "a", "COUNT", "0"})
+	assert.NoError(t, err)
+	assert.Equal(t, []any{int64(0), int64(3)}, reply)
+	reply, err = Execute(st, []string{"lpos", "l", "z"})
+	assert.NoError(t, err)
+	assert.Nil(t, reply)
+	reply, err = Execute(st, []string{"lrem", "l", "0", "a"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), reply)
+	reply, err = Execute(st, []string{"ltrim", "l", "0", "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, OK, reply)
+	reply, err = Execute(st, []string{"lmove", "l", "m", "right", "LEFT"})
+	assert.NoError(t, err)
+	assert.Equal(t, "x", reply)
+	reply, err = Execute(st, []string{"llen", "l"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), reply)
+
+	// missing keys are empty lists
+	reply, err = Execute(st, []string{"lrange", "missing", "0", "-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, reply)
+	reply, err = Execute(st, []string{"linsert", "missing", "before", "a", "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), reply)
+	reply, err = Execute(st, []string{"lmove", "missing", "m", "left", "left"})
+	assert.NoError(t, err)
+	assert.Nil(t, reply)
+
+	_, err = Execute(st, []string{"linsert", "l", "inside", "a", "b"})
+	assert.ErrorIs(t, err, ErrSyntax)
+	_, err = Execute(st, []string{"lpos", "l", "a", "RANK", "0"})
+	assert.ErrorIs(t, err, ErrZeroRank)
+	_, err = Execute(st, []string{"lpos", "l", "a", "COUNT"})
+	assert.ErrorIs(t, err, ErrSyntax)
+	_, err = Execute(st, []string{"lmove", "l", "m", "up", "left"})
+	assert.ErrorIs(t, err, ErrSyntax)
+	_, err = Execute(st, []string{"lrange", "l", "a", "1"})
+	assert.ErrorIs(t, err, ErrNotInteger)
+
+	// LINDEX fails on a key of any other type
+	_, err = Execute(st, []string{"sadd", "set", "a"})
+	assert.NoError(t, err)
+	_, err = Execute(st, []string{"zadd", "zset", "1", "a"})
+	assert.NoError(t, err)
+	for _, key := range []string{"set", "zset"} {
+		_, err = Execute(st, []string{"lindex", key, "0"})
+		assert.ErrorIs(t, err, storage.ErrKeyAlreadyExists, key)
+	}
+	reply, err = Execute(st, []string{"lindex", "missing", "0"})
+	assert.NoError(t, err)
+	assert.Nil(t, reply)
+}
+
+func TestBlockingLists(t *testing.T) {
+	st := newTestStorage(t)
+
+	_, err := Execute(st, []string{"rpush", "l", "a", "b"})
+	assert.NoError(t, err)
+	reply, err := Execute(st, []string{"BLPOP", "missing", "l", "0"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"l", "a"}, reply)
+	reply, err = Execute(st, []string{"blmove", "l", "m", "RIGHT", "left", "0.01"})
+	assert.NoError(t, err)
+	assert.Equal(t, "b", reply)
+	reply, err = Execute(st, []string{"brpop", "l", "0.01"})
+	assert.NoError(t, err)
+	assert.Nil(t, reply)
+
+	// the client waits for a push
+	done := make(chan any, 1)
+	go func() {
+		reply, err := Execute(st, []string{"brpop", "queue", "1"})
+		assert.NoError(t, err)
+		done <- reply
+	}()
+	time.Sleep(10 * time.Millisecond)
+	_, err = Execute(st, []string{"lpush", "queue", "job"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"queue", "job"}, <-done)
+
+	// and stops waiting when the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = ExecuteContext(ctx, st, []string{"blpop", "queue", "0"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = Execute(st, []string{"blpop", "l", "-1"})
+	assert.ErrorIs(t, err, ErrNegativeTimeout)
+	_, err = Execute(st, []string{"blpop", "l", "never"})
+	assert.ErrorIs(t, err, ErrInvalidTimeout)
+	_, err = Execute(st, []string{"blmove", "l", "m", "up", "left", "0"})
+	assert.ErrorIs(t, err, ErrSyntax)
+	_, err = Execute(st, []string{"blpop", "l"})
+	assert.ErrorIs(t, err, ErrWrongArity)
+}
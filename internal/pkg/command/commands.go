@@ -0,0 +1,649 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"hw1/internal/pkg/storage"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	register(
+		&Command{Name: "ping", Arity: -1, Handler: ping},
+		&Command{Name: "echo", Arity: 2, Handler: echo},
+
+		&Command{Name: "get", Arity: 2, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: get},
+		&Command{Name: "set", Arity: -3, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: set},
+		&Command{Name: "mget", Arity: -2, Flags: Read, FirstKey: 1, LastKey: -1, KeyStep: 1, Handler: mget},
+		&Command{Name: "mset", Arity: -3, Flags: Write, FirstKey: 1, LastKey: -1, KeyStep: 2, Handler: mset},
+		&Command{Name: "append", Arity: 3, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: appendString},
+		&Command{Name: "strlen", Arity: 2, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: strlen},
+		&Command{Name: "getrange", Arity: 4, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: getRange},
+		&Command{Name: "setrange", Arity: 4, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: setRange},
+		&Command{Name: "getset", Arity: 3, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: getSet},
+		&Command{Name: "getdel", Arity: 2, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: getDel},
+		&Command{Name: "incr", Arity: 2, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: incr},
+		&Command{Name: "decr", Arity: 2, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: incr},
+		&Command{Name: "incrby", Arity: 3, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: incr},
+		&Command{Name: "decrby", Arity: 3, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: incr},
+		&Command{Name: "incrbyfloat", Arity: 3, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: incrByFloat},
+		&Command{Name: "expire", Arity: 3, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: expire},
+		&Command{Name: "pexpire", Arity: 3, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: expire},
+		&Command{Name: "ttl", Arity: 2, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: ttl},
+		&Command{Name: "pttl", Arity: 2, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: ttl},
+		&Command{Name: "persist", Arity: 2, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: persist},
+		&Command{Name: "del", Arity: -2, Flags: Write, FirstKey: 1, LastKey: -1, KeyStep: 1, Handler: del},
+		&Command{Name: "exists", Arity: -2, Flags: Read, FirstKey: 1, LastKey: -1, KeyStep: 1, Handler: exists},
+		&Command{Name: "type", Arity: 2, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: typeOf},
+		&Command{Name: "rename", Arity: 3, Flags: Write, FirstKey: 1, LastKey: 2, KeyStep: 1, Handler: rename},
+		&Command{Name: "copy", Arity: -3, Flags: Write, FirstKey: 1, LastKey: 2, KeyStep: 1, Handler: copyKey},
+		&Command{Name: "keys", Arity: -2, Flags: Read, Handler: keys},
+		&Command{Name: "dbsize", Arity: 1, Flags: Read, Handler: dbsize},
+		&Command{Name: "flushdb", Arity: -1, Flags: Write, Handler: flushdb},
+		&Command{Name: "swapdb", Arity: 3, Flags: Write, Handler: swapdb},
+		&Command{Name: "scan", Arity: -2, Flags: Read, Handler: scan},
+
+		&Command{Name: "hset", Arity: -4, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: hset},
+		&Command{Name: "hget", Arity: 3, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: hget},
+		&Command{Name: "hdel", Arity: -3, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: hdel},
+		&Command{Name: "hgetall", Arity: 2, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: hgetall},
+		&Command{Name: "hlen", Arity: 2, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: hlen},
+
+		&Command{Name: "sadd", Arity: -3, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: sadd},
+		&Command{Name: "srem", Arity: -3, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: srem},
+		&Command{Name: "sismember", Arity: 3, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: sismember},
+		&Command{Name: "smembers", Arity: 2, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: smembers},
+		&Command{Name: "scard", Arity: 2, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: scard},
+		&Command{Name: "spop", Arity: -2, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: spop},
+		&Command{Name: "srandmember", Arity: -2, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: srandmember},
+		&Command{Name: "sinter", Arity: -2, Flags: Read, FirstKey: 1, LastKey: -1, KeyStep: 1, Handler: combine},
+		&Command{Name: "sunion", Arity: -2, Flags: Read, FirstKey: 1, LastKey: -1, KeyStep: 1, Handler: combine},
+		&Command{Name: "sdiff", Arity: -2, Flags: Read, FirstKey: 1, LastKey: -1, KeyStep: 1, Handler: combine},
+		&Command{Name: "sinterstore", Arity: -3, Flags: Write, FirstKey: 1, LastKey: -1, KeyStep: 1, Handler: combineStore},
+		&Command{Name: "sunionstore", Arity: -3, Flags: Write, FirstKey: 1, LastKey: -1, KeyStep: 1, Handler: combineStore},
+		&Command{Name: "sdiffstore", Arity: -3, Flags: Write, FirstKey: 1, LastKey: -1, KeyStep: 1, Handler: combineStore},
+
+		&Command{Name: "zadd", Arity: -4, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: zadd},
+		&Command{Name: "zincrby", Arity: 4, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: zincrby},
+		&Command{Name: "zrem", Arity: -3, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: zrem},
+		&Command{Name: "zscore", Arity: 3, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: zscore},
+		&Command{Name: "zcard", Arity: 2, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: zcard},
+		&Command{Name: "zrank", Arity: 3, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: zrank},
+		&Command{Name: "zrevrank", Arity: 3, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: zrank},
+		&Command{Name: "zrange", Arity: -4, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: zrange},
+		&Command{Name: "zrevrange", Arity: -4, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: zrange},
+		&Command{Name: "zrangebyscore", Arity: -4, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: zrangeByScore},
+		&Command{Name: "zrevrangebyscore", Arity: -4, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: zrangeByScore},
+
+		&Command{Name: "lpush", Arity: -3, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: push},
+		&Command{Name: "rpush", Arity: -3, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: push},
+		&Command{Name: "raddtoset", Arity: -2, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: raddtoset},
+		&Command{Name: "lpop", Arity: -2, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: pop},
+		&Command{Name: "rpop", Arity: -2, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: pop},
+		&Command{Name: "deletesegment", Arity: 4, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: deleteSegment},
+		&Command{Name: "lset", Arity: 4, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: lset},
+		&Command{Name: "lindex", Arity: 3, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: lindex},
+		&Command{Name: "lget", Arity: 3, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: lget},
+		&Command{Name: "llen", Arity: 2, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: llen},
+		&Command{Name: "lrange", Arity: 4, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: lrange},
+		&Command{Name: "linsert", Arity: 5, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: linsert},
+		&Command{Name: "lrem", Arity: 4, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: lrem},
+		&Command{Name: "ltrim", Arity: 4, Flags: Write, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: ltrim},
+		&Command{Name: "lpos", Arity: -3, Flags: Read, FirstKey: 1, LastKey: 1, KeyStep: 1, Handler: lpos},
+		&Command{Name: "lmove", Arity: 5, Flags: Write, FirstKey: 1, LastKey: 2, KeyStep: 1, Handler: lmove},
+		&Command{Name: "blpop", Arity: -3, Flags: Write, FirstKey: 1, LastKey: -2, KeyStep: 1, Blocking: bpop},
+		&Command{Name: "brpop", Arity: -3, Flags: Write, FirstKey: 1, LastKey: -2, KeyStep: 1, Blocking: bpop},
+		&Command{Name: "blmove", Arity: 6, Flags: Write, FirstKey: 1, LastKey: 2, KeyStep: 1, Blocking: blmove},
+	)
+}
+
+func ping(st *storage.Storage, args []string) (any, error) {
+	switch len(args) {
+	case 1:
+		return Status("PONG"), nil
+	case 2:
+		return args[1], nil
+	default:
+		return nil, arityError(args[0])
+	}
+}
+
+func echo(st *storage.Storage, args []string) (any, error) {
+	return args[1], nil
+}
+
+// get returns the scalar or nil, a key of another type is an error.
+func get(st *storage.Storage, args []string) (any, error) {
+	v, _, err := st.GetTyped(args[1])
+	if errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// set sets the value: SET key value [EX seconds | PX milliseconds] [TYPE string|int|auto].
+// TYPE is not in redis, it stores the value as the given kind, by default it is auto.
+func set(st *storage.Storage, args []string) (any, error) {
+	key, value := args[1], args[2]
+
+	var (
+		ms    int64
+		k     = storage.KindAuto
+		typed bool
+	)
+	for i := 3; i < len(args); i += 2 {
+		option := strings.ToLower(args[i])
+		if i+1 == len(args) {
+			return nil, ErrSyntax
+		}
+
+		switch option {
+		case "ex", "px":
+			if ms != 0 {
+				return nil, ErrSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return nil, ErrNotInteger
+			}
+			if n <= 0 || (option == "ex" && n > math.MaxInt64/1000) {
+				return nil, fmt.Errorf("%w in 'set' command", ErrInvalidExpire)
+			}
+			ms = n
+			if option == "ex" {
+				ms = n * 1000
+			}
+		case "type":
+			var ok bool
+			if k, ok = storage.KindByName(strings.ToLower(args[i+1])); typed || !ok {
+				return nil, ErrSyntax
+			}
+			typed = true
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	err := st.SetTyped(key, value, k, ms)
+	// the argument is wrong, not the stored value
+	if errors.Is(err, storage.ErrNotInteger) {
+		return nil, ErrNotInteger
+	}
+	if errors.Is(err, storage.ErrNotFloat) {
+		return nil, ErrNotFloat
+	}
+	if errors.Is(err, storage.ErrIncorrectArgs) {
+		return nil, fmt.Errorf("%w in 'set' command", ErrInvalidExpire)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return OK, nil
+}
+
+// mget returns the scalars of the keys, nil for missing keys and keys of other types.
+func mget(st *storage.Storage, args []string) (any, error) {
+	values := st.MGet(args[1:]...)
+	reply := make([]any, len(values))
+	for i, v := range values {
+		if v != nil {
+			reply[i] = *v
+		}
+	}
+	return reply, nil
+}
+
+// mset sets the scalars: MSET key value [key value ...].
+func mset(st *storage.Storage, args []string) (any, error) {
+	if len(args)%2 == 0 {
+		return nil, arityError(args[0])
+	}
+	if err := st.MSet(args[1:]...); err != nil {
+		return nil, err
+	}
+	return OK, nil
+}
+
+func appendString(st *storage.Storage, args []string) (any, error) {
+	length, err := st.Append(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	return int64(length), nil
+}
+
+func strlen(st *storage.Storage, args []string) (any, error) {
+	length, err := st.Strlen(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return int64(length), nil
+}
+
+// getRange serves GETRANGE key start end.
+func getRange(st *storage.Storage, args []string) (any, error) {
+	ints, err := parseInts(args[2:])
+	if err != nil {
+		return nil, err
+	}
+	return st.GetRange(args[1], ints[0], ints[1])
+}
+
+// setRange serves SETRANGE key offset value.
+func setRange(st *storage.Storage, args []string) (any, error) {
+	offset, err := strconv.Atoi(args[2])
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	length, err := st.SetRange(args[1], offset, args[3])
+	if err != nil {
+		return nil, err
+	}
+	return int64(length), nil
+}
+
+// getSet returns the old value or nil.
+func getSet(st *storage.Storage, args []string) (any, error) {
+	old, exists, err := st.GetSet(args[1], args[2])
+	if err != nil || !exists {
+		return nil, err
+	}
+	return old, nil
+}
+
+// getDel returns the deleted value or nil.
+func getDel(st *storage.Storage, args []string) (any, error) {
+	value, err := st.GetDel(args[1])
+	if errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// incr serves INCR key, DECR key, INCRBY key delta and DECRBY key delta.
+func incr(st *storage.Storage, args []string) (any, error) {
+	delta := int64(1)
+	if len(args) == 3 {
+		n, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return nil, ErrNotInteger
+		}
+		delta = n
+	}
+	if strings.HasPrefix(args[0], "decr") {
+		if delta == math.MinInt64 {
+			return nil, storage.ErrOverflow
+		}
+		delta = -delta
+	}
+	return st.IncrBy(args[1], delta)
+}
+
+// incrByFloat serves INCRBYFLOAT key delta, the reply is the new value as a string like in redis.
+func incrByFloat(st *storage.Storage, args []string) (any, error) {
+	delta, err := strconv.ParseFloat(args[2], 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return nil, ErrNotFloat
+	}
+	result, err := st.IncrByFloat(args[1], delta)
+	if err != nil {
+		return nil, err
+	}
+	return strconv.FormatFloat(result, 'f', -1, 64), nil
+}
+
+// expire serves EXPIRE key seconds and PEXPIRE key milliseconds.
+func expire(st *storage.Storage, args []string) (any, error) {
+	n, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+
+	ms := n
+	if args[0] == "expire" {
+		if n > math.MaxInt64/1000 || n < math.MinInt64/1000 {
+			return nil, fmt.Errorf("%w in '%s' command", ErrInvalidExpire, args[0])
+		}
+		ms = n * 1000
+	}
+	// an expiration in the past or 0 deletes the key like in redis, for PExpire 0 means no expiration
+	if ms <= 0 {
+		ms = -1
+	}
+	ok, err := st.PExpire(args[1], ms)
+	if errors.Is(err, storage.ErrIncorrectArgs) {
+		return nil, fmt.Errorf("%w in '%s' command", ErrInvalidExpire, args[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return boolReply(ok), nil
+}
+
+func ttl(st *storage.Storage, args []string) (any, error) {
+	if args[0] == "ttl" {
+		return st.TTL(args[1]), nil
+	}
+	return st.PTTL(args[1]), nil
+}
+
+func persist(st *storage.Storage, args []string) (any, error) {
+	return boolReply(st.Persist(args[1])), nil
+}
+
+func del(st *storage.Storage, args []string) (any, error) {
+	return int64(st.Del(args[1:]...)), nil
+}
+
+func exists(st *storage.Storage, args []string) (any, error) {
+	return int64(st.Exists(args[1:]...)), nil
+}
+
+func typeOf(st *storage.Storage, args []string) (any, error) {
+	return Status(st.Type(args[1])), nil
+}
+
+func rename(st *storage.Storage, args []string) (any, error) {
+	if err := st.Rename(args[1], args[2]); err != nil {
+		return nil, err
+	}
+	return OK, nil
+}
+
+// copyKey copies the value: COPY source destination [REPLACE].
+func copyKey(st *storage.Storage, args []string) (any, error) {
+	replace := false
+	for _, option := range args[3:] {
+		if !strings.EqualFold(option, "replace") {
+			return nil, ErrSyntax
+		}
+		replace = true
+	}
+
+	copied, err := st.Copy(args[1], args[2], replace)
+	if err != nil {
+		return nil, err
+	}
+	return boolReply(copied), nil
+}
+
+func dbsize(st *storage.Storage, args []string) (any, error) {
+	return int64(st.DBSize()), nil
+}
+
+// flushdb deletes the keys of the database: FLUSHDB [SYNC|ASYNC], it is always synchronous.
+func flushdb(st *storage.Storage, args []string) (any, error) {
+	if len(args) > 2 || (len(args) == 2 && !strings.EqualFold(args[1], "sync") && !strings.EqualFold(args[1], "async")) {
+		return nil, ErrSyntax
+	}
+	st.FlushDB()
+	return OK, nil
+}
+
+func swapdb(st *storage.Storage, args []string) (any, error) {
+	if err := st.SwapDB(args[1], args[2]); err != nil {
+		return nil, err
+	}
+	return OK, nil
+}
+
+// keys returns the keys matching the glob: KEYS pattern, or the regular expression: KEYS REGEXP expr.
+func keys(st *storage.Storage, args []string) (any, error) {
+	switch {
+	case len(args) == 2:
+		return st.Keys(args[1]), nil
+	case len(args) == 3 && strings.EqualFold(args[1], "regexp"):
+		return st.KeysRegexp(args[2])
+	default:
+		return nil, ErrSyntax
+	}
+}
+
+// scan iterates over the keys: SCAN cursor [MATCH pattern] [COUNT count] [TYPE type].
+// The reply is the next cursor and the keys.
+func scan(st *storage.Storage, args []string) (any, error) {
+	cursor, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var opts storage.ScanOptions
+	for i := 2; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return nil, ErrSyntax
+		}
+		switch strings.ToLower(args[i]) {
+		case "match":
+			opts.Match = args[i+1]
+		case "count":
+			opts.Count, err = strconv.Atoi(args[i+1])
+			if err != nil || opts.Count <= 0 {
+				return nil, ErrNotInteger
+			}
+		case "type":
+			opts.Type = strings.ToLower(args[i+1])
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	next, keys, err := st.Scan(cursor, opts)
+	if err != nil {
+		return nil, err
+	}
+	return []any{strconv.FormatUint(next, 10), keys}, nil
+}
+
+func hset(st *storage.Storage, args []string) (any, error) {
+	if len(args)%2 != 0 {
+		return nil, arityError(args[0])
+	}
+
+	added, err := st.Hset(args[1], args[2:]...)
+	if err != nil {
+		return nil, err
+	}
+	return int64(added), nil
+}
+
+// hget returns the field or nil.
+func hget(st *storage.Storage, args []string) (any, error) {
+	v, err := st.Hget(args[1], args[2])
+	if errors.Is(err, storage.ErrKeyDoesntExist) || errors.Is(err, storage.ErrFieldDoesntExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func hdel(st *storage.Storage, args []string) (any, error) {
+	deleted, err := st.Hdel(args[1], args[2:]...)
+	if err != nil && !errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, err
+	}
+	return int64(deleted), nil
+}
+
+// hgetall returns the fields, a missing key is an empty hash.
+func hgetall(st *storage.Storage, args []string) (any, error) {
+	hash, err := st.Hgetall(args[1])
+	if err != nil && !errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, err
+	}
+	if hash == nil {
+		hash = map[string]string{}
+	}
+	return hash, nil
+}
+
+func hlen(st *storage.Storage, args []string) (any, error) {
+	length, err := st.Hlen(args[1])
+	if err != nil && !errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, err
+	}
+	return int64(length), nil
+}
+
+// push serves LPUSH and RPUSH.
+func push(st *storage.Storage, args []string) (any, error) {
+	elements := args[2:]
+
+	var length int
+	var err error
+	if args[0] == "lpush" {
+		// redis pushes the elements one by one, so they end up in the reverse order
+		elements = slices.Clone(elements)
+		slices.Reverse(elements)
+		length, err = st.Lpush(args[1], elements...)
+	} else {
+		length, err = st.Rpush(args[1], elements...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return int64(length), nil
+}
+
+// raddtoset appends the elements which are not in the list yet: RADDTOSET key [element ...].
+func raddtoset(st *storage.Storage, args []string) (any, error) {
+	if err := st.Raddtoset(args[1], args[2:]...); err != nil {
+		return nil, err
+	}
+	return OK, nil
+}
+
+// pop serves LPOP key [count] and RPOP key [count] like redis does, they reply nil for a missing key.
+// LPOP key left right and RPOP key left right delete the segment between the indexes, like DELETESEGMENT,
+// negative indexes count from the end.
+func pop(st *storage.Storage, args []string) (any, error) {
+	pop := st.Lpop
+	if args[0] == "rpop" {
+		pop = st.Rpop
+	}
+
+	switch len(args) {
+	case 2:
+		popped, err := pop(args[1])
+		// the key is missing or the list is empty
+		if errors.Is(err, storage.ErrKeyDoesntExist) || errors.Is(err, storage.ErrIndexOutOfRange) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return popped[0], nil
+	case 3:
+		count, err := strconv.Atoi(args[2])
+		if err != nil || count < 0 {
+			return nil, ErrNotPositive
+		}
+
+		side := storage.ListLeft
+		if args[0] == "rpop" {
+			side = storage.ListRight
+		}
+		// redis pops as many elements as there are
+		popped, err := st.PopAtMost(args[1], side, count)
+		if errors.Is(err, storage.ErrKeyDoesntExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(popped) == 0 && count > 0 {
+			return nil, nil
+		}
+		return popped, nil
+	case 4:
+		ints, err := parseInts(args[2:])
+		if err != nil {
+			return nil, err
+		}
+		popped, err := pop(args[1], ints[0], ints[1])
+		if err != nil {
+			return nil, err
+		}
+		return popped, nil
+	default:
+		return nil, arityError(args[0])
+	}
+}
+
+// deleteSegment deletes the elements between the indexes and returns them: DELETESEGMENT key left right.
+func deleteSegment(st *storage.Storage, args []string) (any, error) {
+	ints, err := parseInts(args[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := st.DeleteSegment(args[1], ints[0], ints[1])
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+func lset(st *storage.Storage, args []string) (any, error) {
+	index, err := strconv.Atoi(args[2])
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+
+	if err := st.Lset(args[1], index, args[3]); err != nil {
+		return nil, err
+	}
+	return OK, nil
+}
+
+// lindex returns the element or nil if there is no such element.
+func lindex(st *storage.Storage, args []string) (any, error) {
+	v, err := lget(st, args)
+	if errors.Is(err, storage.ErrKeyDoesntExist) || errors.Is(err, storage.ErrIndexOutOfRange) {
+		return nil, nil
+	}
+	return v, err
+}
+
+// lget returns the element, unlike LINDEX a missing element is an error.
+func lget(st *storage.Storage, args []string) (any, error) {
+	index, err := strconv.Atoi(args[2])
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+
+	v, err := st.Lget(args[1], index)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func boolReply(ok bool) int64 {
+	if ok {
+		return 1
+	}
+	return 0
+}
+
+func parseInts(args []string) ([]int, error) {
+	ints := make([]int, len(args))
+	for i, arg := range args {
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, ErrNotInteger
+		}
+		ints[i] = n
+	}
+	return ints, nil
+}
@@ -0,0 +1,240 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"hw1/internal/pkg/storage"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrZeroRank is returned by LPOS for RANK 0, the ranks start from 1 or from -1 at the tail.
+	ErrZeroRank = errors.New("RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+
+	ErrInvalidTimeout  = errors.New("timeout is not a float or out of range")
+	ErrNegativeTimeout = errors.New("timeout is negative")
+)
+
+func llen(st *storage.Storage, args []string) (any, error) {
+	length, err := st.Llen(args[1])
+	if err != nil && !errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, err
+	}
+	return int64(length), nil
+}
+
+// lrange serves LRANGE key start stop, a missing key is an empty list.
+func lrange(st *storage.Storage, args []string) (any, error) {
+	start, err := strconv.Atoi(args[2])
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	stop, err := strconv.Atoi(args[3])
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+
+	elements, err := st.Lrange(args[1], start, stop)
+	if errors.Is(err, storage.ErrKeyDoesntExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return elements, nil
+}
+
+// linsert serves LINSERT key BEFORE|AFTER pivot element, the reply is the new length,
+// -1 if there is no pivot and 0 if there is no key.
+func linsert(st *storage.Storage, args []string) (any, error) {
+	var before bool
+	switch strings.ToLower(args[2]) {
+	case "before":
+		before = true
+	case "after":
+	default:
+		return nil, ErrSyntax
+	}
+
+	length, err := st.Linsert(args[1], before, args[3], args[4])
+	if err != nil && !errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, err
+	}
+	return int64(length), nil
+}
+
+// lrem serves LREM key count element.
+func lrem(st *storage.Storage, args []string) (any, error) {
+	count, err := strconv.Atoi(args[2])
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+
+	removed, err := st.Lrem(args[1], count, args[3])
+	if err != nil && !errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, err
+	}
+	return int64(removed), nil
+}
+
+// ltrim serves LTRIM key start stop, there is nothing to trim for a missing key.
+func ltrim(st *storage.Storage, args []string) (any, error) {
+	start, err := strconv.Atoi(args[2])
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	stop, err := strconv.Atoi(args[3])
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+
+	if err := st.Ltrim(args[1], start, stop); err != nil && !errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, err
+	}
+	return OK, nil
+}
+
+// lpos serves LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]. Without COUNT
+// the reply is the index of the match or nil, with COUNT it is the array of the indexes.
+func lpos(st *storage.Storage, args []string) (any, error) {
+	var opts storage.LPosOptions
+	withCount := false
+	for i := 3; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return nil, ErrSyntax
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			return nil, ErrNotInteger
+		}
+		switch strings.ToLower(args[i]) {
+		case "rank":
+			if n == 0 {
+				return nil, ErrZeroRank
+			}
+			opts.Rank = n
+		case "count":
+			if n < 0 {
+				return nil, ErrNotPositive
+			}
+			opts.Count = n
+			withCount = true
+		case "maxlen":
+			if n < 0 {
+				return nil, ErrNotPositive
+			}
+			opts.MaxLen = n
+		default:
+			return nil, ErrSyntax
+		}
+	}
+	if !withCount {
+		opts.Count = 1
+	}
+
+	found, err := st.Lpos(args[1], args[2], opts)
+	if err != nil && !errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, err
+	}
+	if !withCount {
+		if len(found) == 0 {
+			return nil, nil
+		}
+		return int64(found[0]), nil
+	}
+	indexes := make([]any, len(found))
+	for i, index := range found {
+		indexes[i] = int64(index)
+	}
+	return indexes, nil
+}
+
+// lmove serves LMOVE source destination LEFT|RIGHT LEFT|RIGHT, the reply is the moved element
+// or nil if the source is missing or empty.
+func lmove(st *storage.Storage, args []string) (any, error) {
+	from, ok := parseSide(args[3])
+	if !ok {
+		return nil, ErrSyntax
+	}
+	to, ok := parseSide(args[4])
+	if !ok {
+		return nil, ErrSyntax
+	}
+
+	element, err := st.Lmove(args[1], args[2], from, to)
+	if errors.Is(err, storage.ErrKeyDoesntExist) || errors.Is(err, storage.ErrIndexOutOfRange) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return element, nil
+}
+
+func parseSide(arg string) (storage.ListSide, bool) {
+	side := storage.ListSide(strings.ToLower(arg))
+	return side, side == storage.ListLeft || side == storage.ListRight
+}
+
+// bpop serves BLPOP and BRPOP key [key ...] timeout, the reply is the key with the popped element
+// or nil if the time is out.
+func bpop(ctx context.Context, st *storage.Storage, args []string) (any, error) {
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	pop := st.BLpop
+	if args[0] == "brpop" {
+		pop = st.BRpop
+	}
+	key, element, err := pop(ctx, timeout, args[1:len(args)-1]...)
+	if errors.Is(err, storage.ErrTimeout) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []string{key, element}, nil
+}
+
+// blmove serves BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout,
+// the reply is the moved element or nil if the time is out.
+func blmove(ctx context.Context, st *storage.Storage, args []string) (any, error) {
+	from, ok := parseSide(args[3])
+	if !ok {
+		return nil, ErrSyntax
+	}
+	to, ok := parseSide(args[4])
+	if !ok {
+		return nil, ErrSyntax
+	}
+	timeout, err := parseTimeout(args[5])
+	if err != nil {
+		return nil, err
+	}
+
+	element, err := st.BLmove(ctx, timeout, args[1], args[2], from, to)
+	if errors.Is(err, storage.ErrTimeout) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return element, nil
+}
+
+// parseTimeout parses the timeout of the blocking commands in seconds, 0 means no limit.
+func parseTimeout(arg string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(seconds) || seconds > math.MaxInt64/float64(time.Second) {
+		return 0, ErrInvalidTimeout
+	}
+	if seconds < 0 {
+		return 0, ErrNegativeTimeout
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
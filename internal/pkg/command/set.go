@@ -0,0 +1,130 @@
+package command
+
+import (
+	"errors"
+	"hw1/internal/pkg/storage"
+	"strconv"
+)
+
+func sadd(st *storage.Storage, args []string) (any, error) {
+	added, err := st.SAdd(args[1], args[2:]...)
+	if err != nil {
+		return nil, err
+	}
+	return int64(added), nil
+}
+
+func srem(st *storage.Storage, args []string) (any, error) {
+	removed, err := st.SRem(args[1], args[2:]...)
+	if err != nil && !errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, err
+	}
+	return int64(removed), nil
+}
+
+func sismember(st *storage.Storage, args []string) (any, error) {
+	found, err := st.SIsMember(args[1], args[2])
+	if err != nil && !errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, err
+	}
+	return boolReply(found), nil
+}
+
+// smembers returns the members sorted, a missing key is an empty set.
+func smembers(st *storage.Storage, args []string) (any, error) {
+	members, err := st.SMembers(args[1])
+	if err != nil && !errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, err
+	}
+	if members == nil {
+		members = []string{}
+	}
+	return members, nil
+}
+
+func scard(st *storage.Storage, args []string) (any, error) {
+	n, err := st.SCard(args[1])
+	if err != nil && !errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, err
+	}
+	return int64(n), nil
+}
+
+// spop serves SPOP key [count]. Without count the reply is one member or nil,
+// with count it is a list like in redis.
+func spop(st *storage.Storage, args []string) (any, error) {
+	return randomReply(args, func(count int) ([]string, error) {
+		if count < 0 {
+			return nil, ErrNotPositive
+		}
+		return st.SPop(args[1], count)
+	})
+}
+
+// srandmember serves SRANDMEMBER key [count], a negative count allows repeated members.
+func srandmember(st *storage.Storage, args []string) (any, error) {
+	return randomReply(args, func(count int) ([]string, error) {
+		return st.SRandMember(args[1], count)
+	})
+}
+
+func randomReply(args []string, fn func(count int) ([]string, error)) (any, error) {
+	if len(args) > 3 {
+		return nil, ErrSyntax
+	}
+	count := 1
+	if len(args) == 3 {
+		n, err := strconv.Atoi(args[2])
+		if err != nil {
+			return nil, ErrNotInteger
+		}
+		count = n
+	}
+
+	members, err := fn(count)
+	if err != nil && !errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, err
+	}
+	if len(args) == 2 {
+		if len(members) == 0 {
+			return nil, nil
+		}
+		return members[0], nil
+	}
+	if members == nil {
+		members = []string{}
+	}
+	return members, nil
+}
+
+// combine serves SINTER, SUNION and SDIFF.
+func combine(st *storage.Storage, args []string) (any, error) {
+	var fn func(keys ...string) ([]string, error)
+	switch args[0] {
+	case "sinter":
+		fn = st.SInter
+	case "sunion":
+		fn = st.SUnion
+	default:
+		fn = st.SDiff
+	}
+	return fn(args[1:]...)
+}
+
+// combineStore serves SINTERSTORE, SUNIONSTORE and SDIFFSTORE destination key [key ...].
+func combineStore(st *storage.Storage, args []string) (any, error) {
+	var fn func(dst string, keys ...string) (int, error)
+	switch args[0] {
+	case "sinterstore":
+		fn = st.SInterStore
+	case "sunionstore":
+		fn = st.SUnionStore
+	default:
+		fn = st.SDiffStore
+	}
+	n, err := fn(args[1], args[2:]...)
+	if err != nil {
+		return nil, err
+	}
+	return int64(n), nil
+}
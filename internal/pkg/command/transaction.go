@@ -0,0 +1,137 @@
+package command
+
+import (
+	"errors"
+	"hw1/internal/pkg/storage"
+)
+
+var (
+	ErrNestedMulti   = errors.New("MULTI calls can not be nested")
+	ErrNoMulti       = errors.New("transaction is not started")
+	ErrWatchInMulti  = errors.New("WATCH inside MULTI is not allowed")
+	ErrExecAborted   = errors.New("transaction discarded because of previous errors")
+	ErrWatchedChange = errors.New("transaction aborted, a watched key was modified")
+)
+
+// Transaction is the MULTI/EXEC state of a client. Commands given after Multi are only
+// checked and queued, Exec runs them atomically. Like in redis, there is no rollback:
+// a command failing at run time gets its error as the reply, the others still run.
+//
+// WATCH makes the transaction optimistic: Exec runs nothing if a watched key
+// was written or deleted since it was watched.
+type Transaction struct {
+	active  bool
+	failed  bool // a command was rejected while queued
+	queue   [][]string
+	watched map[string]uint64
+}
+
+func NewTransaction() *Transaction {
+	return &Transaction{
+		watched: make(map[string]uint64),
+	}
+}
+
+// Active reports whether the commands are queued now.
+func (t *Transaction) Active() bool {
+	return t.active
+}
+
+func (t *Transaction) Multi() error {
+	if t.active {
+		return ErrNestedMulti
+	}
+	t.active = true
+	return nil
+}
+
+// Queue checks the command and adds it to the transaction.
+// A rejected command makes Exec discard the whole transaction.
+func (t *Transaction) Queue(args []string) error {
+	if _, err := check(args); err != nil {
+		t.failed = true
+		return err
+	}
+	t.queue = append(t.queue, append([]string(nil), args...))
+	return nil
+}
+
+// Watch remembers the current versions of the keys.
+func (t *Transaction) Watch(st *storage.Storage, keys ...string) error {
+	if t.active {
+		return ErrWatchInMulti
+	}
+	for _, key := range keys {
+		if _, ok := t.watched[key]; !ok {
+			t.watched[key] = st.KeyVersion(key)
+		}
+	}
+	return nil
+}
+
+// WatchVersion watches the key as if it had the version, it lets stateless clients
+// watch the versions they got earlier.
+func (t *Transaction) WatchVersion(key string, version uint64) {
+	t.watched[key] = version
+}
+
+func (t *Transaction) Unwatch() {
+	clear(t.watched)
+}
+
+// Discard drops the queued commands and the watched keys.
+func (t *Transaction) Discard() error {
+	if !t.active {
+		return ErrNoMulti
+	}
+	t.reset()
+	return nil
+}
+
+// Exec runs the queued commands under the lock of the whole storage and returns their replies,
+// the reply of a failed command is its error. ErrWatchedChange is returned
+// if a watched key was changed, then nothing is run. Either way the transaction ends.
+func (t *Transaction) Exec(st *storage.Storage) ([]any, error) {
+	if !t.active {
+		return nil, ErrNoMulti
+	}
+	defer t.reset()
+
+	if t.failed {
+		return nil, ErrExecAborted
+	}
+
+	var (
+		replies []any
+		changed bool
+	)
+	st.Atomically(func(tx *storage.Storage) {
+		for key, version := range t.watched {
+			if tx.KeyVersion(key) != version {
+				changed = true
+				return
+			}
+		}
+
+		replies = make([]any, len(t.queue))
+		for i, args := range t.queue {
+			reply, err := Execute(tx, args)
+			if err != nil {
+				replies[i] = err
+			} else {
+				replies[i] = reply
+			}
+		}
+	})
+	if changed {
+		return nil, ErrWatchedChange
+	}
+	return replies, nil
+}
+
+func (t *Transaction) reset() {
+	t.active = false
+	t.failed = false
+	t.queue = nil
+	clear(t.watched)
+}
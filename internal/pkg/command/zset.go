@@ -0,0 +1,221 @@
+package command
+
+import (
+	"errors"
+	"hw1/internal/pkg/storage"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// zadd serves ZADD key [NX|XX] [GT|LT] [CH] score member [score member ...].
+func zadd(st *storage.Storage, args []string) (any, error) {
+	var opts storage.ZAddOptions
+	i := 2
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "nx":
+			opts.NX = true
+		case "xx":
+			opts.XX = true
+		case "gt":
+			opts.GT = true
+		case "lt":
+			opts.LT = true
+		case "ch":
+			opts.CH = true
+		default:
+			break options
+		}
+	}
+	if i == len(args) || (len(args)-i)%2 != 0 {
+		return nil, ErrSyntax
+	}
+
+	members := make([]storage.ZMember, 0, (len(args)-i)/2)
+	for ; i < len(args); i += 2 {
+		score, err := parseScore(args[i])
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, storage.ZMember{Member: args[i+1], Score: score})
+	}
+
+	n, err := st.ZAdd(args[1], opts, members...)
+	if errors.Is(err, storage.ErrIncorrectArgs) {
+		return nil, ErrSyntax
+	}
+	if err != nil {
+		return nil, err
+	}
+	return int64(n), nil
+}
+
+// zincrby serves ZINCRBY key delta member, the reply is the new score as a string like in redis.
+func zincrby(st *storage.Storage, args []string) (any, error) {
+	delta, err := parseScore(args[2])
+	if err != nil {
+		return nil, err
+	}
+	score, err := st.ZIncrBy(args[1], delta, args[3])
+	if err != nil {
+		return nil, err
+	}
+	return formatScore(score), nil
+}
+
+func zrem(st *storage.Storage, args []string) (any, error) {
+	removed, err := st.ZRem(args[1], args[2:]...)
+	if err != nil && !errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, err
+	}
+	return int64(removed), nil
+}
+
+// zscore returns the score or nil.
+func zscore(st *storage.Storage, args []string) (any, error) {
+	score, err := st.ZScore(args[1], args[2])
+	if errors.Is(err, storage.ErrKeyDoesntExist) || errors.Is(err, storage.ErrMemberDoesntExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return formatScore(score), nil
+}
+
+func zcard(st *storage.Storage, args []string) (any, error) {
+	n, err := st.ZCard(args[1])
+	if err != nil && !errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, err
+	}
+	return int64(n), nil
+}
+
+// zrank serves ZRANK and ZREVRANK, the reply is nil if there is no such member.
+func zrank(st *storage.Storage, args []string) (any, error) {
+	rank, err := st.ZRank(args[1], args[2], args[0] == "zrevrank")
+	if errors.Is(err, storage.ErrKeyDoesntExist) || errors.Is(err, storage.ErrMemberDoesntExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return int64(rank), nil
+}
+
+// zrange serves ZRANGE and ZREVRANGE key start stop [WITHSCORES].
+func zrange(st *storage.Storage, args []string) (any, error) {
+	start, err := strconv.Atoi(args[2])
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	stop, err := strconv.Atoi(args[3])
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	withScores := false
+	for _, option := range args[4:] {
+		if !strings.EqualFold(option, "withscores") {
+			return nil, ErrSyntax
+		}
+		withScores = true
+	}
+
+	members, err := st.ZRange(args[1], start, stop, args[0] == "zrevrange")
+	if err != nil && !errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, err
+	}
+	return formatMembers(members, withScores), nil
+}
+
+// zrangeByScore serves ZRANGEBYSCORE key min max and ZREVRANGEBYSCORE key max min
+// with [WITHSCORES] [LIMIT offset count]. The bounds are inclusive, "(" makes them exclusive,
+// -inf and +inf are accepted.
+func zrangeByScore(st *storage.Storage, args []string) (any, error) {
+	rev := args[0] == "zrevrangebyscore"
+	minArg, maxArg := args[2], args[3]
+	if rev {
+		minArg, maxArg = maxArg, minArg
+	}
+
+	var sr storage.ScoreRange
+	var err error
+	if sr.Min, sr.MinExclusive, err = parseScoreBound(minArg); err != nil {
+		return nil, err
+	}
+	if sr.Max, sr.MaxExclusive, err = parseScoreBound(maxArg); err != nil {
+		return nil, err
+	}
+
+	withScores := false
+	offset, count := 0, -1
+	for i := 4; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "withscores":
+			withScores = true
+		case "limit":
+			if i+2 >= len(args) {
+				return nil, ErrSyntax
+			}
+			if offset, err = strconv.Atoi(args[i+1]); err != nil {
+				return nil, ErrNotInteger
+			}
+			if count, err = strconv.Atoi(args[i+2]); err != nil {
+				return nil, ErrNotInteger
+			}
+			i += 2
+		default:
+			return nil, ErrSyntax
+		}
+	}
+	// redis returns nothing for a negative offset
+	if offset < 0 {
+		return []string{}, nil
+	}
+
+	members, err := st.ZRangeByScore(args[1], sr, rev, offset, count)
+	if err != nil && !errors.Is(err, storage.ErrKeyDoesntExist) {
+		return nil, err
+	}
+	return formatMembers(members, withScores), nil
+}
+
+// parseScore parses a finite score.
+func parseScore(arg string) (float64, error) {
+	score, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(score) || math.IsInf(score, 0) {
+		return 0, ErrNotFloat
+	}
+	return score, nil
+}
+
+// parseScoreBound parses a bound of a score range, like "(1.5" or "-inf".
+func parseScoreBound(arg string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(arg, "(")
+	if exclusive {
+		arg = arg[1:]
+	}
+	bound, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(bound) {
+		return 0, false, ErrNotFloat
+	}
+	return bound, exclusive, nil
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// formatMembers lists the members, each one followed by its score with withScores.
+func formatMembers(members []storage.ZMember, withScores bool) []string {
+	items := make([]string, 0, len(members)*2)
+	for _, m := range members {
+		items = append(items, m.Member)
+		if withScores {
+			items = append(items, formatScore(m.Score))
+		}
+	}
+	return items
+}
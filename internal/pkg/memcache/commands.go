@@ -0,0 +1,332 @@
+package memcache
+
+import (
+	"errors"
+	"hw1/internal/pkg/storage"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// relativeExptimeLimit is the biggest exptime in seconds which is relative,
+// bigger ones are unix timestamps, like in memcached
+const relativeExptimeLimit = 60 * 60 * 24 * 30
+
+const (
+	errBadFormat  = "CLIENT_ERROR bad command line format"
+	errBadChunk   = "CLIENT_ERROR bad data chunk"
+	errNonNumeric = "CLIENT_ERROR cannot increment or decrement non-numeric value"
+	errBadDelta   = "CLIENT_ERROR invalid numeric delta argument"
+)
+
+type handler func(r *Server, c *conn, args []string) error
+
+var commands map[string]handler
+
+func init() {
+	commands = map[string]handler{
+		"get":     handleGet,
+		"gets":    handleGet,
+		"set":     handleStore,
+		"add":     handleStore,
+		"replace": handleStore,
+		"cas":     handleStore,
+		"delete":  handleDelete,
+		"incr":    handleIncr,
+		"decr":    handleIncr,
+		"touch":   handleTouch,
+		"version": handleVersion,
+		"quit":    handleQuit,
+	}
+}
+
+// execute runs the command line, the returned error means that the connection is broken.
+func (r *Server) execute(c *conn, line string) error {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		c.writeError("ERROR")
+		return nil
+	}
+
+	handle, ok := commands[args[0]]
+	if !ok {
+		c.writeError("ERROR")
+		return nil
+	}
+
+	c.noreply = len(args) > 1 && args[len(args)-1] == "noreply"
+	if c.noreply {
+		args = args[:len(args)-1]
+	}
+	return handle(r, c, args)
+}
+
+func validKey(key string) bool {
+	if len(key) > maxKeySize {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// expiration converts exptime to milliseconds for the storage, expired is true for a time in the past.
+func expiration(exptime int64) (ms int64, expired bool) {
+	switch {
+	case exptime == 0:
+		return 0, false
+	case exptime < 0:
+		return 0, true
+	case exptime <= relativeExptimeLimit:
+		return exptime * 1000, false
+	}
+
+	ms = exptime*1000 - time.Now().UnixMilli()
+	if ms <= 0 {
+		return 0, true
+	}
+	return ms, false
+}
+
+// handleGet returns the values of the keys: get|gets <key>*.
+func handleGet(r *Server, c *conn, args []string) error {
+	if len(args) < 2 {
+		c.writeError("ERROR")
+		return nil
+	}
+
+	for _, key := range args[1:] {
+		value, version, err := r.storage.GetVersion(key)
+		if err != nil {
+			continue
+		}
+
+		c.writer.WriteString("VALUE " + key + " " + strconv.FormatUint(uint64(r.getFlags(key, version)), 10) +
+			" " + strconv.Itoa(len(value)))
+		if args[0] == "gets" {
+			c.writer.WriteString(" " + strconv.FormatUint(version, 10))
+		}
+		c.writer.WriteString("\r\n" + value + "\r\n")
+	}
+	c.writer.WriteString("END\r\n")
+	return nil
+}
+
+// handleStore stores the data block:
+// set|add|replace <key> <flags> <exptime> <bytes> [noreply] and cas <key> <flags> <exptime> <bytes> <cas unique> [noreply].
+func handleStore(r *Server, c *conn, args []string) error {
+	cas := args[0] == "cas"
+	if (!cas && len(args) != 5) || (cas && len(args) != 6) {
+		c.writeError("ERROR")
+		return nil
+	}
+
+	key := args[1]
+	flags, flagsErr := strconv.ParseUint(args[2], 10, 32)
+	exptime, exptimeErr := strconv.ParseInt(args[3], 10, 64)
+	size, sizeErr := strconv.Atoi(args[4])
+	if !validKey(key) || flagsErr != nil || exptimeErr != nil || sizeErr != nil || size < 0 {
+		c.writeError(errBadFormat)
+		return nil
+	}
+	var unique uint64
+	if cas {
+		var err error
+		if unique, err = strconv.ParseUint(args[5], 10, 64); err != nil {
+			c.writeError(errBadFormat)
+			return nil
+		}
+	}
+
+	if size > maxItemSize {
+		// the data block is skipped, so the connection can be used further
+		if _, err := io.CopyN(io.Discard, c.reader, int64(size)+2); err != nil {
+			return err
+		}
+		c.writeError("SERVER_ERROR object too large for cache")
+		return nil
+	}
+	data, ok, err := c.readData(size)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		c.writeError(errBadChunk)
+		c.quit = true
+		return nil
+	}
+
+	ms, expired := expiration(exptime)
+	version, err := r.store(args[0], key, data, unique, ms)
+	switch {
+	case err == nil:
+		r.setFlags(key, uint32(flags), version)
+		if expired {
+			r.storage.Delete(key)
+			r.forgetFlags(key)
+		}
+		c.reply("STORED")
+	case errors.Is(err, storage.ErrVersionMismatch) && cas:
+		c.reply("EXISTS")
+	case errors.Is(err, storage.ErrKeyDoesntExist) && cas:
+		c.reply("NOT_FOUND")
+	case errors.Is(err, storage.ErrVersionMismatch), errors.Is(err, storage.ErrKeyDoesntExist):
+		c.reply("NOT_STORED")
+	case errors.Is(err, storage.ErrOutOfMemory):
+		c.writeError("SERVER_ERROR out of memory storing object")
+	case errors.Is(err, storage.ErrKeyAlreadyExists):
+		c.writeError("SERVER_ERROR key holds a value of another type")
+	default:
+		c.writeError("SERVER_ERROR " + err.Error())
+	}
+	return nil
+}
+
+// store writes the value with the condition of the command and returns the new version of the key.
+func (r *Server) store(command, key, data string, unique uint64, ms int64) (uint64, error) {
+	switch command {
+	case "add":
+		return r.storage.CompareAndSet(key, data, 0, ms)
+	case "cas":
+		if unique == 0 {
+			// 0 is never a version of an existing key, but means "missing" to CompareAndSet
+			if _, _, err := r.storage.GetVersion(key); err != nil {
+				return 0, err
+			}
+			return 0, storage.ErrVersionMismatch
+		}
+		return r.storage.CompareAndSet(key, data, unique, ms)
+	case "replace":
+		for {
+			_, version, err := r.storage.GetVersion(key)
+			if err != nil {
+				return 0, err
+			}
+			version, err = r.storage.CompareAndSet(key, data, version, ms)
+			if !errors.Is(err, storage.ErrVersionMismatch) && !errors.Is(err, storage.ErrKeyDoesntExist) {
+				return version, err
+			}
+		}
+	default:
+		return r.storage.CompareAndSet(key, data, storage.AnyVersion, ms)
+	}
+}
+
+// handleDelete deletes the key: delete <key> [0] [noreply].
+func handleDelete(r *Server, c *conn, args []string) error {
+	if len(args) == 3 && args[2] == "0" {
+		args = args[:2]
+	}
+	if len(args) != 2 {
+		c.writeError("CLIENT_ERROR bad command line format.  Usage: delete <key> [noreply]")
+		return nil
+	}
+
+	if !r.storage.Delete(args[1]) {
+		c.reply("NOT_FOUND")
+		return nil
+	}
+	r.forgetFlags(args[1])
+	c.reply("DELETED")
+	return nil
+}
+
+// handleIncr changes the 64-bit unsigned value: incr|decr <key> <value> [noreply].
+// incr wraps around on overflow, decr stops at 0.
+func handleIncr(r *Server, c *conn, args []string) error {
+	if len(args) != 3 {
+		c.writeError("ERROR")
+		return nil
+	}
+	key := args[1]
+	delta, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		c.writeError(errBadDelta)
+		return nil
+	}
+
+	for {
+		value, version, err := r.storage.GetVersion(key)
+		if err != nil {
+			c.reply("NOT_FOUND")
+			return nil
+		}
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.writeError(errNonNumeric)
+			return nil
+		}
+
+		switch {
+		case args[0] == "incr":
+			n += delta
+		case n < delta:
+			n = 0
+		default:
+			n -= delta
+		}
+
+		result := strconv.FormatUint(n, 10)
+		newVersion, err := r.storage.CompareAndSet(key, result, version, storage.KeepTTL)
+		if errors.Is(err, storage.ErrVersionMismatch) || errors.Is(err, storage.ErrKeyDoesntExist) {
+			continue
+		}
+		if err != nil {
+			c.writeError("SERVER_ERROR " + err.Error())
+			return nil
+		}
+
+		r.setFlags(key, r.getFlags(key, version), newVersion)
+		c.reply(result)
+		return nil
+	}
+}
+
+// handleTouch changes the expiration time of the key: touch <key> <exptime> [noreply].
+func handleTouch(r *Server, c *conn, args []string) error {
+	if len(args) != 3 {
+		c.writeError("ERROR")
+		return nil
+	}
+	exptime, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		c.writeError("CLIENT_ERROR invalid exptime argument")
+		return nil
+	}
+
+	key := args[1]
+	if _, _, err := r.storage.GetVersion(key); err != nil {
+		c.reply("NOT_FOUND")
+		return nil
+	}
+
+	ms, expired := expiration(exptime)
+	var touched bool
+	if expired {
+		touched = r.storage.Delete(key)
+	} else if touched, err = r.storage.PExpire(key, ms); err != nil {
+		c.writeError("CLIENT_ERROR invalid exptime argument")
+		return nil
+	}
+	if !touched {
+		c.reply("NOT_FOUND")
+		return nil
+	}
+	c.reply("TOUCHED")
+	return nil
+}
+
+func handleVersion(r *Server, c *conn, args []string) error {
+	c.reply("VERSION 1.0.0")
+	return nil
+}
+
+// handleQuit closes the connection without a reply.
+func handleQuit(r *Server, c *conn, args []string) error {
+	c.quit = true
+	return nil
+}
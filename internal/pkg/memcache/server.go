@@ -0,0 +1,255 @@
+package memcache
+
+import (
+	"bufio"
+	"errors"
+	"hw1/internal/pkg/storage"
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+const (
+	maxLineSize = 2048
+	maxKeySize  = 250
+	maxItemSize = 1 << 20 // the default item size limit of memcached
+)
+
+var errLineTooLong = errors.New("line is too long")
+
+// Server serves the storage over the memcached text protocol, so it can replace memcached
+// for the clients which only speak it. Only scalars are visible to it.
+type Server struct {
+	storage  *storage.Storage
+	host     string
+	listener net.Listener
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+
+	// flags are opaque to the storage, so they are kept here for the version of the key they were set with
+	flagsMu sync.Mutex
+	flags   map[string]itemFlags
+}
+
+type itemFlags struct {
+	flags   uint32
+	version uint64
+}
+
+// conn is the state of a client connection.
+type conn struct {
+	net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	noreply bool // the running command asked not to reply
+	quit    bool // the connection is closed after the command
+}
+
+func New(host string, st *storage.Storage) *Server {
+	return &Server{
+		host:    host,
+		storage: st,
+		conns:   make(map[net.Conn]struct{}),
+		flags:   make(map[string]itemFlags),
+	}
+}
+
+// Listen starts listening on the host, Serve accepts the connections.
+func (r *Server) Listen() error {
+	listener, err := net.Listen("tcp", r.host)
+	if err != nil {
+		return err
+	}
+	r.listener = listener
+	return nil
+}
+
+// Addr returns the address the server listens on.
+func (r *Server) Addr() net.Addr {
+	return r.listener.Addr()
+}
+
+// Serve accepts connections until Close is called.
+func (r *Server) Serve() error {
+	for {
+		c, err := r.listener.Accept()
+		if err != nil {
+			r.mu.Lock()
+			closed := r.closed
+			r.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			c.Close()
+			return nil
+		}
+		r.conns[c] = struct{}{}
+		r.wg.Add(1)
+		r.mu.Unlock()
+
+		go r.handle(c)
+	}
+}
+
+func (r *Server) Start() {
+	if err := r.Listen(); err != nil {
+		log.Fatalf("Failed to start memcached server: %v", err)
+	}
+	if err := r.Serve(); err != nil {
+		log.Fatalf("Failed to start memcached server: %v", err)
+	}
+}
+
+// Close stops accepting connections, closes the open ones and waits for their handlers.
+func (r *Server) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	err := r.listener.Close()
+	for c := range r.conns {
+		c.Close()
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	return err
+}
+
+func (r *Server) handle(nc net.Conn) {
+	defer func() {
+		nc.Close()
+		r.mu.Lock()
+		delete(r.conns, nc)
+		r.mu.Unlock()
+		r.wg.Done()
+	}()
+
+	c := &conn{
+		Conn:   nc,
+		reader: bufio.NewReaderSize(nc, maxLineSize),
+		writer: bufio.NewWriter(nc),
+	}
+
+	for !c.quit {
+		line, err := c.readLine()
+		if errors.Is(err, errLineTooLong) {
+			c.writeError("CLIENT_ERROR line is too long")
+			c.writer.Flush()
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("memcached connection %s: %v", nc.RemoteAddr(), err)
+			}
+			return
+		}
+
+		if err := r.execute(c, line); err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("memcached connection %s: %v", nc.RemoteAddr(), err)
+			}
+			return
+		}
+
+		// replies to pipelined commands are sent together
+		if c.reader.Buffered() == 0 {
+			if err := c.writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	c.writer.Flush()
+}
+
+// readLine reads a command line without the trailing CRLF, a single LF is accepted too.
+func (c *conn) readLine() (string, error) {
+	line, err := c.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", errLineTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return string(line), nil
+}
+
+// readData reads the data block of a storage command, ok is false if it isnt terminated by CRLF.
+func (c *conn) readData(n int) (data string, ok bool, err error) {
+	buf := make([]byte, n+2)
+	if _, err := io.ReadFull(c.reader, buf); err != nil {
+		return "", false, err
+	}
+	if buf[n] != '\r' || buf[n+1] != '\n' {
+		return "", false, nil
+	}
+	return string(buf[:n]), true, nil
+}
+
+// reply writes the reply line unless the command has noreply.
+func (c *conn) reply(line string) {
+	if c.noreply {
+		return
+	}
+	c.writer.WriteString(line)
+	c.writer.WriteString("\r\n")
+}
+
+// writeError writes the error line, errors are sent even for noreply commands like in memcached.
+func (c *conn) writeError(line string) {
+	c.writer.WriteString(line)
+	c.writer.WriteString("\r\n")
+}
+
+// getFlags returns the flags set with the given version of the key, 0 if they were set with another one.
+func (r *Server) getFlags(key string, version uint64) uint32 {
+	r.flagsMu.Lock()
+	defer r.flagsMu.Unlock()
+
+	f, ok := r.flags[key]
+	if !ok || f.version != version {
+		// the key was written without flags after them
+		if ok && f.version < version {
+			delete(r.flags, key)
+		}
+		return 0
+	}
+	return f.flags
+}
+
+// setFlags remembers the flags for the version of the key. Versions only grow,
+// so the flags of an older write never replace the ones of a newer write.
+func (r *Server) setFlags(key string, flags uint32, version uint64) {
+	r.flagsMu.Lock()
+	defer r.flagsMu.Unlock()
+
+	if f, ok := r.flags[key]; ok && f.version > version {
+		return
+	}
+	if flags == 0 {
+		delete(r.flags, key)
+		return
+	}
+	r.flags[key] = itemFlags{flags: flags, version: version}
+}
+
+// forgetFlags drops the flags of a deleted key.
+func (r *Server) forgetFlags(key string) {
+	r.flagsMu.Lock()
+	defer r.flagsMu.Unlock()
+
+	delete(r.flags, key)
+}
@@ -0,0 +1,179 @@
+package memcache
+
+import (
+	"bufio"
+	"hw1/internal/pkg/storage"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type client struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newTestServer(t *testing.T) (*Server, *storage.Storage, *client) {
+	store, err := storage.NewStorageWithPersister(time.Minute*20, time.Minute*60, storage.NewMemoryPersister())
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	s := New("127.0.0.1:0", store)
+	if err := s.Listen(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return s, store, &client{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (c *client) send(request string) {
+	if _, err := c.conn.Write([]byte(request)); err != nil {
+		c.t.Fatalf("Failed to send request: %v", err)
+	}
+}
+
+// do sends the request and reads the given number of reply lines.
+func (c *client) do(request string, lines int) string {
+	c.send(request)
+	return c.read(lines)
+}
+
+func (c *client) read(lines int) string {
+	var b strings.Builder
+	for i := 0; i < lines; i++ {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("Failed to read reply: %v", err)
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+func TestStorageCommands(t *testing.T) {
+	_, _, c := newTestServer(t)
+
+	assert.Equal(t, "STORED\r\n", c.do("set key 5 0 10\r\nhello\r\nyou\r\n", 1))
+	assert.Equal(t, "VALUE key 5 10\r\nhello\r\nyou\r\nEND\r\n", c.do("get key missing\r\n", 4))
+
+	assert.Equal(t, "NOT_STORED\r\n", c.do("add key 0 0 1\r\nx\r\n", 1))
+	assert.Equal(t, "STORED\r\n", c.do("add other 0 0 1\r\nx\r\n", 1))
+	assert.Equal(t, "NOT_STORED\r\n", c.do("replace missing 0 0 1\r\nx\r\n", 1))
+	assert.Equal(t, "STORED\r\n", c.do("replace key 7 0 5\r\nworld\r\n", 1))
+	assert.Equal(t, "VALUE key 7 5\r\nworld\r\nVALUE other 0 1\r\nx\r\nEND\r\n", c.do("get key other\r\n", 5))
+
+	assert.Equal(t, "DELETED\r\n", c.do("delete other\r\n", 1))
+	assert.Equal(t, "NOT_FOUND\r\n", c.do("delete other\r\n", 1))
+	assert.Equal(t, "END\r\n", c.do("get other\r\n", 1))
+
+	assert.Equal(t, "CLIENT_ERROR bad data chunk\r\n", c.do("set key 0 0 1\r\nxyz\r\n", 1))
+	_, err := c.reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestCas(t *testing.T) {
+	_, store, c := newTestServer(t)
+
+	assert.Equal(t, "STORED\r\n", c.do("set key 3 0 5\r\nvalue\r\n", 1))
+	reply := c.do("gets key\r\n", 3)
+	fields := strings.Fields(strings.SplitN(reply, "\r\n", 2)[0])
+	assert.Equal(t, []string{"VALUE", "key", "3", "5"}, fields[:4])
+	unique := fields[4]
+
+	assert.Equal(t, "NOT_FOUND\r\n", c.do("cas missing 0 0 1 "+unique+"\r\nx\r\n", 1))
+	assert.Equal(t, "EXISTS\r\n", c.do("cas key 0 0 1 0\r\nx\r\n", 1))
+
+	// a write through another protocol changes the version and drops the flags
+	assert.NoError(t, store.Set("key", "changed"))
+	assert.Equal(t, "EXISTS\r\n", c.do("cas key 0 0 1 "+unique+"\r\nx\r\n", 1))
+	assert.Equal(t, "VALUE key 0 7\r\nchanged\r\nEND\r\n", c.do("get key\r\n", 3))
+
+	_, version, err := store.GetVersion("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "STORED\r\n", c.do("cas key 9 0 1 "+strconv.FormatUint(version, 10)+"\r\nx\r\n", 1))
+	assert.Equal(t, "VALUE key 9 1\r\nx\r\nEND\r\n", c.do("get key\r\n", 3))
+}
+
+func TestIncrDecr(t *testing.T) {
+	_, _, c := newTestServer(t)
+
+	assert.Equal(t, "NOT_FOUND\r\n", c.do("incr counter 1\r\n", 1))
+	assert.Equal(t, "STORED\r\n", c.do("set counter 4 100 2\r\n10\r\n", 1))
+	assert.Equal(t, "15\r\n", c.do("incr counter 5\r\n", 1))
+	assert.Equal(t, "5\r\n", c.do("decr counter 10\r\n", 1))
+	assert.Equal(t, "0\r\n", c.do("decr counter 10\r\n", 1))
+	assert.Equal(t, "18446744073709551615\r\n", c.do("incr counter 18446744073709551615\r\n", 1))
+	assert.Equal(t, "1\r\n", c.do("incr counter 2\r\n", 1))
+	// the flags and the expiration are kept
+	assert.Equal(t, "VALUE counter 4 1\r\n1\r\nEND\r\n", c.do("get counter\r\n", 3))
+
+	assert.Equal(t, "STORED\r\n", c.do("set text 0 0 4\r\ntext\r\n", 1))
+	assert.Equal(t, "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n", c.do("incr text 1\r\n", 1))
+	assert.Equal(t, "CLIENT_ERROR invalid numeric delta argument\r\n", c.do("incr text -1\r\n", 1))
+	assert.Equal(t, "CLIENT_ERROR invalid numeric delta argument\r\n", c.do("incr text 18446744073709551616\r\n", 1))
+}
+
+func TestExpiration(t *testing.T) {
+	_, store, c := newTestServer(t)
+
+	assert.Equal(t, "STORED\r\n", c.do("set key 0 100 5\r\nvalue\r\n", 1))
+	assert.Equal(t, int64(100), store.TTL("key"))
+	assert.Equal(t, "TOUCHED\r\n", c.do("touch key 0\r\n", 1))
+	assert.Equal(t, int64(-1), store.TTL("key"))
+	assert.Equal(t, "NOT_FOUND\r\n", c.do("touch missing 10\r\n", 1))
+
+	// big values are unix timestamps
+	exptime := time.Now().Unix() + 200
+	assert.Equal(t, "TOUCHED\r\n", c.do("touch key "+strconv.FormatInt(exptime, 10)+"\r\n", 1))
+	assert.InDelta(t, 200, store.TTL("key"), 1)
+
+	assert.Equal(t, "STORED\r\n", c.do("set key 0 -1 5\r\nvalue\r\n", 1))
+	assert.Equal(t, "END\r\n", c.do("get key\r\n", 1))
+	assert.Equal(t, "STORED\r\n", c.do("set key 0 0 5\r\nvalue\r\n", 1))
+	assert.Equal(t, "TOUCHED\r\n", c.do("touch key -1\r\n", 1))
+	assert.Equal(t, "END\r\n", c.do("get key\r\n", 1))
+}
+
+func TestNoreplyAndPipeline(t *testing.T) {
+	_, _, c := newTestServer(t)
+
+	c.send("set a 0 0 1 noreply\r\n1\r\nset b 0 0 1 noreply\r\n2\r\nincr a 1 noreply\r\ndelete b noreply\r\nget a b\r\n")
+	assert.Equal(t, "VALUE a 0 1\r\n2\r\nEND\r\n", c.read(3))
+
+	c.send("version\r\nbogus\r\nget\r\nset key x 0 1\r\nversion\r\n")
+	assert.Equal(t, "VERSION 1.0.0\r\nERROR\r\nERROR\r\nCLIENT_ERROR bad command line format\r\n", c.read(4))
+	// the data block of the rejected set is not skipped
+	assert.Equal(t, "VERSION 1.0.0\r\n", c.read(1))
+
+	assert.Equal(t, "SERVER_ERROR object too large for cache\r\n",
+		c.do("set big 0 0 2000000\r\n"+strings.Repeat("x", 2000000)+"\r\n", 1))
+	assert.Equal(t, "END\r\n", c.do("get big\r\n", 1))
+
+	c.send("quit\r\n")
+	_, err := c.reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestOtherTypes(t *testing.T) {
+	_, store, c := newTestServer(t)
+
+	_, err := store.Rpush("list", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "END\r\n", c.do("get list\r\n", 1))
+	assert.Equal(t, "SERVER_ERROR key holds a value of another type\r\n", c.do("set list 0 0 1\r\nx\r\n", 1))
+	assert.Equal(t, "NOT_FOUND\r\n", c.do("touch list 10\r\n", 1))
+}
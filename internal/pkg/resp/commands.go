@@ -0,0 +1,214 @@
+package resp
+
+import (
+	"errors"
+	"hw1/internal/pkg/command"
+	"hw1/internal/pkg/storage"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// connCommand is a command which works with the connection instead of the storage,
+// the storage commands come from the command table.
+type connCommand struct {
+	// arity is the number of arguments including the command name,
+	// a negative one is the minimal number, like in redis
+	arity   int
+	handler func(r *Server, c *conn, args []string)
+}
+
+var connCommands map[string]connCommand
+
+func init() {
+	connCommands = map[string]connCommand{
+		"hello":   {-1, handleHello},
+		"command": {-1, handleCommand},
+		"client":  {-2, handleClient},
+		"select":  {2, handleSelect},
+		"quit":    {1, handleQuit},
+		"multi":   {1, handleMulti},
+		"exec":    {1, handleExec},
+		"discard": {1, handleDiscard},
+		"watch":   {-2, handleWatch},
+		"unwatch": {1, handleUnwatch},
+	}
+}
+
+// txCommands are run at once inside MULTI, the other commands are queued.
+var txCommands = map[string]bool{
+	"multi":   true,
+	"exec":    true,
+	"discard": true,
+	"watch":   true,
+	"unwatch": true,
+	"quit":    true,
+}
+
+const errWrongType = "WRONGTYPE Operation against a key holding the wrong kind of value"
+
+// writeError replies with the redis error matching the storage or the command error.
+func writeError(w *Writer, err error) {
+	switch {
+	case errors.Is(err, storage.ErrKeyAlreadyExists):
+		w.WriteError(errWrongType)
+	case errors.Is(err, storage.ErrKeyDoesntExist):
+		w.WriteError("ERR no such key")
+	case errors.Is(err, storage.ErrIndexOutOfRange):
+		w.WriteError("ERR index out of range")
+	case errors.Is(err, storage.ErrIncorrectArgs):
+		w.WriteError("ERR " + command.ErrSyntax.Error())
+	case errors.Is(err, storage.ErrOutOfMemory):
+		w.WriteError(err.Error())
+	case errors.Is(err, command.ErrExecAborted):
+		w.WriteError("EXECABORT Transaction discarded because of previous errors.")
+	default:
+		w.WriteError("ERR " + err.Error())
+	}
+}
+
+// writeReply renders the reply of a command.
+func writeReply(w *Writer, reply any) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteNull()
+	case command.Status:
+		w.WriteSimple(string(v))
+	case string:
+		w.WriteBulk(v)
+	case int64:
+		w.WriteInt(v)
+	case []string:
+		w.WriteBulks(v)
+	case map[string]string:
+		fields := make([]string, 0, len(v))
+		for field := range v {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		w.WriteMap(len(v))
+		for _, field := range fields {
+			w.WriteBulk(field)
+			w.WriteBulk(v[field])
+		}
+	case error:
+		// a failed command of a transaction
+		writeError(w, v)
+	case []any:
+		w.WriteArray(len(v))
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	default:
+		w.WriteError("ERR unsupported reply")
+	}
+}
+
+// handleHello switches the protocol version: HELLO [protover [AUTH username password] [SETNAME clientname]].
+func handleHello(r *Server, c *conn, args []string) {
+	proto := c.writer.Protocol()
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil {
+			c.writer.WriteError("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if v != 2 && v != 3 {
+			c.writer.WriteError("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = v
+	}
+	c.writer.SetProtocol(proto)
+
+	c.writer.WriteMap(6)
+	c.writer.WriteBulk("server")
+	c.writer.WriteBulk("hw1")
+	c.writer.WriteBulk("version")
+	c.writer.WriteBulk("1.0.0")
+	c.writer.WriteBulk("proto")
+	c.writer.WriteInt(int64(proto))
+	c.writer.WriteBulk("mode")
+	c.writer.WriteBulk("standalone")
+	c.writer.WriteBulk("role")
+	c.writer.WriteBulk("master")
+	c.writer.WriteBulk("modules")
+	c.writer.WriteArray(0)
+}
+
+// handleCommand answers the introspection requests of clients with empty replies.
+func handleCommand(r *Server, c *conn, args []string) {
+	if len(args) > 0 && strings.EqualFold(args[0], "count") {
+		c.writer.WriteInt(int64(len(command.All()) + len(connCommands)))
+		return
+	}
+	if len(args) > 0 && strings.EqualFold(args[0], "docs") {
+		c.writer.WriteMap(0)
+		return
+	}
+	c.writer.WriteArray(0)
+}
+
+// handleClient accepts the settings sent by clients on connection, like CLIENT SETNAME.
+func handleClient(r *Server, c *conn, args []string) {
+	c.writer.WriteOK()
+}
+
+// handleSelect chooses the database of the connection: SELECT index, any database name is accepted too.
+func handleSelect(r *Server, c *conn, args []string) {
+	if _, err := r.storage.DB(args[0]); err != nil {
+		c.writer.WriteError("ERR DB index is out of range")
+		return
+	}
+	c.db = args[0]
+	c.writer.WriteOK()
+}
+
+func handleQuit(r *Server, c *conn, args []string) {
+	c.writer.WriteOK()
+	c.quit = true
+}
+
+func handleMulti(r *Server, c *conn, args []string) {
+	if err := c.tx.Multi(); err != nil {
+		writeError(c.writer, err)
+		return
+	}
+	c.writer.WriteOK()
+}
+
+func handleExec(r *Server, c *conn, args []string) {
+	replies, err := c.tx.Exec(r.db(c))
+	switch {
+	case errors.Is(err, command.ErrNoMulti):
+		c.writer.WriteError("ERR EXEC without MULTI")
+	case errors.Is(err, command.ErrWatchedChange):
+		c.writer.WriteNullArray()
+	case err != nil:
+		writeError(c.writer, err)
+	default:
+		writeReply(c.writer, replies)
+	}
+}
+
+func handleDiscard(r *Server, c *conn, args []string) {
+	if err := c.tx.Discard(); err != nil {
+		c.writer.WriteError("ERR DISCARD without MULTI")
+		return
+	}
+	c.writer.WriteOK()
+}
+
+func handleWatch(r *Server, c *conn, args []string) {
+	if err := c.tx.Watch(r.db(c), args...); err != nil {
+		writeError(c.writer, err)
+		return
+	}
+	c.writer.WriteOK()
+}
+
+func handleUnwatch(r *Server, c *conn, args []string) {
+	c.tx.Unwatch()
+	c.writer.WriteOK()
+}
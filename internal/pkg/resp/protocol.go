@@ -0,0 +1,212 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxBulkLength  = 512 << 20
+	maxArrayLength = 1 << 20
+	maxInlineSize  = 64 << 10 // also the size of the read buffer
+)
+
+var ErrProtocol = errors.New("Protocol error")
+
+// Reader reads commands sent by clients: arrays of bulk strings
+// or inline commands separated by spaces, like the ones typed in telnet.
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, maxInlineSize)}
+}
+
+// Buffered reports whether there are received bytes which are not read yet,
+// replies of pipelined commands are flushed together.
+func (r *Reader) Buffered() bool {
+	return r.r.Buffered() > 0
+}
+
+// ReadCommand returns the name and the arguments of the next command.
+// An empty slice is returned for an empty inline command.
+func (r *Reader) ReadCommand() ([]string, error) {
+	first, err := r.r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] != '*' {
+		return r.readInline()
+	}
+
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArrayLength {
+		return nil, fmt.Errorf("%w: invalid multibulk length", ErrProtocol)
+	}
+	if n <= 0 {
+		return []string{}, nil
+	}
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		arg, err := r.readBulk()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+func (r *Reader) readBulk() (string, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return "", err
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return "", fmt.Errorf("%w: expected '$'", ErrProtocol)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > maxBulkLength {
+		return "", fmt.Errorf("%w: invalid bulk length", ErrProtocol)
+	}
+
+	buf := make([]byte, n+2)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		return "", err
+	}
+	if buf[n] != '\r' || buf[n+1] != '\n' {
+		return "", fmt.Errorf("%w: bulk string is not terminated by CRLF", ErrProtocol)
+	}
+	return string(buf[:n]), nil
+}
+
+func (r *Reader) readInline() ([]string, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(line), nil
+}
+
+// readLine reads a line without the trailing CRLF, a single LF is accepted too.
+func (r *Reader) readLine() (string, error) {
+	line, err := r.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", fmt.Errorf("%w: too big inline request", ErrProtocol)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return string(line), nil
+}
+
+// Writer writes replies in RESP2 or RESP3, types missing in RESP2 are replaced by the closest ones.
+type Writer struct {
+	w     *bufio.Writer
+	proto int
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w), proto: 2}
+}
+
+func (w *Writer) SetProtocol(proto int) {
+	w.proto = proto
+}
+
+func (w *Writer) Protocol() int {
+	return w.proto
+}
+
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *Writer) WriteSimple(s string) {
+	w.w.WriteByte('+')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+func (w *Writer) WriteOK() {
+	w.WriteSimple("OK")
+}
+
+// WriteError writes the message as an error, it has to start with an error code like ERR.
+func (w *Writer) WriteError(msg string) {
+	w.w.WriteByte('-')
+	w.w.WriteString(msg)
+	w.w.WriteString("\r\n")
+}
+
+func (w *Writer) WriteInt(n int64) {
+	w.w.WriteByte(':')
+	w.w.WriteString(strconv.FormatInt(n, 10))
+	w.w.WriteString("\r\n")
+}
+
+func (w *Writer) WriteBulk(s string) {
+	w.w.WriteByte('$')
+	w.w.WriteString(strconv.Itoa(len(s)))
+	w.w.WriteString("\r\n")
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+// WriteNull writes the null reply, it is the null bulk string in RESP2.
+func (w *Writer) WriteNull() {
+	if w.proto >= 3 {
+		w.w.WriteString("_\r\n")
+		return
+	}
+	w.w.WriteString("$-1\r\n")
+}
+
+// WriteNullArray writes the null reply, it is the null array in RESP2.
+func (w *Writer) WriteNullArray() {
+	if w.proto >= 3 {
+		w.w.WriteString("_\r\n")
+		return
+	}
+	w.w.WriteString("*-1\r\n")
+}
+
+func (w *Writer) WriteArray(n int) {
+	w.w.WriteByte('*')
+	w.w.WriteString(strconv.Itoa(n))
+	w.w.WriteString("\r\n")
+}
+
+// WriteMap starts a map of n pairs, in RESP2 it is an array of 2n elements.
+func (w *Writer) WriteMap(n int) {
+	if w.proto >= 3 {
+		w.w.WriteByte('%')
+		w.w.WriteString(strconv.Itoa(n))
+	} else {
+		w.w.WriteByte('*')
+		w.w.WriteString(strconv.Itoa(2 * n))
+	}
+	w.w.WriteString("\r\n")
+}
+
+func (w *Writer) WriteBulks(items []string) {
+	w.WriteArray(len(items))
+	for _, item := range items {
+		w.WriteBulk(item)
+	}
+}
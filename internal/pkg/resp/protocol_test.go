@@ -0,0 +1,83 @@
+package resp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadCommand(t *testing.T) {
+	r := NewReader(strings.NewReader(
+		"*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$12\r\nhello\r\nworld\r\n" +
+			"PING  inline\r\n" +
+			"\r\n" +
+			"*0\r\n" +
+			"*1\n$4\nPING\r\n"))
+
+	args, err := r.ReadCommand()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"SET", "key", "hello\r\nworld"}, args)
+
+	args, err = r.ReadCommand()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"PING", "inline"}, args)
+
+	args, err = r.ReadCommand()
+	assert.NoError(t, err)
+	assert.Empty(t, args)
+
+	args, err = r.ReadCommand()
+	assert.NoError(t, err)
+	assert.Empty(t, args)
+
+	args, err = r.ReadCommand()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"PING"}, args)
+}
+
+func TestReadCommandErrors(t *testing.T) {
+	cases := []string{
+		"*x\r\n",
+		"*1\r\n:1\r\n",
+		"*1\r\n$-1\r\n",
+		"*1\r\n$3\r\nabcd\r\n",
+		"*1\r\n$" + "999999999999" + "\r\n",
+		strings.Repeat("a", maxInlineSize+1),
+	}
+
+	for _, c := range cases {
+		_, err := NewReader(strings.NewReader(c)).ReadCommand()
+		assert.ErrorIs(t, err, ErrProtocol, "request %q", c)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	write := func(w *Writer) {
+		w.WriteOK()
+		w.WriteError("ERR bad")
+		w.WriteInt(-5)
+		w.WriteBulk("a\r\nb")
+		w.WriteNull()
+		w.WriteNullArray()
+		w.WriteMap(1)
+		w.WriteBulk("field")
+		w.WriteBulks([]string{"x", ""})
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	write(w)
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "+OK\r\n-ERR bad\r\n:-5\r\n$4\r\na\r\nb\r\n$-1\r\n*-1\r\n*2\r\n$5\r\nfield\r\n*2\r\n$1\r\nx\r\n$0\r\n\r\n",
+		buf.String())
+
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetProtocol(3)
+	write(w)
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "+OK\r\n-ERR bad\r\n:-5\r\n$4\r\na\r\nb\r\n_\r\n_\r\n%1\r\n$5\r\nfield\r\n*2\r\n$1\r\nx\r\n$0\r\n\r\n",
+		buf.String())
+}
@@ -0,0 +1,201 @@
+package resp
+
+import (
+	"context"
+	"errors"
+	"hw1/internal/pkg/command"
+	"hw1/internal/pkg/storage"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Server serves the storage over the redis protocol, so redis-cli and redis clients can be used.
+type Server struct {
+	storage  *storage.Storage
+	host     string
+	listener net.Listener
+
+	mu     sync.Mutex
+	conns  map[net.Conn]context.CancelFunc // cancels the blocking commands of the connection
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// conn is the state of a client connection.
+type conn struct {
+	net.Conn
+	ctx    context.Context // done when the server is closed
+	reader *Reader
+	writer *Writer
+	quit   bool // the connection is closed after the reply
+	tx     *command.Transaction
+	db     string // the database chosen by SELECT, empty for the default one
+}
+
+func New(host string, st *storage.Storage) *Server {
+	return &Server{
+		host:    host,
+		storage: st,
+		conns:   make(map[net.Conn]context.CancelFunc),
+	}
+}
+
+// Listen starts listening on the host, Serve accepts the connections.
+func (r *Server) Listen() error {
+	listener, err := net.Listen("tcp", r.host)
+	if err != nil {
+		return err
+	}
+	r.listener = listener
+	return nil
+}
+
+// Addr returns the address the server listens on.
+func (r *Server) Addr() net.Addr {
+	return r.listener.Addr()
+}
+
+// Serve accepts connections until Close is called.
+func (r *Server) Serve() error {
+	for {
+		c, err := r.listener.Accept()
+		if err != nil {
+			r.mu.Lock()
+			closed := r.closed
+			r.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			c.Close()
+			return nil
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		r.conns[c] = cancel
+		r.wg.Add(1)
+		r.mu.Unlock()
+
+		go r.handle(ctx, c)
+	}
+}
+
+func (r *Server) Start() {
+	if err := r.Listen(); err != nil {
+		log.Fatalf("Failed to start RESP server: %v", err)
+	}
+	if err := r.Serve(); err != nil {
+		log.Fatalf("Failed to start RESP server: %v", err)
+	}
+}
+
+// Close stops accepting connections, closes the open ones and waits for their handlers.
+func (r *Server) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	err := r.listener.Close()
+	for c, cancel := range r.conns {
+		cancel()
+		c.Close()
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	return err
+}
+
+func (r *Server) handle(ctx context.Context, nc net.Conn) {
+	defer func() {
+		nc.Close()
+		r.mu.Lock()
+		r.conns[nc]()
+		delete(r.conns, nc)
+		r.mu.Unlock()
+		r.wg.Done()
+	}()
+
+	c := &conn{
+		Conn:   nc,
+		ctx:    ctx,
+		reader: NewReader(nc),
+		writer: NewWriter(nc),
+		tx:     command.NewTransaction(),
+	}
+
+	for !c.quit {
+		args, err := c.reader.ReadCommand()
+		if errors.Is(err, ErrProtocol) {
+			c.writer.WriteError("ERR " + err.Error())
+			c.writer.Flush()
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("RESP connection %s: %v", nc.RemoteAddr(), err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		r.execute(c, args)
+
+		// replies to pipelined commands are sent together
+		if !c.reader.Buffered() {
+			if err := c.writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	c.writer.Flush()
+}
+
+// db returns the storage of the database selected by the connection.
+// SELECT creates the database and databases are never removed, so it exists.
+func (r *Server) db(c *conn) *storage.Storage {
+	if c.db == "" {
+		return r.storage
+	}
+	db, err := r.storage.DB(c.db)
+	if err != nil {
+		return r.storage
+	}
+	return db
+}
+
+func (r *Server) execute(c *conn, args []string) {
+	name := strings.ToLower(args[0])
+	if c.tx.Active() && !txCommands[name] {
+		if err := c.tx.Queue(args); err != nil {
+			writeError(c.writer, err)
+			return
+		}
+		c.writer.WriteSimple("QUEUED")
+		return
+	}
+
+	cmd, ok := connCommands[name]
+	if !ok {
+		reply, err := command.ExecuteContext(c.ctx, r.db(c), args)
+		if err != nil {
+			writeError(c.writer, err)
+			return
+		}
+		writeReply(c.writer, reply)
+		return
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.writer.WriteError("ERR wrong number of arguments for '" + name + "' command")
+		return
+	}
+
+	cmd.handler(r, c, args[1:])
+}
@@ -0,0 +1,631 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hw1/internal/pkg/storage"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type client struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newTestServer(t *testing.T) (*Server, *client) {
+	store, err := storage.NewStorageWithPersister(time.Minute*20, time.Minute*60, storage.NewMemoryPersister())
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	s := New("127.0.0.1:0", store)
+	if err := s.Listen(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+
+	return s, dial(t, s)
+}
+
+func dial(t *testing.T, s *Server) *client {
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &client{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// do sends the command and returns the reply: string, int64, nil, error, []any or map[string]any.
+func (c *client) do(args ...string) any {
+	c.send(args...)
+	return c.read()
+}
+
+// send sends the command without waiting for the reply.
+func (c *client) send(args ...string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		c.t.Fatalf("Failed to send command: %v", err)
+	}
+}
+
+func (c *client) read() any {
+	reply, err := readReply(c.reader)
+	if err != nil {
+		c.t.Fatalf("Failed to read reply: %v", err)
+	}
+	return reply
+}
+
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return errors.New(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '_':
+		return nil, nil
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case '%':
+		n, _ := strconv.Atoi(line[1:])
+		items := make(map[string]any, n)
+		for i := 0; i < n; i++ {
+			key, err := readReply(r)
+			if err != nil {
+				return nil, err
+			}
+			if items[key.(string)], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unknown reply %q", line)
+}
+
+func TestConnection(t *testing.T) {
+	_, c := newTestServer(t)
+
+	assert.Equal(t, "PONG", c.do("PING"))
+	assert.Equal(t, "hello", c.do("ping", "hello"))
+	assert.Equal(t, "hello", c.do("ECHO", "hello"))
+	assert.Equal(t, errors.New("ERR unknown command 'NOPE'"), c.do("NOPE"))
+	assert.Equal(t, errors.New("ERR wrong number of arguments for 'get' command"), c.do("GET"))
+	assert.Equal(t, "OK", c.do("SELECT", "0"))
+	assert.Equal(t, "OK", c.do("CLIENT", "SETNAME", "test"))
+
+	// inline commands work too
+	_, err := c.conn.Write([]byte("PING\r\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "PONG", c.read())
+
+	assert.Equal(t, "OK", c.do("QUIT"))
+	_, err = c.reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestHello(t *testing.T) {
+	_, c := newTestServer(t)
+
+	reply := c.do("HELLO")
+	assert.Len(t, reply, 12)
+	assert.Equal(t, nil, c.do("GET", "missing"))
+
+	reply = c.do("HELLO", "3")
+	assert.Equal(t, int64(3), reply.(map[string]any)["proto"])
+	assert.Equal(t, map[string]any{}, c.do("HGETALL", "missing"))
+	assert.Equal(t, nil, c.do("GET", "missing"))
+
+	assert.Equal(t, errors.New("NOPROTO unsupported protocol version"), c.do("HELLO", "4"))
+}
+
+func TestPipeline(t *testing.T) {
+	_, c := newTestServer(t)
+
+	var b strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&b, "*2\r\n$5\r\nRPUSH\r\n$4\r\nlist\r\n")
+		b.WriteString("*3\r\n$5\r\nRPUSH\r\n$4\r\nlist\r\n$" + strconv.Itoa(len(strconv.Itoa(i))) + "\r\n" + strconv.Itoa(i) + "\r\n")
+	}
+	_, err := c.conn.Write([]byte(b.String()))
+	assert.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, errors.New("ERR wrong number of arguments for 'rpush' command"), c.read())
+		assert.Equal(t, int64(i+1), c.read())
+	}
+}
+
+func TestProtocolError(t *testing.T) {
+	_, c := newTestServer(t)
+
+	_, err := c.conn.Write([]byte("*1\r\n:1\r\n"))
+	assert.NoError(t, err)
+	reply := c.read()
+	assert.ErrorContains(t, reply.(error), "ERR Protocol error")
+	_, err = c.reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestScalarCommands(t *testing.T) {
+	_, c := newTestServer(t)
+
+	assert.Equal(t, "OK", c.do("SET", "key", "value"))
+	assert.Equal(t, "value", c.do("GET", "key"))
+	assert.Equal(t, int64(-1), c.do("TTL", "key"))
+	assert.Equal(t, int64(-2), c.do("TTL", "missing"))
+
+	assert.Equal(t, "OK", c.do("SET", "key", "42", "EX", "100"))
+	assert.Equal(t, "42", c.do("GET", "key"))
+	assert.Equal(t, int64(100), c.do("TTL", "key"))
+	assert.Equal(t, int64(1), c.do("PERSIST", "key"))
+	assert.Equal(t, int64(0), c.do("PERSIST", "key"))
+	assert.Equal(t, int64(1), c.do("EXPIRE", "key", "50"))
+	assert.Equal(t, int64(50), c.do("TTL", "key"))
+	assert.Equal(t, int64(1), c.do("PEXPIRE", "key", "50000"))
+	assert.InDelta(t, 50000, c.do("PTTL", "key"), 100)
+	assert.Equal(t, int64(0), c.do("EXPIRE", "missing", "50"))
+
+	assert.Equal(t, "OK", c.do("SET", "px", "value", "px", "1"))
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, nil, c.do("GET", "px"))
+
+	// a non positive expiration deletes the key
+	assert.Equal(t, int64(1), c.do("EXPIRE", "key", "0"))
+	assert.Equal(t, nil, c.do("GET", "key"))
+
+	assert.Equal(t, errors.New("ERR syntax error"), c.do("SET", "key", "value", "EX"))
+	assert.Equal(t, errors.New("ERR syntax error"), c.do("SET", "key", "value", "EX", "1", "PX", "1"))
+	assert.Equal(t, errors.New("ERR syntax error"), c.do("SET", "key", "value", "NX"))
+	assert.Equal(t, errors.New("ERR value is not an integer or out of range"), c.do("SET", "key", "value", "EX", "x"))
+	assert.Equal(t, errors.New("ERR invalid expire time in 'set' command"), c.do("SET", "key", "value", "EX", "0"))
+}
+
+func TestSetType(t *testing.T) {
+	_, c := newTestServer(t)
+
+	assert.Equal(t, "OK", c.do("SET", "key", "007"))
+	assert.Equal(t, "007", c.do("GET", "key"))
+	assert.Equal(t, "OK", c.do("SET", "key", "007", "TYPE", "int", "EX", "100"))
+	assert.Equal(t, "7", c.do("GET", "key"))
+	assert.Equal(t, "OK", c.do("SET", "key", "1", "type", "string"))
+	assert.Equal(t, errors.New("ERR value is not an integer or out of range"), c.do("INCR", "key"))
+	assert.Equal(t, errors.New("ERR value is not an integer or out of range"), c.do("SET", "key", "x", "TYPE", "int"))
+	assert.Equal(t, errors.New("ERR syntax error"), c.do("SET", "key", "x", "TYPE", "list"))
+	assert.Equal(t, errors.New("ERR syntax error"), c.do("SET", "key", "x", "TYPE", "int", "TYPE", "int"))
+}
+
+func TestIncrCommands(t *testing.T) {
+	_, c := newTestServer(t)
+
+	assert.Equal(t, int64(1), c.do("INCR", "counter"))
+	assert.Equal(t, int64(11), c.do("INCRBY", "counter", "10"))
+	assert.Equal(t, int64(10), c.do("DECR", "counter"))
+	assert.Equal(t, int64(-5), c.do("DECRBY", "counter", "15"))
+	assert.Equal(t, "-5", c.do("GET", "counter"))
+
+	assert.Equal(t, "OK", c.do("SET", "key", "value"))
+	assert.Equal(t, errors.New("ERR value is not an integer or out of range"), c.do("INCR", "key"))
+	assert.Equal(t, errors.New("ERR value is not an integer or out of range"), c.do("INCRBY", "counter", "x"))
+	assert.Equal(t, "OK", c.do("SET", "key", "-9223372036854775808"))
+	assert.Equal(t, errors.New("ERR increment or decrement would overflow"), c.do("DECR", "key"))
+	assert.Equal(t, errors.New("ERR increment or decrement would overflow"), c.do("DECRBY", "counter", "-9223372036854775808"))
+}
+
+func TestFloatCommands(t *testing.T) {
+	_, c := newTestServer(t)
+
+	assert.Equal(t, "10.5", c.do("INCRBYFLOAT", "f", "10.5"))
+	assert.Equal(t, "5", c.do("INCRBYFLOAT", "f", "-5.5"))
+	assert.Equal(t, "OK", c.do("SET", "f", "1.5", "TYPE", "float"))
+	assert.Equal(t, "1.75", c.do("INCRBYFLOAT", "f", "0.25"))
+	assert.Equal(t, errors.New("ERR value is not a valid float"), c.do("INCRBYFLOAT", "f", "x"))
+	assert.Equal(t, errors.New("ERR value is not a valid float"), c.do("SET", "f", "x", "TYPE", "float"))
+
+	assert.Equal(t, "OK", c.do("SET", "b", "\x00\xff", "TYPE", "binary"))
+	assert.Equal(t, "\x00\xff", c.do("GET", "b"))
+	assert.Equal(t, errors.New("ERR value is not a valid float"), c.do("INCRBYFLOAT", "b", "1"))
+}
+
+func TestStringCommands(t *testing.T) {
+	_, c := newTestServer(t)
+
+	assert.Equal(t, int64(5), c.do("APPEND", "key", "Hello"))
+	assert.Equal(t, int64(11), c.do("APPEND", "key", " World"))
+	assert.Equal(t, int64(11), c.do("STRLEN", "key"))
+	assert.Equal(t, int64(0), c.do("STRLEN", "missing"))
+	assert.Equal(t, "World", c.do("GETRANGE", "key", "-5", "-1"))
+	assert.Equal(t, "", c.do("GETRANGE", "missing", "0", "-1"))
+	assert.Equal(t, int64(11), c.do("SETRANGE", "key", "6", "Redis"))
+	assert.Equal(t, "Hello Redis", c.do("GETSET", "key", "0"))
+	assert.Equal(t, nil, c.do("GETSET", "other", "1"))
+	assert.Equal(t, int64(2), c.do("APPEND", "key", "7"))
+	assert.Equal(t, "07", c.do("GETDEL", "key"))
+	assert.Equal(t, nil, c.do("GETDEL", "key"))
+	assert.Equal(t, errors.New("ERR value is not an integer or out of range"), c.do("SETRANGE", "key", "x", "1"))
+}
+
+func TestKeysCommands(t *testing.T) {
+	_, c := newTestServer(t)
+
+	for _, key := range []string{"user:1", "user:2", "order:1"} {
+		assert.Equal(t, "OK", c.do("SET", key, "value"))
+	}
+	assert.Equal(t, []any{"user:1", "user:2"}, c.do("KEYS", "user:*"))
+
+	keys := make([]any, 0)
+	cursor := "0"
+	for {
+		reply := c.do("SCAN", cursor, "MATCH", "*:1", "COUNT", "1").([]any)
+		cursor = reply[0].(string)
+		keys = append(keys, reply[1].([]any)...)
+		if cursor == "0" {
+			break
+		}
+	}
+	assert.ElementsMatch(t, []any{"user:1", "order:1"}, keys)
+	assert.Equal(t, errors.New("ERR invalid cursor"), c.do("SCAN", "x"))
+}
+
+func TestKeyspaceCommands(t *testing.T) {
+	_, c := newTestServer(t)
+
+	assert.Equal(t, "OK", c.do("MSET", "a", "1", "b", "2"))
+	assert.Equal(t, errors.New("ERR wrong number of arguments for 'mset' command"), c.do("MSET", "a", "1", "b"))
+	assert.Equal(t, int64(1), c.do("RPUSH", "list", "1"))
+	assert.Equal(t, []any{"1", "2", nil, nil}, c.do("MGET", "a", "b", "c", "list"))
+
+	assert.Equal(t, "string", c.do("TYPE", "a"))
+	assert.Equal(t, "list", c.do("TYPE", "list"))
+	assert.Equal(t, "none", c.do("TYPE", "c"))
+	assert.Equal(t, int64(3), c.do("EXISTS", "a", "a", "list", "c"))
+
+	assert.Equal(t, int64(1), c.do("EXPIRE", "a", "100"))
+	assert.Equal(t, "OK", c.do("RENAME", "a", "c"))
+	assert.Equal(t, int64(100), c.do("TTL", "c"))
+	assert.Equal(t, errors.New("ERR no such key"), c.do("RENAME", "a", "c"))
+
+	assert.Equal(t, int64(0), c.do("COPY", "list", "b"))
+	assert.Equal(t, int64(1), c.do("COPY", "list", "b", "REPLACE"))
+	assert.Equal(t, "list", c.do("TYPE", "b"))
+	assert.Equal(t, errors.New("ERR syntax error"), c.do("COPY", "list", "b", "NOSUCH"))
+
+	assert.Equal(t, int64(3), c.do("DEL", "b", "c", "list", "missing"))
+	assert.Equal(t, int64(0), c.do("EXISTS", "b", "c", "list"))
+}
+
+func TestSelect(t *testing.T) {
+	s, c := newTestServer(t)
+	other := dial(t, s)
+
+	assert.Equal(t, "OK", c.do("SET", "key", "default"))
+	assert.Equal(t, "OK", c.do("SELECT", "1"))
+	assert.Nil(t, c.do("GET", "key"))
+	assert.Equal(t, "OK", c.do("SET", "key", "first"))
+	assert.Equal(t, int64(1), c.do("DBSIZE"))
+
+	// the database is chosen per connection
+	assert.Equal(t, "default", other.do("GET", "key"))
+	assert.Equal(t, "OK", other.do("SELECT", "tenant"))
+	assert.Nil(t, other.do("GET", "key"))
+	assert.Equal(t, errors.New("ERR DB index is out of range"), other.do("SELECT", "no space"))
+
+	assert.Equal(t, "OK", other.do("SWAPDB", "0", "1"))
+	assert.Equal(t, "default", c.do("GET", "key"))
+	assert.Equal(t, "OK", c.do("FLUSHDB"))
+	assert.Equal(t, int64(0), c.do("DBSIZE"))
+	assert.Equal(t, errors.New("ERR syntax error"), c.do("FLUSHDB", "NOW"))
+
+	assert.Equal(t, "OK", c.do("SELECT", "0"))
+	assert.Equal(t, "first", c.do("GET", "key"))
+
+	// transactions run in the selected database
+	assert.Equal(t, "OK", c.do("SELECT", "1"))
+	assert.Equal(t, "OK", c.do("MULTI"))
+	assert.Equal(t, "QUEUED", c.do("SET", "tx", "value"))
+	assert.Equal(t, "QUEUED", c.do("SWAPDB", "0", "1"))
+	replies := c.do("EXEC").([]any)
+	assert.Equal(t, "OK", replies[0])
+	assert.Equal(t, errors.New("ERR SWAPDB is not allowed in transactions"), replies[1])
+	assert.Equal(t, int64(1), c.do("EXISTS", "tx"))
+	assert.Equal(t, int64(0), other.do("EXISTS", "tx"))
+}
+
+func TestHashCommands(t *testing.T) {
+	_, c := newTestServer(t)
+
+	assert.Equal(t, int64(2), c.do("HSET", "hash", "a", "1", "b", "2"))
+	assert.Equal(t, int64(0), c.do("HSET", "hash", "a", "one"))
+	assert.Equal(t, "one", c.do("HGET", "hash", "a"))
+	assert.Equal(t, nil, c.do("HGET", "hash", "missing"))
+	assert.Equal(t, nil, c.do("HGET", "missing", "a"))
+	assert.Equal(t, int64(2), c.do("HLEN", "hash"))
+	assert.ElementsMatch(t, []any{"a", "one", "b", "2"}, c.do("HGETALL", "hash"))
+	assert.Equal(t, int64(1), c.do("HDEL", "hash", "a", "missing"))
+	assert.Equal(t, int64(0), c.do("HDEL", "missing", "a"))
+	assert.Equal(t, int64(0), c.do("HLEN", "missing"))
+	assert.Equal(t, errors.New("ERR wrong number of arguments for 'hset' command"), c.do("HSET", "hash", "a", "1", "b"))
+
+	assert.Equal(t, errors.New(errWrongType), c.do("GET", "hash"))
+	assert.Equal(t, errors.New(errWrongType), c.do("RPUSH", "hash", "1"))
+}
+
+func TestSetCommands(t *testing.T) {
+	_, c := newTestServer(t)
+
+	assert.Equal(t, int64(3), c.do("SADD", "s", "a", "b", "1"))
+	assert.Equal(t, int64(0), c.do("SADD", "s", "a"))
+	assert.Equal(t, int64(1), c.do("SISMEMBER", "s", "1"))
+	assert.Equal(t, int64(0), c.do("SISMEMBER", "missing", "1"))
+	assert.Equal(t, []any{"1", "a", "b"}, c.do("SMEMBERS", "s"))
+	assert.Equal(t, int64(3), c.do("SCARD", "s"))
+	assert.Equal(t, int64(2), c.do("SADD", "t", "b", "c"))
+	assert.Equal(t, []any{"b"}, c.do("SINTER", "s", "t"))
+	assert.Equal(t, []any{"1", "a", "b", "c"}, c.do("SUNION", "s", "t"))
+	assert.Equal(t, []any{"1", "a"}, c.do("SDIFF", "s", "t", "missing"))
+	assert.Equal(t, int64(1), c.do("SINTERSTORE", "i", "s", "t"))
+	assert.Equal(t, "set", c.do("TYPE", "i"))
+	assert.Equal(t, "b", c.do("SPOP", "i"))
+	assert.Equal(t, nil, c.do("SPOP", "i"))
+	assert.Equal(t, []any{}, c.do("SPOP", "i", "2"))
+	assert.Equal(t, int64(1), c.do("SREM", "t", "c", "missing"))
+	assert.Equal(t, []any{"b"}, c.do("SRANDMEMBER", "t", "5"))
+	assert.Equal(t, []any{"b", "b"}, c.do("SRANDMEMBER", "t", "-2"))
+
+	assert.Equal(t, errors.New(errWrongType), c.do("GET", "s"))
+	assert.Equal(t, "OK", c.do("SET", "str", "v"))
+	assert.Equal(t, errors.New(errWrongType), c.do("SADD", "str", "1"))
+	assert.Equal(t, errors.New(errWrongType), c.do("SUNION", "s", "str"))
+}
+
+func TestSortedSetCommands(t *testing.T) {
+	_, c := newTestServer(t)
+
+	assert.Equal(t, int64(3), c.do("ZADD", "z", "1", "a", "2", "b", "3", "c"))
+	assert.Equal(t, int64(1), c.do("ZADD", "z", "NX", "CH", "10", "a", "4", "d"))
+	assert.Equal(t, "2.5", c.do("ZINCRBY", "z", "0.5", "b"))
+	assert.Equal(t, "3", c.do("ZSCORE", "z", "c"))
+	assert.Equal(t, nil, c.do("ZSCORE", "z", "missing"))
+	assert.Equal(t, int64(4), c.do("ZCARD", "z"))
+	assert.Equal(t, int64(1), c.do("ZRANK", "z", "b"))
+	assert.Equal(t, int64(0), c.do("ZREVRANK", "z", "d"))
+	assert.Equal(t, nil, c.do("ZRANK", "z", "missing"))
+	assert.Equal(t, []any{"a", "1", "b", "2.5"}, c.do("ZRANGE", "z", "0", "1", "WITHSCORES"))
+	assert.Equal(t, []any{"d", "c"}, c.do("ZREVRANGE", "z", "0", "1"))
+	assert.Equal(t, []any{"b", "c"}, c.do("ZRANGEBYSCORE", "z", "(1", "3"))
+	assert.Equal(t, []any{"c"}, c.do("ZREVRANGEBYSCORE", "z", "+inf", "-inf", "LIMIT", "1", "1"))
+	assert.Equal(t, int64(2), c.do("ZREM", "z", "a", "b", "missing"))
+	assert.Equal(t, []any{}, c.do("ZRANGE", "missing", "0", "-1"))
+	assert.Equal(t, "zset", c.do("TYPE", "z"))
+
+	assert.Equal(t, errors.New("ERR syntax error"), c.do("ZADD", "z", "GT", "LT", "1", "a"))
+	assert.Equal(t, errors.New("ERR value is not a valid float"), c.do("ZADD", "z", "x", "a"))
+	assert.Equal(t, errors.New(errWrongType), c.do("GET", "z"))
+	assert.Equal(t, "OK", c.do("SET", "s", "v"))
+	assert.Equal(t, errors.New(errWrongType), c.do("ZADD", "s", "1", "a"))
+	assert.Equal(t, errors.New(errWrongType), c.do("ZRANGE", "s", "0", "-1"))
+}
+
+func TestListCommands(t *testing.T) {
+	_, c := newTestServer(t)
+
+	assert.Equal(t, int64(3), c.do("RPUSH", "list", "1", "2", "3"))
+	assert.Equal(t, int64(5), c.do("LPUSH", "list", "0", "-1"))
+	// -1 0 1 2 3
+	assert.Equal(t, "-1", c.do("LINDEX", "list", "0"))
+	assert.Equal(t, "3", c.do("LINDEX", "list", "4"))
+	assert.Equal(t, nil, c.do("LINDEX", "list", "5"))
+	assert.Equal(t, nil, c.do("LINDEX", "missing", "0"))
+
+	assert.Equal(t, "OK", c.do("LSET", "list", "0", "10"))
+	assert.Equal(t, errors.New("ERR index out of range"), c.do("LSET", "list", "10", "10"))
+	assert.Equal(t, errors.New("ERR no such key"), c.do("LSET", "missing", "0", "10"))
+
+	assert.Equal(t, "10", c.do("LPOP", "list"))
+	assert.Equal(t, "3", c.do("RPOP", "list"))
+	assert.Equal(t, []any{"0", "1"}, c.do("LPOP", "list", "2"))
+	assert.Equal(t, []any{"2"}, c.do("RPOP", "list", "5"))
+	assert.Equal(t, nil, c.do("LPOP", "list"))
+	assert.Equal(t, nil, c.do("RPOP", "list", "2"))
+	assert.Equal(t, nil, c.do("LPOP", "missing"))
+	assert.Equal(t, int64(1), c.do("SADD", "set", "a"))
+	assert.Equal(t, errors.New(errWrongType), c.do("LPOP", "set"))
+	assert.Equal(t, errors.New(errWrongType), c.do("RPOP", "set", "2"))
+	assert.Equal(t, errors.New(errWrongType), c.do("LINDEX", "set", "0"))
+
+	// the elements are strings of any kind
+	assert.Equal(t, int64(2), c.do("RPUSH", "list", "job:1", `{"id":2}`))
+	assert.Equal(t, `{"id":2}`, c.do("LINDEX", "list", "1"))
+	assert.Equal(t, "OK", c.do("LSET", "list", "0", "job:3"))
+	assert.Equal(t, []any{"job:3", `{"id":2}`}, c.do("LPOP", "list", "5"))
+
+	assert.Equal(t, errors.New("ERR value is not an integer or out of range"), c.do("LSET", "list", "x", "1"))
+	assert.Equal(t, errors.New("ERR value is out of range, must be positive"), c.do("LPOP", "list", "-1"))
+	assert.Equal(t, "OK", c.do("SET", "key", "value"))
+	assert.Equal(t, errors.New(errWrongType), c.do("LPUSH", "key", "1"))
+	assert.Equal(t, errors.New(errWrongType), c.do("LINDEX", "key", "0"))
+	assert.Equal(t, errors.New(errWrongType), c.do("LRANGE", "key", "0", "-1"))
+}
+
+func TestListEditingCommands(t *testing.T) {
+	_, c := newTestServer(t)
+
+	assert.Equal(t, int64(5), c.do("RPUSH", "queue", "a", "b", "c", "b", "d"))
+	assert.Equal(t, int64(5), c.do("LLEN", "queue"))
+	assert.Equal(t, []any{"c", "b", "d"}, c.do("LRANGE", "queue", "-3", "100"))
+	assert.Equal(t, "d", c.do("LINDEX", "queue", "-1"))
+	assert.Equal(t, "OK", c.do("LSET", "queue", "-1", "e"))
+	assert.Equal(t, int64(6), c.do("LINSERT", "queue", "BEFORE", "c", "x"))
+	assert.Equal(t, int64(-1), c.do("LINSERT", "queue", "BEFORE", "z", "x"))
+	assert.Equal(t, int64(1), c.do("LPOS", "queue", "b"))
+	assert.Equal(t, []any{int64(4), int64(1)}, c.do("LPOS", "queue", "b", "RANK", "-1", "COUNT", "2"))
+	assert.Equal(t, nil, c.do("LPOS", "queue", "b", "MAXLEN", "1"))
+	assert.Equal(t, int64(2), c.do("LREM", "queue", "-5", "b"))
+	assert.Equal(t, "OK", c.do("LTRIM", "queue", "1", "-1"))
+	assert.Equal(t, []any{"x", "c", "e"}, c.do("LRANGE", "queue", "0", "-1"))
+	assert.Equal(t, "e", c.do("LMOVE", "queue", "done", "RIGHT", "LEFT"))
+	assert.Equal(t, []any{"e"}, c.do("LRANGE", "done", "0", "-1"))
+	assert.Equal(t, nil, c.do("LMOVE", "missing", "done", "LEFT", "LEFT"))
+
+	assert.Equal(t, "OK", c.do("SET", "key", "value"))
+	assert.Equal(t, errors.New(errWrongType), c.do("LMOVE", "queue", "key", "LEFT", "LEFT"))
+	assert.Equal(t, errors.New("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list"),
+		c.do("LPOS", "queue", "x", "RANK", "0"))
+}
+
+func TestBlockingCommands(t *testing.T) {
+	s, c := newTestServer(t)
+	c2 := dial(t, s)
+
+	assert.Equal(t, int64(2), c.do("RPUSH", "queue", "a", "b"))
+	assert.Equal(t, []any{"queue", "a"}, c.do("BLPOP", "missing", "queue", "0"))
+	assert.Equal(t, "b", c.do("BLMOVE", "queue", "done", "LEFT", "RIGHT", "0"))
+	assert.Equal(t, nil, c.do("BRPOP", "queue", "0.01"))
+
+	// the client waits for the push of another one
+	c.send("BRPOP", "jobs", "5")
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, int64(1), c2.do("LPUSH", "jobs", "job"))
+	assert.Equal(t, []any{"jobs", "job"}, c.read())
+
+	// a transaction does not wait
+	assert.Equal(t, "OK", c.do("MULTI"))
+	assert.Equal(t, "QUEUED", c.do("BLPOP", "jobs", "0"))
+	assert.Equal(t, []any{nil}, c.do("EXEC"))
+
+	assert.Equal(t, errors.New("ERR timeout is negative"), c.do("BLPOP", "jobs", "-1"))
+	assert.Equal(t, errors.New("ERR timeout is not a float or out of range"), c.do("BLMOVE", "jobs", "done", "LEFT", "LEFT", "x"))
+
+	// closing the server stops the waiting clients
+	c2.send("BLPOP", "jobs", "0")
+	time.Sleep(10 * time.Millisecond)
+	closed := make(chan error, 1)
+	go func() { closed <- s.Close() }()
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the server waits for the blocked client")
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	_, c := newTestServer(t)
+
+	assert.Equal(t, errors.New("ERR EXEC without MULTI"), c.do("EXEC"))
+	assert.Equal(t, "OK", c.do("MULTI"))
+	assert.Equal(t, errors.New("ERR MULTI calls can not be nested"), c.do("MULTI"))
+	assert.Equal(t, "QUEUED", c.do("SET", "key", "value"))
+	assert.Equal(t, "QUEUED", c.do("LPUSH", "key", "1"))
+	assert.Equal(t, "QUEUED", c.do("GET", "key"))
+	assert.Equal(t, []any{"OK", errors.New(errWrongType), "value"}, c.do("EXEC"))
+
+	// a rejected command discards the transaction
+	assert.Equal(t, "OK", c.do("MULTI"))
+	assert.Equal(t, "QUEUED", c.do("SET", "key", "other"))
+	assert.Equal(t, errors.New("ERR wrong number of arguments for 'get' command"), c.do("GET"))
+	assert.Equal(t, errors.New("EXECABORT Transaction discarded because of previous errors."), c.do("EXEC"))
+	assert.Equal(t, "value", c.do("GET", "key"))
+
+	assert.Equal(t, "OK", c.do("MULTI"))
+	assert.Equal(t, "QUEUED", c.do("SET", "key", "other"))
+	assert.Equal(t, "OK", c.do("DISCARD"))
+	assert.Equal(t, errors.New("ERR DISCARD without MULTI"), c.do("DISCARD"))
+	assert.Equal(t, "value", c.do("GET", "key"))
+}
+
+func TestWatch(t *testing.T) {
+	s, c := newTestServer(t)
+	other := dial(t, s)
+
+	assert.Equal(t, "OK", c.do("WATCH", "key", "missing"))
+	assert.Equal(t, "OK", c.do("MULTI"))
+	assert.Equal(t, errors.New("ERR WATCH inside MULTI is not allowed"), c.do("WATCH", "key"))
+	assert.Equal(t, "QUEUED", c.do("SET", "key", "mine"))
+	assert.Equal(t, []any{"OK"}, c.do("EXEC"))
+
+	// EXEC forgets the watched keys
+	assert.Equal(t, "OK", other.do("SET", "key", "theirs"))
+	assert.Equal(t, "OK", c.do("MULTI"))
+	assert.Equal(t, "QUEUED", c.do("GET", "key"))
+	assert.Equal(t, []any{"theirs"}, c.do("EXEC"))
+
+	assert.Equal(t, "OK", c.do("WATCH", "key"))
+	assert.Equal(t, "OK", other.do("SET", "key", "changed"))
+	assert.Equal(t, "OK", c.do("MULTI"))
+	assert.Equal(t, "QUEUED", c.do("SET", "key", "mine"))
+	assert.Equal(t, nil, c.do("EXEC"))
+	assert.Equal(t, "changed", c.do("GET", "key"))
+
+	// a key created and deleted again is changed too
+	assert.Equal(t, "OK", c.do("WATCH", "missing"))
+	assert.Equal(t, "OK", other.do("SET", "missing", "value"))
+	assert.Equal(t, int64(1), other.do("EXPIRE", "missing", "0"))
+	assert.Equal(t, "OK", c.do("MULTI"))
+	assert.Equal(t, "QUEUED", c.do("SET", "missing", "mine"))
+	assert.Equal(t, nil, c.do("EXEC"))
+
+	assert.Equal(t, "OK", c.do("WATCH", "key"))
+	assert.Equal(t, "OK", other.do("SET", "key", "changed again"))
+	assert.Equal(t, "OK", c.do("UNWATCH"))
+	assert.Equal(t, "OK", c.do("MULTI"))
+	assert.Equal(t, "QUEUED", c.do("SET", "key", "mine"))
+	assert.Equal(t, []any{"OK"}, c.do("EXEC"))
+}
+
+func TestClose(t *testing.T) {
+	s, c := newTestServer(t)
+	c2 := dial(t, s)
+	assert.Equal(t, "PONG", c.do("PING"))
+	assert.Equal(t, "PONG", c2.do("PING"))
+
+	assert.NoError(t, s.Close())
+	_, err := c.reader.ReadByte()
+	assert.Error(t, err)
+	_, err = net.Dial("tcp", s.Addr().String())
+	assert.Error(t, err)
+}
@@ -1,21 +1,336 @@
 package server
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hw1/internal/pkg/command"
 	"hw1/internal/pkg/storage"
+	"io"
 	"log"
 	"net/http"
+	"slices"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	mimeOctetStream = "application/octet-stream"
+	// dbHeader chooses the database of the request, the /db/:db path prefix does the same
+	dbHeader     = "X-DB"
+	dbContextKey = "db"
+)
+
 type Server struct {
 	storage *storage.Storage
 	host    string
 }
 
+// Entry is a scalar value. Ex and Px set the expiration in seconds or milliseconds.
+// Type is the kind of the value: "string", "int", "float", "binary" or "auto" when it is set,
+// by default auto, and the stored kind when it is read. Binary values are in base64.
 type Entry struct {
 	Value string `json:"value"`
+	Type  string `json:"type,omitempty"`
+	Ex    int64  `json:"ex,omitempty"`
+	Px    int64  `json:"px,omitempty"`
+}
+
+type LengthEntry struct {
+	Length int `json:"length"`
+}
+
+// OptionalEntry is a scalar which may be missing, then Value is null.
+type OptionalEntry struct {
+	Value *string `json:"value"`
+}
+
+type SetRangeRequest struct {
+	Offset int    `json:"offset"`
+	Value  string `json:"value"`
+}
+
+// IncrByFloatRequest is the body of the float increment route.
+type IncrByFloatRequest struct {
+	By float64 `json:"by"`
+}
+
+type FloatEntry struct {
+	Value float64 `json:"value"`
+}
+
+// IncrRequest is the optional body of the increment routes, By is 1 if it is omitted.
+type IncrRequest struct {
+	By *int64 `json:"by"`
+}
+
+type IntEntry struct {
+	Value int64 `json:"value"`
+}
+
+// ExpireRequest sets the expiration either in seconds (Ex) or milliseconds (Px), 0 removes it.
+type ExpireRequest struct {
+	Ex *int64 `json:"ex"`
+	Px *int64 `json:"px"`
+}
+
+type ResultEntry struct {
+	Result bool `json:"result"`
+}
+
+// TTLEntry is a remaining time to live: -2 if the key doesnt exist, -1 if it has no expiration.
+type TTLEntry struct {
+	TTL int64 `json:"ttl"`
+}
+
+type HashEntry struct {
+	Fields map[string]string `json:"fields"`
+}
+
+type HashFields struct {
+	Fields []string `json:"fields"`
+}
+
+type CountEntry struct {
+	Count int `json:"count"`
+}
+
+type KeysEntry struct {
+	Keys []string `json:"keys"`
+}
+
+// ScanEntry is a batch of keys. Cursor is a string because it doesnt fit into a JSON number.
+type ScanEntry struct {
+	Cursor string   `json:"cursor"`
+	Keys   []string `json:"keys"`
+}
+
+// ValuesEntry holds the scalars of several keys in their order, null for missing keys and keys of other types.
+type ValuesEntry struct {
+	Values []*string `json:"values"`
+}
+
+type MSetRequest struct {
+	Values map[string]string `json:"values"`
+}
+
+// TypeEntry is the type of a key: "string", "list", "hash", "zset", "set" or "none" if it doesnt exist.
+type TypeEntry struct {
+	Type string `json:"type"`
+}
+
+type TypesEntry struct {
+	Types map[string]string `json:"types"`
+}
+
+// MoveRequest is the destination of a rename or a copy,
+// with Replace a copy overwrites the existing destination.
+type MoveRequest struct {
+	To      string `json:"to"`
+	Replace bool   `json:"replace"`
+}
+
+type DatabasesEntry struct {
+	Databases []string `json:"databases"`
+}
+
+type DBSizeEntry struct {
+	Size int `json:"size"`
+}
+
+// SwapDBRequest names the databases exchanging their data.
+type SwapDBRequest struct {
+	First  string `json:"first"`
+	Second string `json:"second"`
+}
+
+// SetMember is a member of a set given as a JSON string or integer, integers are kept in their decimal form.
+type SetMember string
+
+func (m *SetMember) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, (*string)(m))
+	}
+	n, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return fmt.Errorf("set member %s is not a string or an integer", data)
+	}
+	*m = SetMember(strconv.FormatInt(n, 10))
+	return nil
+}
+
+type SetRequest struct {
+	Members []SetMember `json:"members"`
+}
+
+type SetEntry struct {
+	Members []string `json:"members"`
+}
+
+// ZAddRequest sets the scores of the members, the options are the ones of ZADD.
+type ZAddRequest struct {
+	Members map[string]float64 `json:"members"`
+	NX      bool               `json:"nx"`
+	XX      bool               `json:"xx"`
+	GT      bool               `json:"gt"`
+	LT      bool               `json:"lt"`
+	CH      bool               `json:"ch"`
+}
+
+type ZIncrByRequest struct {
+	Member string  `json:"member"`
+	By     float64 `json:"by"`
+}
+
+type ZMembersRequest struct {
+	Members []string `json:"members"`
+}
+
+type ScoreEntry struct {
+	Score float64 `json:"score"`
+}
+
+type RankEntry struct {
+	Rank int `json:"rank"`
+}
+
+// ZRangeEntry is a part of a sorted set in its order.
+type ZRangeEntry struct {
+	Members []storage.ZMember `json:"members"`
+}
+
+// ListElement is an element of a list given as a JSON string or integer. The elements
+// which are integers in their decimal form are written as numbers, like before the lists of strings.
+type ListElement string
+
+func (e *ListElement) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, (*string)(e))
+	}
+	n, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return fmt.Errorf("list element %s is not a string or an integer", data)
+	}
+	*e = ListElement(strconv.FormatInt(n, 10))
+	return nil
+}
+
+func (e ListElement) MarshalJSON() ([]byte, error) {
+	if n, err := strconv.ParseInt(string(e), 10, 64); err == nil && strconv.FormatInt(n, 10) == string(e) {
+		return []byte(e), nil
+	}
+	return json.Marshal(string(e))
+}
+
+type ArrayEntry struct {
+	Elements []ListElement `json:"elements"`
+}
+
+type ArrayLength struct {
+	NewLength int `json:"new_length"`
+}
+
+// PopRequest selects what to pop: nothing - one element, Count - that many elements,
+// Left and Right - the segment between these indexes.
+type PopRequest struct {
+	Count *int `json:"count"`
+	Left  *int `json:"left"`
+	Right *int `json:"right"`
+}
+
+type SegmentRequest struct {
+	Left  int `json:"left"`
+	Right int `json:"right"`
+}
+
+type IndexEntry struct {
+	Index int         `json:"index"`
+	Value ListElement `json:"value"`
+}
+
+// RangeRequest is a range of indexes like in LTRIM, negative indexes count from the end.
+type RangeRequest struct {
+	Start int `json:"start"`
+	Stop  int `json:"stop"`
+}
+
+// InsertRequest inserts Element before Pivot or, with After, after it.
+type InsertRequest struct {
+	Pivot   ListElement `json:"pivot"`
+	Element ListElement `json:"element"`
+	After   bool        `json:"after"`
+}
+
+// RemoveRequest removes Count elements like in LREM: from the head, from the tail if it is negative,
+// all of them if it is 0.
+type RemoveRequest struct {
+	Count   int         `json:"count"`
+	Element ListElement `json:"element"`
+}
+
+type PositionsEntry struct {
+	Indexes []int `json:"indexes"`
+}
+
+// ListMoveRequest moves an element from the From side of the list to the To side of the Destination list,
+// the sides are "left" and "right".
+type ListMoveRequest struct {
+	Destination string `json:"destination"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+}
+
+type ElementEntry struct {
+	Element ListElement `json:"element"`
+}
+
+// BlockingPopRequest waits up to Timeout seconds for an element of one of the lists, 0 means no limit.
+type BlockingPopRequest struct {
+	Keys    []string `json:"keys"`
+	Timeout float64  `json:"timeout"`
+}
+
+// PoppedEntry is the element popped by a blocking pop with the key of its list.
+type PoppedEntry struct {
+	Key     string      `json:"key"`
+	Element ListElement `json:"element"`
+}
+
+// BlockingMoveRequest is a ListMoveRequest waiting like BlockingPopRequest.
+type BlockingMoveRequest struct {
+	Destination string  `json:"destination"`
+	From        string  `json:"from"`
+	To          string  `json:"to"`
+	Timeout     float64 `json:"timeout"`
+}
+
+// CommandResult is the reply of POST /cmd, in a transaction Error is set instead if the command failed.
+type CommandResult struct {
+	Result any    `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+type WatchRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// WatchEntry holds the current versions of the keys, a transaction watching them
+// is aborted if any of them changes.
+type WatchEntry struct {
+	Versions map[string]uint64 `json:"versions"`
+}
+
+// TxRequest is a transaction: the commands are run atomically
+// if the watched keys still have the given versions.
+type TxRequest struct {
+	Watch    map[string]uint64 `json:"watch"`
+	Commands [][]string        `json:"commands"`
+}
+
+type TxResult struct {
+	Results []CommandResult `json:"results"`
 }
 
 func New(host string, st *storage.Storage) *Server {
@@ -38,41 +353,1643 @@ func (r *Server) newAPI() *gin.Engine {
 		ctx.Status(http.StatusOK)
 	})
 
-	engine.PUT("/scalar/set/:key", r.handlerSet)
-	engine.GET("/scalar/get/:key", r.handlerGet)
+	// the statistics cover every database
+	engine.GET("/stats/expire", r.handlerExpireStats)
+	engine.GET("/stats/memory", r.handlerMemoryStats)
+	engine.GET("/databases", r.handlerDatabases)
+
+	// the other routes work with the default database, the one chosen by the X-DB header
+	// or, with the /db/:db prefix, by the path
+	engine.Use(r.selectDB)
+	r.routes(engine)
+	r.routes(engine.Group("/db/:db"))
 
 	return engine
 }
 
+// routes registers the routes working with the database.
+func (r *Server) routes(routes gin.IRoutes) {
+	routes.POST("/cmd", r.handlerCommand)
+	routes.POST("/tx/watch", r.handlerWatch)
+	routes.POST("/tx", r.handlerTx)
+
+	routes.PUT("/scalar/set/:key", r.handlerSet)
+	routes.GET("/scalar/get/:key", r.handlerGet)
+	routes.POST("/scalar/incr/:key", r.handlerIncr)
+	routes.POST("/scalar/decr/:key", r.handlerDecr)
+	routes.POST("/scalar/incrbyfloat/:key", r.handlerIncrByFloat)
+	routes.POST("/scalar/append/:key", r.handlerAppend)
+	routes.GET("/scalar/strlen/:key", r.handlerStrlen)
+	routes.GET("/scalar/getrange/:key", r.handlerGetRange)
+	routes.POST("/scalar/setrange/:key", r.handlerSetRange)
+	routes.POST("/scalar/getset/:key", r.handlerGetSet)
+	routes.POST("/scalar/getdel/:key", r.handlerGetDel)
+
+	routes.GET("/dbsize", r.handlerDBSize)
+	routes.POST("/flushdb", r.handlerFlushDB)
+	routes.POST("/swapdb", r.handlerSwapDB)
+
+	routes.GET("/keys", r.handlerKeys)
+	routes.GET("/scan", r.handlerScan)
+	routes.POST("/keys/mget", r.handlerMget)
+	routes.POST("/keys/mset", r.handlerMset)
+	routes.POST("/keys/del", r.handlerDel)
+	routes.POST("/keys/exists", r.handlerExists)
+	routes.POST("/keys/type", r.handlerTypes)
+
+	routes.POST("/key/expire/:key", r.handlerExpire)
+	routes.POST("/key/persist/:key", r.handlerPersist)
+	routes.GET("/key/ttl/:key", r.handlerTTL)
+	routes.GET("/key/pttl/:key", r.handlerPTTL)
+	routes.GET("/key/type/:key", r.handlerType)
+	routes.POST("/key/rename/:key", r.handlerRename)
+	routes.POST("/key/copy/:key", r.handlerCopy)
+
+	routes.PUT("/hash/set/:key", r.handlerHset)
+	routes.GET("/hash/get/:key/:field", r.handlerHget)
+	routes.POST("/hash/del/:key", r.handlerHdel)
+	routes.GET("/hash/getall/:key", r.handlerHgetall)
+	routes.GET("/hash/len/:key", r.handlerHlen)
+
+	routes.PUT("/set/add/:key", r.handlerSadd)
+	routes.POST("/set/rem/:key", r.handlerSrem)
+	routes.GET("/set/ismember/:key/:member", r.handlerSismember)
+	routes.GET("/set/members/:key", r.handlerSmembers)
+	routes.GET("/set/card/:key", r.handlerScard)
+	routes.POST("/set/pop/:key", r.handlerSpop)
+	routes.GET("/set/randmember/:key", r.handlerSrandmember)
+	routes.POST("/set/inter", r.handlerCombine("SINTER"))
+	routes.POST("/set/union", r.handlerCombine("SUNION"))
+	routes.POST("/set/diff", r.handlerCombine("SDIFF"))
+	routes.POST("/set/interstore/:key", r.handlerCombineStore("SINTERSTORE"))
+	routes.POST("/set/unionstore/:key", r.handlerCombineStore("SUNIONSTORE"))
+	routes.POST("/set/diffstore/:key", r.handlerCombineStore("SDIFFSTORE"))
+
+	routes.PUT("/zset/add/:key", r.handlerZadd)
+	routes.POST("/zset/incrby/:key", r.handlerZincrby)
+	routes.POST("/zset/rem/:key", r.handlerZrem)
+	routes.GET("/zset/score/:key/:member", r.handlerZscore)
+	routes.GET("/zset/card/:key", r.handlerZcard)
+	routes.GET("/zset/rank/:key/:member", r.handlerZrank)
+	routes.GET("/zset/range/:key", r.handlerZrange)
+	routes.GET("/zset/rangebyscore/:key", r.handlerZrangeByScore)
+
+	routes.POST("/array/rpush/:key", r.handlerRpush)
+	routes.POST("/array/lpush/:key", r.handlerLpush)
+	routes.POST("/array/raddtoset/:key", r.handlerRaddtoset)
+	routes.POST("/array/lpop/:key", r.handlerLpop)
+	routes.POST("/array/rpop/:key", r.handlerRpop)
+	routes.PUT("/array/lset/:key", r.handlerLset)
+	routes.GET("/array/lget/:key/:index", r.handlerLget)
+	routes.POST("/array/deletesegment/:key", r.handlerDeleteSegment)
+	routes.GET("/array/len/:key", r.handlerLlen)
+	routes.GET("/array/range/:key", r.handlerLrange)
+	routes.POST("/array/insert/:key", r.handlerLinsert)
+	routes.POST("/array/rem/:key", r.handlerLrem)
+	routes.POST("/array/trim/:key", r.handlerLtrim)
+	routes.GET("/array/pos/:key", r.handlerLpos)
+	routes.POST("/array/move/:key", r.handlerLmove)
+	routes.POST("/array/blpop", r.handlerBLpop)
+	routes.POST("/array/brpop", r.handlerBRpop)
+	routes.POST("/array/blmove/:key", r.handlerBLmove)
+}
+
+// selectDB puts the storage of the requested database to the context, see db.
+func (r *Server) selectDB(ctx *gin.Context) {
+	name := ctx.Param("db")
+	if name == "" {
+		name = ctx.GetHeader(dbHeader)
+	}
+	if name == "" {
+		ctx.Set(dbContextKey, r.storage)
+		return
+	}
+
+	db, err := r.storage.DB(name)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	ctx.Set(dbContextKey, db)
+}
+
+// db returns the storage of the database the request works with.
+func (r *Server) db(ctx *gin.Context) *storage.Storage {
+	return ctx.MustGet(dbContextKey).(*storage.Storage)
+}
+
+// handlerCommand runs any command given as the JSON array of its arguments, like ["LPUSH","k","1"].
+func (r *Server) handlerCommand(ctx *gin.Context) {
+	var args []string
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&args); err != nil || len(args) == 0 {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	reply, ok := r.execute(ctx, args...)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, CommandResult{
+		Result: reply,
+	})
+}
+
+func (r *Server) handlerWatch(ctx *gin.Context) {
+	var v WatchRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil || len(v.Keys) == 0 {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	versions := make(map[string]uint64, len(v.Keys))
+	for _, key := range v.Keys {
+		versions[key] = r.db(ctx).KeyVersion(key)
+	}
+
+	ctx.JSON(http.StatusOK, WatchEntry{
+		Versions: versions,
+	})
+}
+
+// handlerTx runs the commands atomically. Nothing is run if a command is rejected (400)
+// or a watched key has another version (409), the failure of a command at run time
+// is its result and does not stop the others.
+func (r *Server) handlerTx(ctx *gin.Context) {
+	var v TxRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil || len(v.Commands) == 0 {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	tx := command.NewTransaction()
+	for key, version := range v.Watch {
+		tx.WatchVersion(key, version)
+	}
+	tx.Multi()
+	for _, args := range v.Commands {
+		if err := tx.Queue(args); err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+	}
+
+	replies, err := tx.Exec(r.db(ctx))
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	results := make([]CommandResult, len(replies))
+	for i, reply := range replies {
+		if err, ok := reply.(error); ok {
+			results[i].Error = err.Error()
+		} else {
+			results[i].Result = reply
+		}
+	}
+	ctx.JSON(http.StatusOK, TxResult{
+		Results: results,
+	})
+}
+
+// execute runs the command from the command table. On error it aborts the request and returns false.
+// The blocking commands stop waiting when the client goes away.
+func (r *Server) execute(ctx *gin.Context, args ...string) (any, bool) {
+	reply, err := command.ExecuteContext(ctx.Request.Context(), r.db(ctx), args)
+	if err != nil {
+		abortWithError(ctx, err)
+		return nil, false
+	}
+	return reply, true
+}
+
+// handlerSet sets the value from the JSON Entry. A body of the application/octet-stream type
+// is stored as it is as a binary value, then the expiration is given by ?ex= or ?px=.
 func (r *Server) handlerSet(ctx *gin.Context) {
 	key := ctx.Param("key")
 
 	var v Entry
+	if ctx.ContentType() == mimeOctetStream {
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		v.Value, v.Type = string(body), storage.KindBinary.Name()
+		if v.Ex, err = strconv.ParseInt(ctx.DefaultQuery("ex", "0"), 10, 64); err != nil {
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if v.Px, err = strconv.ParseInt(ctx.DefaultQuery("px", "0"), 10, 64); err != nil {
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+	} else {
+		if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if v.Type == storage.KindBinary.Name() {
+			decoded, err := base64.StdEncoding.DecodeString(v.Value)
+			if err != nil {
+				ctx.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
+			v.Value = string(decoded)
+		}
+	}
 
-	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
-		ctx.AbortWithStatus(http.StatusBadRequest)
+	args := []string{"SET", key, v.Value}
+	if v.Ex != 0 {
+		args = append(args, "EX", strconv.FormatInt(v.Ex, 10))
+	}
+	if v.Px != 0 {
+		args = append(args, "PX", strconv.FormatInt(v.Px, 10))
+	}
+	if v.Type != "" {
+		args = append(args, "TYPE", v.Type)
+	}
+	if _, ok := r.execute(ctx, args...); !ok {
 		return
 	}
 
-	r.storage.Set(key, v.Value)
-
 	ctx.Status(http.StatusOK)
 }
 
 func (r *Server) handlerGet(ctx *gin.Context) {
 	key := ctx.Param("key")
 
-	v, err := r.storage.Get(key)
-	if err != nil {
+	// GET replies only with the value, so the kind is read directly
+	value, k, err := r.db(ctx).GetTyped(key)
+	if errors.Is(err, storage.ErrKeyDoesntExist) {
 		ctx.AbortWithStatus(http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+
+	// the value of any kind can be read as raw bytes
+	if ctx.GetHeader("Accept") == mimeOctetStream {
+		ctx.Header("X-Value-Type", k.Name())
+		ctx.Data(http.StatusOK, mimeOctetStream, []byte(value))
+		return
+	}
+	if k == storage.KindBinary {
+		value = base64.StdEncoding.EncodeToString([]byte(value))
+	}
+
+	ctx.JSON(http.StatusOK, Entry{
+		Value: value,
+		Type:  k.Name(),
+	})
+}
+
+func (r *Server) handlerAppend(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v Entry
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	reply, ok := r.execute(ctx, "APPEND", key, v.Value)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, LengthEntry{
+		Length: int(reply.(int64)),
+	})
+}
+
+func (r *Server) handlerStrlen(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	reply, ok := r.execute(ctx, "STRLEN", key)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, LengthEntry{
+		Length: int(reply.(int64)),
+	})
+}
+
+// handlerGetRange returns the substring between ?start= and ?end=, by default the whole string.
+func (r *Server) handlerGetRange(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	reply, ok := r.execute(ctx, "GETRANGE", key, ctx.DefaultQuery("start", "0"), ctx.DefaultQuery("end", "-1"))
+	if !ok {
+		return
+	}
 
 	ctx.JSON(http.StatusOK, Entry{
-		Value: v,
+		Value: reply.(string),
+	})
+}
+
+func (r *Server) handlerSetRange(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v SetRangeRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	reply, ok := r.execute(ctx, "SETRANGE", key, strconv.Itoa(v.Offset), v.Value)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, LengthEntry{
+		Length: int(reply.(int64)),
 	})
 }
 
+// handlerGetSet sets the value and returns the old one, null if there was none.
+func (r *Server) handlerGetSet(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v Entry
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	reply, ok := r.execute(ctx, "GETSET", key, v.Value)
+	if !ok {
+		return
+	}
+
+	var old OptionalEntry
+	if reply != nil {
+		value := reply.(string)
+		old.Value = &value
+	}
+	ctx.JSON(http.StatusOK, old)
+}
+
+func (r *Server) handlerGetDel(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	reply, ok := r.execute(ctx, "GETDEL", key)
+	if !ok {
+		return
+	}
+	if reply == nil {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, Entry{
+		Value: reply.(string),
+	})
+}
+
+func (r *Server) handlerIncr(ctx *gin.Context) {
+	r.incr(ctx, "INCRBY")
+}
+
+func (r *Server) handlerDecr(ctx *gin.Context) {
+	r.incr(ctx, "DECRBY")
+}
+
+func (r *Server) handlerIncrByFloat(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v IncrByFloatRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	reply, ok := r.execute(ctx, "INCRBYFLOAT", key, strconv.FormatFloat(v.By, 'f', -1, 64))
+	if !ok {
+		return
+	}
+
+	value, _ := strconv.ParseFloat(reply.(string), 64)
+	ctx.JSON(http.StatusOK, FloatEntry{
+		Value: value,
+	})
+}
+
+func (r *Server) incr(ctx *gin.Context, name string) {
+	key := ctx.Param("key")
+
+	var v IncrRequest
+	if ctx.Request.ContentLength != 0 {
+		if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+	}
+	by := int64(1)
+	if v.By != nil {
+		by = *v.By
+	}
+
+	reply, ok := r.execute(ctx, name, key, strconv.FormatInt(by, 10))
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, IntEntry{
+		Value: reply.(int64),
+	})
+}
+
+// handlerKeys returns keys matching either the glob ?pattern= or the regular expression ?regexp=.
+func (r *Server) handlerKeys(ctx *gin.Context) {
+	pattern, hasPattern := ctx.GetQuery("pattern")
+	expr, hasRegexp := ctx.GetQuery("regexp")
+
+	var args []string
+	switch {
+	case hasPattern && hasRegexp:
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	case hasRegexp:
+		args = []string{"KEYS", "REGEXP", expr}
+	case hasPattern:
+		args = []string{"KEYS", pattern}
+	default:
+		args = []string{"KEYS", "*"}
+	}
+
+	reply, ok := r.execute(ctx, args...)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, KeysEntry{
+		Keys: reply.([]string),
+	})
+}
+
+func (r *Server) handlerScan(ctx *gin.Context) {
+	args := []string{"SCAN", ctx.DefaultQuery("cursor", "0")}
+	for _, option := range []string{"match", "count", "type"} {
+		if value := ctx.Query(option); value != "" {
+			args = append(args, option, value)
+		}
+	}
+
+	reply, ok := r.execute(ctx, args...)
+	if !ok {
+		return
+	}
+
+	result := reply.([]any)
+	ctx.JSON(http.StatusOK, ScanEntry{
+		Cursor: result[0].(string),
+		Keys:   result[1].([]string),
+	})
+}
+
+func (r *Server) handlerExpire(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v ExpireRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	var args []string
+	switch {
+	case v.Ex != nil && v.Px == nil:
+		args = []string{"EXPIRE", key, strconv.FormatInt(*v.Ex, 10)}
+	case v.Ex == nil && v.Px != nil:
+		args = []string{"PEXPIRE", key, strconv.FormatInt(*v.Px, 10)}
+	default:
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	// 0 removes the expiration like in the storage API, while EXPIRE key 0 deletes the key
+	if args[2] == "0" {
+		args = []string{"PERSIST", key}
+	}
+
+	reply, ok := r.execute(ctx, args...)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ResultEntry{
+		Result: reply.(int64) == 1,
+	})
+}
+
+func (r *Server) handlerPersist(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	reply, ok := r.execute(ctx, "PERSIST", key)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ResultEntry{
+		Result: reply.(int64) == 1,
+	})
+}
+
+func (r *Server) handlerTTL(ctx *gin.Context) {
+	r.ttl(ctx, "TTL")
+}
+
+func (r *Server) handlerPTTL(ctx *gin.Context) {
+	r.ttl(ctx, "PTTL")
+}
+
+func (r *Server) ttl(ctx *gin.Context, name string) {
+	key := ctx.Param("key")
+
+	reply, ok := r.execute(ctx, name, key)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, TTLEntry{
+		TTL: reply.(int64),
+	})
+}
+
+func (r *Server) handlerMget(ctx *gin.Context) {
+	var v KeysEntry
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	reply, ok := r.execute(ctx, append([]string{"MGET"}, v.Keys...)...)
+	if !ok {
+		return
+	}
+
+	values := make([]*string, 0, len(v.Keys))
+	for _, value := range reply.([]any) {
+		if s, ok := value.(string); ok {
+			values = append(values, &s)
+		} else {
+			values = append(values, nil)
+		}
+	}
+	ctx.JSON(http.StatusOK, ValuesEntry{
+		Values: values,
+	})
+}
+
+func (r *Server) handlerMset(ctx *gin.Context) {
+	var v MSetRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	args := make([]string, 0, 1+2*len(v.Values))
+	args = append(args, "MSET")
+	for key, value := range v.Values {
+		args = append(args, key, value)
+	}
+
+	if _, ok := r.execute(ctx, args...); !ok {
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+func (r *Server) handlerDel(ctx *gin.Context) {
+	r.countKeys(ctx, "DEL")
+}
+
+func (r *Server) handlerExists(ctx *gin.Context) {
+	r.countKeys(ctx, "EXISTS")
+}
+
+// countKeys runs the command taking the keys of the body and replying with a number.
+func (r *Server) countKeys(ctx *gin.Context, name string) {
+	var v KeysEntry
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	reply, ok := r.execute(ctx, append([]string{name}, v.Keys...)...)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, CountEntry{
+		Count: int(reply.(int64)),
+	})
+}
+
+func (r *Server) handlerType(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	reply, ok := r.execute(ctx, "TYPE", key)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, TypeEntry{
+		Type: string(reply.(command.Status)),
+	})
+}
+
+func (r *Server) handlerTypes(ctx *gin.Context) {
+	var v KeysEntry
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil || len(v.Keys) == 0 {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	types := make(map[string]string, len(v.Keys))
+	for _, key := range v.Keys {
+		reply, ok := r.execute(ctx, "TYPE", key)
+		if !ok {
+			return
+		}
+		types[key] = string(reply.(command.Status))
+	}
+	ctx.JSON(http.StatusOK, TypesEntry{
+		Types: types,
+	})
+}
+
+func (r *Server) handlerRename(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v MoveRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil || v.To == "" {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := r.execute(ctx, "RENAME", key, v.To); !ok {
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+func (r *Server) handlerCopy(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v MoveRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil || v.To == "" {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	args := []string{"COPY", key, v.To}
+	if v.Replace {
+		args = append(args, "REPLACE")
+	}
+	reply, ok := r.execute(ctx, args...)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ResultEntry{
+		Result: reply.(int64) == 1,
+	})
+}
+
+func (r *Server) handlerDatabases(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, DatabasesEntry{
+		Databases: r.storage.Databases(),
+	})
+}
+
+func (r *Server) handlerDBSize(ctx *gin.Context) {
+	reply, ok := r.execute(ctx, "DBSIZE")
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, DBSizeEntry{
+		Size: int(reply.(int64)),
+	})
+}
+
+func (r *Server) handlerFlushDB(ctx *gin.Context) {
+	if _, ok := r.execute(ctx, "FLUSHDB"); !ok {
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+func (r *Server) handlerSwapDB(ctx *gin.Context) {
+	var v SwapDBRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := r.execute(ctx, "SWAPDB", v.First, v.Second); !ok {
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+func (r *Server) handlerExpireStats(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, r.storage.ExpireStats())
+}
+
+func (r *Server) handlerMemoryStats(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, r.storage.MemoryStats())
+}
+
+func (r *Server) handlerHset(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v HashEntry
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	args := make([]string, 0, 2+2*len(v.Fields))
+	args = append(args, "HSET", key)
+	for field, value := range v.Fields {
+		args = append(args, field, value)
+	}
+
+	reply, ok := r.execute(ctx, args...)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, CountEntry{
+		Count: int(reply.(int64)),
+	})
+}
+
+func (r *Server) handlerHget(ctx *gin.Context) {
+	key := ctx.Param("key")
+	field := ctx.Param("field")
+
+	reply, ok := r.execute(ctx, "HGET", key, field)
+	if !ok {
+		return
+	}
+	if reply == nil {
+		abortWithError(ctx, storage.ErrFieldDoesntExist)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, Entry{
+		Value: reply.(string),
+	})
+}
+
+func (r *Server) handlerHdel(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v HashFields
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	reply, ok := r.execute(ctx, append([]string{"HDEL", key}, v.Fields...)...)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, CountEntry{
+		Count: int(reply.(int64)),
+	})
+}
+
+func (r *Server) handlerHgetall(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	reply, ok := r.execute(ctx, "HGETALL", key)
+	if !ok {
+		return
+	}
+	// hashes are never empty, so an empty one is a missing key
+	hash := reply.(map[string]string)
+	if len(hash) == 0 {
+		abortWithError(ctx, storage.ErrKeyDoesntExist)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, HashEntry{
+		Fields: hash,
+	})
+}
+
+func (r *Server) handlerHlen(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	reply, ok := r.execute(ctx, "HLEN", key)
+	if !ok {
+		return
+	}
+	if reply.(int64) == 0 {
+		abortWithError(ctx, storage.ErrKeyDoesntExist)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, CountEntry{
+		Count: int(reply.(int64)),
+	})
+}
+
+func (r *Server) handlerSadd(ctx *gin.Context) {
+	r.setMembers(ctx, "SADD")
+}
+
+func (r *Server) handlerSrem(ctx *gin.Context) {
+	r.setMembers(ctx, "SREM")
+}
+
+// setMembers runs the command with the members of the SetRequest, the reply is their count.
+func (r *Server) setMembers(ctx *gin.Context, name string) {
+	key := ctx.Param("key")
+
+	var v SetRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	args := make([]string, 0, 2+len(v.Members))
+	args = append(args, name, key)
+	for _, member := range v.Members {
+		args = append(args, string(member))
+	}
+
+	reply, ok := r.execute(ctx, args...)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, CountEntry{
+		Count: int(reply.(int64)),
+	})
+}
+
+func (r *Server) handlerSismember(ctx *gin.Context) {
+	key := ctx.Param("key")
+	member := ctx.Param("member")
+
+	reply, ok := r.execute(ctx, "SISMEMBER", key, member)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ResultEntry{
+		Result: reply.(int64) == 1,
+	})
+}
+
+func (r *Server) handlerSmembers(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	reply, ok := r.execute(ctx, "SMEMBERS", key)
+	if !ok {
+		return
+	}
+	// sets are never empty, so an empty one is a missing key
+	members := reply.([]string)
+	if len(members) == 0 {
+		abortWithError(ctx, storage.ErrKeyDoesntExist)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SetEntry{
+		Members: members,
+	})
+}
+
+func (r *Server) handlerScard(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	reply, ok := r.execute(ctx, "SCARD", key)
+	if !ok {
+		return
+	}
+	if reply.(int64) == 0 {
+		abortWithError(ctx, storage.ErrKeyDoesntExist)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, CountEntry{
+		Count: int(reply.(int64)),
+	})
+}
+
+// handlerSpop removes random members, one by default or the count of the PopRequest.
+func (r *Server) handlerSpop(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v PopRequest
+	if ctx.Request.ContentLength != 0 {
+		if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+	}
+	count := 1
+	if v.Count != nil {
+		count = *v.Count
+	}
+
+	reply, ok := r.execute(ctx, "SPOP", key, strconv.Itoa(count))
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SetEntry{
+		Members: reply.([]string),
+	})
+}
+
+// handlerSrandmember returns ?count= random members, one by default, a negative count allows repetitions.
+func (r *Server) handlerSrandmember(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	reply, ok := r.execute(ctx, "SRANDMEMBER", key, ctx.DefaultQuery("count", "1"))
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SetEntry{
+		Members: reply.([]string),
+	})
+}
+
+// handlerCombine returns the result of SINTER, SUNION or SDIFF of the keys from the KeysEntry.
+func (r *Server) handlerCombine(name string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var v KeysEntry
+		if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		reply, ok := r.execute(ctx, append([]string{name}, v.Keys...)...)
+		if !ok {
+			return
+		}
+
+		ctx.JSON(http.StatusOK, SetEntry{
+			Members: reply.([]string),
+		})
+	}
+}
+
+// handlerCombineStore stores the result of SINTER, SUNION or SDIFF of the keys from the KeysEntry
+// at the key and returns its size.
+func (r *Server) handlerCombineStore(name string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.Param("key")
+
+		var v KeysEntry
+		if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		reply, ok := r.execute(ctx, append([]string{name, key}, v.Keys...)...)
+		if !ok {
+			return
+		}
+
+		ctx.JSON(http.StatusOK, CountEntry{
+			Count: int(reply.(int64)),
+		})
+	}
+}
+
+func (r *Server) handlerZadd(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v ZAddRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	args := make([]string, 0, 7+2*len(v.Members))
+	args = append(args, "ZADD", key)
+	for option, set := range map[string]bool{"NX": v.NX, "XX": v.XX, "GT": v.GT, "LT": v.LT, "CH": v.CH} {
+		if set {
+			args = append(args, option)
+		}
+	}
+	for member, score := range v.Members {
+		args = append(args, strconv.FormatFloat(score, 'f', -1, 64), member)
+	}
+
+	reply, ok := r.execute(ctx, args...)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, CountEntry{
+		Count: int(reply.(int64)),
+	})
+}
+
+func (r *Server) handlerZincrby(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v ZIncrByRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	reply, ok := r.execute(ctx, "ZINCRBY", key, strconv.FormatFloat(v.By, 'f', -1, 64), v.Member)
+	if !ok {
+		return
+	}
+
+	score, _ := strconv.ParseFloat(reply.(string), 64)
+	ctx.JSON(http.StatusOK, ScoreEntry{
+		Score: score,
+	})
+}
+
+func (r *Server) handlerZrem(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v ZMembersRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	reply, ok := r.execute(ctx, append([]string{"ZREM", key}, v.Members...)...)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, CountEntry{
+		Count: int(reply.(int64)),
+	})
+}
+
+func (r *Server) handlerZscore(ctx *gin.Context) {
+	key := ctx.Param("key")
+	member := ctx.Param("member")
+
+	reply, ok := r.execute(ctx, "ZSCORE", key, member)
+	if !ok {
+		return
+	}
+	if reply == nil {
+		abortWithError(ctx, storage.ErrMemberDoesntExist)
+		return
+	}
+
+	score, _ := strconv.ParseFloat(reply.(string), 64)
+	ctx.JSON(http.StatusOK, ScoreEntry{
+		Score: score,
+	})
+}
+
+func (r *Server) handlerZcard(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	reply, ok := r.execute(ctx, "ZCARD", key)
+	if !ok {
+		return
+	}
+	// sorted sets are never empty, so an empty one is a missing key
+	if reply.(int64) == 0 {
+		abortWithError(ctx, storage.ErrKeyDoesntExist)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, CountEntry{
+		Count: int(reply.(int64)),
+	})
+}
+
+// handlerZrank returns the rank of the member from the lowest score, from the highest one with ?rev=true.
+func (r *Server) handlerZrank(ctx *gin.Context) {
+	key := ctx.Param("key")
+	member := ctx.Param("member")
+
+	name := "ZRANK"
+	if ctx.Query("rev") == "true" {
+		name = "ZREVRANK"
+	}
+	reply, ok := r.execute(ctx, name, key, member)
+	if !ok {
+		return
+	}
+	if reply == nil {
+		abortWithError(ctx, storage.ErrMemberDoesntExist)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, RankEntry{
+		Rank: int(reply.(int64)),
+	})
+}
+
+// handlerZrange returns the members with ranks between ?start= and ?stop=, by default all of them,
+// in the reverse order with ?rev=true.
+func (r *Server) handlerZrange(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	name := "ZRANGE"
+	if ctx.Query("rev") == "true" {
+		name = "ZREVRANGE"
+	}
+	reply, ok := r.execute(ctx, name, key, ctx.DefaultQuery("start", "0"), ctx.DefaultQuery("stop", "-1"), "WITHSCORES")
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ZRangeEntry{
+		Members: parseMembers(reply.([]string)),
+	})
+}
+
+// handlerZrangeByScore returns the members with scores between ?min= and ?max=, by default all of them,
+// in the reverse order with ?rev=true. The bounds are like in ZRANGEBYSCORE, ?offset= and ?count= limit the result.
+func (r *Server) handlerZrangeByScore(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	name, first, second := "ZRANGEBYSCORE", ctx.DefaultQuery("min", "-inf"), ctx.DefaultQuery("max", "+inf")
+	if ctx.Query("rev") == "true" {
+		name, first, second = "ZREVRANGEBYSCORE", second, first
+	}
+	args := []string{name, key, first, second, "WITHSCORES"}
+	if offset, count := ctx.Query("offset"), ctx.Query("count"); offset != "" || count != "" {
+		args = append(args, "LIMIT", ctx.DefaultQuery("offset", "0"), ctx.DefaultQuery("count", "-1"))
+	}
+
+	reply, ok := r.execute(ctx, args...)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ZRangeEntry{
+		Members: parseMembers(reply.([]string)),
+	})
+}
+
+// parseMembers converts the reply of a range WITHSCORES back to the members.
+func parseMembers(items []string) []storage.ZMember {
+	members := make([]storage.ZMember, 0, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		score, _ := strconv.ParseFloat(items[i+1], 64)
+		members = append(members, storage.ZMember{Member: items[i], Score: score})
+	}
+	return members
+}
+
+func (r *Server) handlerRpush(ctx *gin.Context) {
+	r.push(ctx, "RPUSH")
+}
+
+func (r *Server) handlerLpush(ctx *gin.Context) {
+	r.push(ctx, "LPUSH")
+}
+
+func (r *Server) push(ctx *gin.Context, name string) {
+	key := ctx.Param("key")
+
+	var v ArrayEntry
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	elements := formatElements(v.Elements)
+	if name == "LPUSH" {
+		// the elements are given in the order they get in the list,
+		// but LPUSH pushes them one by one
+		slices.Reverse(elements)
+	}
+
+	reply, ok := r.execute(ctx, append([]string{name, key}, elements...)...)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ArrayLength{
+		NewLength: int(reply.(int64)),
+	})
+}
+
+func (r *Server) handlerRaddtoset(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v ArrayEntry
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := r.execute(ctx, append([]string{"RADDTOSET", key}, formatElements(v.Elements)...)...); !ok {
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (r *Server) handlerLpop(ctx *gin.Context) {
+	r.pop(ctx, "LPOP")
+}
+
+func (r *Server) handlerRpop(ctx *gin.Context) {
+	r.pop(ctx, "RPOP")
+}
+
+// pop pops a count of elements all or nothing and keeps their order,
+// so the count is turned into the segment at the side of the list.
+func (r *Server) pop(ctx *gin.Context, name string) {
+	key := ctx.Param("key")
+
+	var v PopRequest
+	if ctx.Request.ContentLength != 0 {
+		if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+	}
+
+	args := []string{name, key}
+	switch {
+	case v.Left != nil && v.Right != nil && v.Count == nil:
+		args = append(args, strconv.Itoa(*v.Left), strconv.Itoa(*v.Right))
+	case v.Left == nil && v.Right == nil && v.Count != nil:
+		count := *v.Count
+		switch {
+		case count < 0:
+			abortWithError(ctx, storage.ErrIncorrectArgs)
+			return
+		case count == 0:
+			args = append(args, "0")
+		case name == "LPOP":
+			args = append(args, "0", strconv.Itoa(count-1))
+		default:
+			args = append(args, strconv.Itoa(-count), "-1")
+		}
+	case v.Left == nil && v.Right == nil && v.Count == nil:
+	default:
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	reply, ok := r.execute(ctx, args...)
+	if !ok {
+		return
+	}
+
+	var elements []string
+	switch popped := reply.(type) {
+	case nil:
+		abortWithError(ctx, storage.ErrKeyDoesntExist)
+		return
+	case string:
+		elements = []string{popped}
+	case []string:
+		elements = popped
+	}
+
+	ctx.JSON(http.StatusOK, ArrayEntry{
+		Elements: parseElements(elements),
+	})
+}
+
+func (r *Server) handlerLset(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v IndexEntry
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := r.execute(ctx, "LSET", key, strconv.Itoa(v.Index), string(v.Value)); !ok {
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (r *Server) handlerLget(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	reply, ok := r.execute(ctx, "LGET", key, ctx.Param("index"))
+	if !ok {
+		return
+	}
+
+	index, _ := strconv.Atoi(ctx.Param("index"))
+	ctx.JSON(http.StatusOK, IndexEntry{
+		Index: index,
+		Value: ListElement(reply.(string)),
+	})
+}
+
+func (r *Server) handlerDeleteSegment(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v SegmentRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	reply, ok := r.execute(ctx, "DELETESEGMENT", key, strconv.Itoa(v.Left), strconv.Itoa(v.Right))
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ArrayEntry{
+		Elements: parseElements(reply.([]string)),
+	})
+}
+
+func (r *Server) handlerLlen(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	reply, ok := r.execute(ctx, "LLEN", key)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, CountEntry{
+		Count: int(reply.(int64)),
+	})
+}
+
+// handlerLrange returns the elements between ?start= and ?stop=, by default all of them.
+func (r *Server) handlerLrange(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	reply, ok := r.execute(ctx, "LRANGE", key, ctx.DefaultQuery("start", "0"), ctx.DefaultQuery("stop", "-1"))
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ArrayEntry{
+		Elements: parseElements(reply.([]string)),
+	})
+}
+
+func (r *Server) handlerLinsert(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v InsertRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	where := "BEFORE"
+	if v.After {
+		where = "AFTER"
+	}
+	reply, ok := r.execute(ctx, "LINSERT", key, where, string(v.Pivot), string(v.Element))
+	if !ok {
+		return
+	}
+	switch reply.(int64) {
+	case 0:
+		abortWithError(ctx, storage.ErrKeyDoesntExist)
+		return
+	case -1:
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "pivot doesnt exist",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ArrayLength{
+		NewLength: int(reply.(int64)),
+	})
+}
+
+func (r *Server) handlerLrem(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v RemoveRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	reply, ok := r.execute(ctx, "LREM", key, strconv.Itoa(v.Count), string(v.Element))
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, CountEntry{
+		Count: int(reply.(int64)),
+	})
+}
+
+func (r *Server) handlerLtrim(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v RangeRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := r.execute(ctx, "LTRIM", key, strconv.Itoa(v.Start), strconv.Itoa(v.Stop)); !ok {
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+// handlerLpos returns the indexes of the ?element=, the first one by default.
+// ?rank=, ?count= and ?maxlen= are the options of LPOS, ?count=0 returns all of them.
+func (r *Server) handlerLpos(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	args := []string{"LPOS", key, ctx.Query("element"), "COUNT", ctx.DefaultQuery("count", "1")}
+	if rank := ctx.Query("rank"); rank != "" {
+		args = append(args, "RANK", rank)
+	}
+	if maxLen := ctx.Query("maxlen"); maxLen != "" {
+		args = append(args, "MAXLEN", maxLen)
+	}
+	reply, ok := r.execute(ctx, args...)
+	if !ok {
+		return
+	}
+
+	indexes := make([]int, 0, len(reply.([]any)))
+	for _, index := range reply.([]any) {
+		indexes = append(indexes, int(index.(int64)))
+	}
+	ctx.JSON(http.StatusOK, PositionsEntry{
+		Indexes: indexes,
+	})
+}
+
+func (r *Server) handlerLmove(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v ListMoveRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil || v.Destination == "" {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	reply, ok := r.execute(ctx, "LMOVE", key, v.Destination, v.From, v.To)
+	if !ok {
+		return
+	}
+	// the source is missing or empty
+	if reply == nil {
+		abortWithError(ctx, storage.ErrKeyDoesntExist)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ElementEntry{
+		Element: ListElement(reply.(string)),
+	})
+}
+
+func (r *Server) handlerBLpop(ctx *gin.Context) {
+	r.bpop(ctx, "BLPOP")
+}
+
+func (r *Server) handlerBRpop(ctx *gin.Context) {
+	r.bpop(ctx, "BRPOP")
+}
+
+// bpop is a long poll: it replies with the popped element as soon as one of the lists has it,
+// or with 204 when the time is out.
+func (r *Server) bpop(ctx *gin.Context, name string) {
+	var v BlockingPopRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil || len(v.Keys) == 0 {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	args := append([]string{name}, v.Keys...)
+	reply, ok := r.execute(ctx, append(args, formatTimeout(v.Timeout))...)
+	if !ok {
+		return
+	}
+	if reply == nil {
+		ctx.Status(http.StatusNoContent)
+		return
+	}
+
+	popped := reply.([]string)
+	ctx.JSON(http.StatusOK, PoppedEntry{
+		Key:     popped[0],
+		Element: ListElement(popped[1]),
+	})
+}
+
+// handlerBLmove is the long poll version of handlerLmove.
+func (r *Server) handlerBLmove(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	var v BlockingMoveRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil || v.Destination == "" {
+		ctx.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	reply, ok := r.execute(ctx, "BLMOVE", key, v.Destination, v.From, v.To, formatTimeout(v.Timeout))
+	if !ok {
+		return
+	}
+	if reply == nil {
+		ctx.Status(http.StatusNoContent)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ElementEntry{
+		Element: ListElement(reply.(string)),
+	})
+}
+
+func formatTimeout(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', -1, 64)
+}
+
+// abortWithError maps storage and command errors to HTTP status codes.
+func abortWithError(ctx *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	// they wrap the storage errors, but it is an argument which is not a number
+	case errors.Is(err, command.ErrNotInteger),
+		errors.Is(err, command.ErrNotFloat):
+		status = http.StatusBadRequest
+	case errors.Is(err, storage.ErrKeyDoesntExist),
+		errors.Is(err, storage.ErrFieldDoesntExist),
+		errors.Is(err, storage.ErrMemberDoesntExist):
+		status = http.StatusNotFound
+	case errors.Is(err, storage.ErrKeyAlreadyExists),
+		errors.Is(err, storage.ErrNotInteger),
+		errors.Is(err, storage.ErrNotFloat),
+		errors.Is(err, command.ErrWatchedChange):
+		status = http.StatusConflict
+	case errors.Is(err, storage.ErrIndexOutOfRange),
+		errors.Is(err, storage.ErrIncorrectArgs),
+		errors.Is(err, storage.ErrUnsupportedValueType),
+		errors.Is(err, storage.ErrOverflow),
+		errors.Is(err, storage.ErrFloatOverflow),
+		errors.Is(err, storage.ErrStringTooLong),
+		errors.Is(err, storage.ErrInvalidDB),
+		errors.Is(err, storage.ErrTooManyDBs),
+		errors.Is(err, storage.ErrSwapDBInTx),
+		errors.Is(err, command.ErrUnknownCommand),
+		errors.Is(err, command.ErrWrongArity),
+		errors.Is(err, command.ErrSyntax),
+		errors.Is(err, command.ErrNotPositive),
+		errors.Is(err, command.ErrZeroRank),
+		errors.Is(err, command.ErrInvalidTimeout),
+		errors.Is(err, command.ErrNegativeTimeout),
+		errors.Is(err, command.ErrInvalidExpire),
+		errors.Is(err, command.ErrInvalidCursor):
+		status = http.StatusBadRequest
+	case errors.Is(err, storage.ErrOutOfMemory):
+		status = http.StatusInsufficientStorage
+	}
+
+	ctx.AbortWithStatusJSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
+
+// formatElements and parseElements convert list elements to the command arguments and back.
+func formatElements(elements []ListElement) []string {
+	items := make([]string, len(elements))
+	for i, element := range elements {
+		items[i] = string(element)
+	}
+	return items
+}
+
+func parseElements(items []string) []ListElement {
+	elements := make([]ListElement, len(items))
+	for i, item := range items {
+		elements[i] = ListElement(item)
+	}
+	return elements
+}
+
 func (r *Server) Start() {
 	err := r.newAPI().Run(r.host)
 	if err != nil {
@@ -1,12 +1,15 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"hw1/internal/pkg/storage"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -85,3 +88,979 @@ func TestSetGet(t *testing.T) {
 	}
 	assert.Equal(t, v.Value, result.Value)
 }
+
+func newTestServer(t *testing.T) *Server {
+	store, err := storage.NewStorage(time.Minute*20, time.Minute*60, "my-storage.json")
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	return New("localhost:8090", store)
+}
+
+func doRequest(t *testing.T, s *Server, method, url string, body any) *httptest.ResponseRecorder {
+	var reader *strings.Reader
+	if body != nil {
+		jsonreq, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Failed to marshal JSON: %v", err)
+		}
+		reader = strings.NewReader(string(jsonreq))
+	} else {
+		reader = strings.NewReader("")
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	s.newAPI().ServeHTTP(w, req)
+	return w
+}
+
+func decodeArray(t *testing.T, w *httptest.ResponseRecorder) []ListElement {
+	var result ArrayEntry
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	return result.Elements
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestArrayPush(t *testing.T) {
+	s := newTestServer(t)
+
+	w := doRequest(t, s, http.MethodPost, "/array/rpush/list", ArrayEntry{Elements: []ListElement{"1", "2"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var length ArrayLength
+	json.NewDecoder(w.Body).Decode(&length)
+	assert.Equal(t, 2, length.NewLength)
+
+	w = doRequest(t, s, http.MethodPost, "/array/lpush/list", ArrayEntry{Elements: []ListElement{"0"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.NewDecoder(w.Body).Decode(&length)
+	assert.Equal(t, 3, length.NewLength)
+
+	w = doRequest(t, s, http.MethodPost, "/array/rpop/list", PopRequest{Count: intPtr(3)})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []ListElement{"0", "1", "2"}, decodeArray(t, w))
+
+	w = doRequest(t, s, http.MethodPost, "/array/rpush/list", ArrayEntry{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodPut, "/scalar/set/scalar", Entry{Value: "1"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(t, s, http.MethodPost, "/array/lpush/scalar", ArrayEntry{Elements: []ListElement{"1"}})
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestArrayPop(t *testing.T) {
+	s := newTestServer(t)
+
+	w := doRequest(t, s, http.MethodPost, "/array/lpop/list", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	doRequest(t, s, http.MethodPost, "/array/rpush/list", ArrayEntry{Elements: []ListElement{"1", "2", "3", "4", "5", "6"}})
+
+	w = doRequest(t, s, http.MethodPost, "/array/lpop/list", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []ListElement{"1"}, decodeArray(t, w))
+
+	w = doRequest(t, s, http.MethodPost, "/array/rpop/list", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []ListElement{"6"}, decodeArray(t, w))
+
+	w = doRequest(t, s, http.MethodPost, "/array/lpop/list", PopRequest{Count: intPtr(2)})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []ListElement{"2", "3"}, decodeArray(t, w))
+
+	w = doRequest(t, s, http.MethodPost, "/array/rpop/list", PopRequest{Count: intPtr(5)})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodPost, "/array/rpop/list", PopRequest{Left: intPtr(0), Right: intPtr(0)})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []ListElement{"4"}, decodeArray(t, w))
+
+	w = doRequest(t, s, http.MethodPost, "/array/lpop/list", PopRequest{Count: intPtr(1), Left: intPtr(0)})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestArrayLsetLget(t *testing.T) {
+	s := newTestServer(t)
+
+	w := doRequest(t, s, http.MethodPut, "/array/lset/list", IndexEntry{Index: 0, Value: "1"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	doRequest(t, s, http.MethodPost, "/array/rpush/list", ArrayEntry{Elements: []ListElement{"1", "2", "3"}})
+
+	w = doRequest(t, s, http.MethodPut, "/array/lset/list", IndexEntry{Index: 1, Value: "20"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(t, s, http.MethodGet, "/array/lget/list/1", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result IndexEntry
+	json.NewDecoder(w.Body).Decode(&result)
+	assert.Equal(t, IndexEntry{Index: 1, Value: "20"}, result)
+
+	w = doRequest(t, s, http.MethodPut, "/array/lset/list", IndexEntry{Index: 3, Value: "20"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodGet, "/array/lget/list/3", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodGet, "/array/lget/list/abc", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodGet, "/array/lget/nolist/0", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	doRequest(t, s, http.MethodPut, "/scalar/set/scalar", Entry{Value: "1"})
+	w = doRequest(t, s, http.MethodPut, "/array/lset/scalar", IndexEntry{Index: 0, Value: "1"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestArrayRaddtoset(t *testing.T) {
+	s := newTestServer(t)
+
+	w := doRequest(t, s, http.MethodPost, "/array/raddtoset/list", ArrayEntry{Elements: []ListElement{"1"}})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	doRequest(t, s, http.MethodPost, "/array/rpush/list", ArrayEntry{Elements: []ListElement{"1", "2"}})
+
+	w = doRequest(t, s, http.MethodPost, "/array/raddtoset/list", ArrayEntry{Elements: []ListElement{"2", "3", "1", "4"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(t, s, http.MethodPost, "/array/lpop/list", PopRequest{Count: intPtr(4)})
+	assert.Equal(t, []ListElement{"1", "2", "3", "4"}, decodeArray(t, w))
+}
+
+func TestArrayDeleteSegment(t *testing.T) {
+	s := newTestServer(t)
+
+	w := doRequest(t, s, http.MethodPost, "/array/deletesegment/list", SegmentRequest{Left: 0, Right: 1})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	doRequest(t, s, http.MethodPost, "/array/rpush/list", ArrayEntry{Elements: []ListElement{"1", "2", "3", "4", "5"}})
+
+	w = doRequest(t, s, http.MethodPost, "/array/deletesegment/list", SegmentRequest{Left: 1, Right: -2})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []ListElement{"2", "3", "4"}, decodeArray(t, w))
+
+	w = doRequest(t, s, http.MethodPost, "/array/deletesegment/list", SegmentRequest{Left: 1, Right: 0})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodPost, "/array/lpop/list", PopRequest{Count: intPtr(2)})
+	assert.Equal(t, []ListElement{"1", "5"}, decodeArray(t, w))
+}
+
+func TestArrayEditing(t *testing.T) {
+	s := newTestServer(t)
+
+	doRequest(t, s, http.MethodPost, "/array/rpush/queue", ArrayEntry{Elements: []ListElement{"a", "b", "a", "c", "d"}})
+
+	w := doRequest(t, s, http.MethodGet, "/array/range/queue?start=1&stop=-2", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []ListElement{"b", "a", "c"}, decodeArray(t, w))
+	w = doRequest(t, s, http.MethodGet, "/array/lget/queue/-1", nil)
+	assert.JSONEq(t, `{"index":-1,"value":"d"}`, w.Body.String())
+
+	w = doRequest(t, s, http.MethodPost, "/array/insert/queue", InsertRequest{Pivot: "b", Element: "x", After: true})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"new_length":6}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPost, "/array/insert/queue", InsertRequest{Pivot: "z", Element: "x"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(t, s, http.MethodGet, "/array/pos/queue?element=a&count=0", nil)
+	assert.JSONEq(t, `{"indexes":[0,3]}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/array/pos/queue?element=a&rank=-1", nil)
+	assert.JSONEq(t, `{"indexes":[3]}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/array/pos/queue?element=a&rank=0", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodPost, "/array/rem/queue", RemoveRequest{Count: 0, Element: "a"})
+	assert.JSONEq(t, `{"count":2}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPost, "/array/trim/queue", RangeRequest{Start: 0, Stop: 2})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(t, s, http.MethodGet, "/array/len/queue", nil)
+	assert.JSONEq(t, `{"count":3}`, w.Body.String())
+
+	w = doRequest(t, s, http.MethodPost, "/array/move/queue", ListMoveRequest{Destination: "done", From: "left", To: "right"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"element":"b"}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/array/range/done", nil)
+	assert.Equal(t, []ListElement{"b"}, decodeArray(t, w))
+	w = doRequest(t, s, http.MethodPost, "/array/move/missing", ListMoveRequest{Destination: "done", From: "left", To: "right"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(t, s, http.MethodPost, "/array/move/queue", ListMoveRequest{Destination: "done", From: "up", To: "right"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodGet, "/array/range/missing", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, decodeArray(t, w))
+	doRequest(t, s, http.MethodPut, "/scalar/set/scalar", Entry{Value: "1"})
+	w = doRequest(t, s, http.MethodGet, "/array/len/scalar", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestArrayLongPoll(t *testing.T) {
+	s := newTestServer(t)
+
+	doRequest(t, s, http.MethodPost, "/array/rpush/queue", ArrayEntry{Elements: []ListElement{"a", "b"}})
+	w := doRequest(t, s, http.MethodPost, "/array/blpop", BlockingPopRequest{Keys: []string{"missing", "queue"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"key":"queue","element":"a"}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPost, "/array/blmove/queue", BlockingMoveRequest{Destination: "done", From: "left", To: "right"})
+	assert.JSONEq(t, `{"element":"b"}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPost, "/array/brpop", BlockingPopRequest{Keys: []string{"queue"}, Timeout: 0.01})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doRequest(t, s, http.MethodPost, "/array/blmove/queue", BlockingMoveRequest{Destination: "done", From: "left", To: "right", Timeout: 0.01})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// the poll is answered by a push
+	polled := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		polled <- doRequest(t, s, http.MethodPost, "/array/brpop", BlockingPopRequest{Keys: []string{"jobs"}, Timeout: 5})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	doRequest(t, s, http.MethodPost, "/array/rpush/jobs", ArrayEntry{Elements: []ListElement{"1"}})
+	w = <-polled
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"key":"jobs","element":1}`, w.Body.String())
+
+	// the client going away stops the poll
+	reqCtx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, "/array/blpop", strings.NewReader(`{"keys":["jobs"]}`))
+	assert.NoError(t, err)
+	s.newAPI().ServeHTTP(httptest.NewRecorder(), req)
+	assert.ErrorIs(t, reqCtx.Err(), context.DeadlineExceeded)
+	doRequest(t, s, http.MethodPost, "/array/rpush/jobs", ArrayEntry{Elements: []ListElement{"2"}})
+	w = doRequest(t, s, http.MethodGet, "/array/len/jobs", nil)
+	assert.JSONEq(t, `{"count":1}`, w.Body.String())
+
+	w = doRequest(t, s, http.MethodPost, "/array/blpop", BlockingPopRequest{Keys: []string{"jobs"}, Timeout: -1})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doRequest(t, s, http.MethodPost, "/array/blpop", BlockingPopRequest{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doRequest(t, s, http.MethodPost, "/array/blmove/jobs", BlockingMoveRequest{Destination: "done", From: "up", To: "right"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestArrayStrings(t *testing.T) {
+	s := newTestServer(t)
+
+	// the elements are strings or integers, the integers are written back as numbers
+	w := doRequest(t, s, http.MethodPost, "/array/rpush/list", json.RawMessage(`{"elements":[1,"job:2","3","007"]}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(t, s, http.MethodPut, "/array/lset/list", json.RawMessage(`{"index":0,"value":"{\"id\":1}"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(t, s, http.MethodGet, "/array/lget/list/0", nil)
+	assert.JSONEq(t, `{"index":0,"value":"{\"id\":1}"}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPost, "/array/lpop/list", PopRequest{Count: intPtr(4)})
+	assert.JSONEq(t, `{"elements":["{\"id\":1}","job:2",3,"007"]}`, w.Body.String())
+
+	w = doRequest(t, s, http.MethodPost, "/array/rpush/list", json.RawMessage(`{"elements":[1.5]}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func decodeTTL(t *testing.T, w *httptest.ResponseRecorder) int64 {
+	var result TTLEntry
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	return result.TTL
+}
+
+func decodeResult(t *testing.T, w *httptest.ResponseRecorder) bool {
+	var result ResultEntry
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	return result.Result
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func TestSetWithExpiration(t *testing.T) {
+	s := newTestServer(t)
+
+	w := doRequest(t, s, http.MethodPut, "/scalar/set/ex", Entry{Value: "v", Ex: 100})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(t, s, http.MethodGet, "/key/ttl/ex", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(100), decodeTTL(t, w))
+
+	w = doRequest(t, s, http.MethodPut, "/scalar/set/px", Entry{Value: "v", Px: 50})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(t, s, http.MethodGet, "/key/pttl/px", nil)
+	pttl := decodeTTL(t, w)
+	assert.True(t, pttl > 0 && pttl <= 50, "pttl = %d", pttl)
+
+	time.Sleep(100 * time.Millisecond)
+	w = doRequest(t, s, http.MethodGet, "/scalar/get/px", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(t, s, http.MethodPut, "/scalar/set/both", Entry{Value: "v", Ex: 1, Px: 1})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodPut, "/scalar/set/negative", Entry{Value: "v", Ex: -1})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestExpireTTLPersist(t *testing.T) {
+	s := newTestServer(t)
+
+	w := doRequest(t, s, http.MethodGet, "/key/ttl/key", nil)
+	assert.Equal(t, int64(-2), decodeTTL(t, w))
+
+	w = doRequest(t, s, http.MethodPost, "/key/expire/key", ExpireRequest{Ex: int64Ptr(10)})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, decodeResult(t, w))
+
+	doRequest(t, s, http.MethodPut, "/scalar/set/key", Entry{Value: "v"})
+	w = doRequest(t, s, http.MethodGet, "/key/ttl/key", nil)
+	assert.Equal(t, int64(-1), decodeTTL(t, w))
+
+	w = doRequest(t, s, http.MethodPost, "/key/expire/key", ExpireRequest{Ex: int64Ptr(10)})
+	assert.True(t, decodeResult(t, w))
+	w = doRequest(t, s, http.MethodGet, "/key/ttl/key", nil)
+	assert.Equal(t, int64(10), decodeTTL(t, w))
+
+	w = doRequest(t, s, http.MethodPost, "/key/expire/key", ExpireRequest{Px: int64Ptr(20000)})
+	assert.True(t, decodeResult(t, w))
+	w = doRequest(t, s, http.MethodGet, "/key/ttl/key", nil)
+	assert.Equal(t, int64(20), decodeTTL(t, w))
+
+	w = doRequest(t, s, http.MethodPost, "/key/expire/key", ExpireRequest{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 0 removes the expiration and keeps the key
+	w = doRequest(t, s, http.MethodPost, "/key/expire/key", ExpireRequest{Ex: int64Ptr(0)})
+	assert.True(t, decodeResult(t, w))
+	w = doRequest(t, s, http.MethodGet, "/key/ttl/key", nil)
+	assert.Equal(t, int64(-1), decodeTTL(t, w))
+	w = doRequest(t, s, http.MethodPost, "/key/expire/missing", ExpireRequest{Px: int64Ptr(0)})
+	assert.False(t, decodeResult(t, w))
+	// like PERSIST, false if the key has no expiration
+	w = doRequest(t, s, http.MethodPost, "/key/expire/key", ExpireRequest{Ex: int64Ptr(0)})
+	assert.False(t, decodeResult(t, w))
+	w = doRequest(t, s, http.MethodPost, "/key/expire/key", ExpireRequest{Ex: int64Ptr(9223372036854775)})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doRequest(t, s, http.MethodPost, "/key/expire/key", ExpireRequest{Ex: int64Ptr(10)})
+	assert.True(t, decodeResult(t, w))
+
+	w = doRequest(t, s, http.MethodPost, "/key/persist/key", nil)
+	assert.True(t, decodeResult(t, w))
+	w = doRequest(t, s, http.MethodPost, "/key/persist/key", nil)
+	assert.False(t, decodeResult(t, w))
+	w = doRequest(t, s, http.MethodGet, "/key/pttl/key", nil)
+	assert.Equal(t, int64(-1), decodeTTL(t, w))
+}
+
+func TestExpireStats(t *testing.T) {
+	s := newTestServer(t)
+
+	for i := 0; i < 3; i++ {
+		w := doRequest(t, s, http.MethodPut, "/scalar/set/key"+strconv.Itoa(i), Entry{Value: "value", Px: 1})
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	time.Sleep(5 * time.Millisecond)
+	s.storage.GarbageCollect()
+
+	w := doRequest(t, s, http.MethodGet, "/stats/expire", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stats storage.ExpireStats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	assert.Equal(t, int64(1), stats.Cycles)
+	assert.Equal(t, int64(3), stats.Reclaimed)
+	assert.Equal(t, 0, stats.Tracked)
+}
+
+func TestMemoryLimit(t *testing.T) {
+	s := newTestServer(t)
+	assert.NoError(t, s.storage.SetMaxMemory(1, storage.NoEviction))
+
+	w := doRequest(t, s, http.MethodPut, "/scalar/set/key", Entry{Value: "value"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(t, s, http.MethodPut, "/scalar/set/key2", Entry{Value: "value"})
+	assert.Equal(t, http.StatusInsufficientStorage, w.Code)
+	w = doRequest(t, s, http.MethodPost, "/array/rpush/list", ArrayEntry{Elements: []ListElement{"1"}})
+	assert.Equal(t, http.StatusInsufficientStorage, w.Code)
+
+	w = doRequest(t, s, http.MethodGet, "/stats/memory", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stats storage.MemoryStats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	assert.Equal(t, int64(1), stats.Max)
+	assert.Equal(t, storage.NoEviction, stats.Policy)
+	assert.Greater(t, stats.Used, int64(1))
+}
+
+func decodeCount(t *testing.T, w *httptest.ResponseRecorder) int {
+	var result CountEntry
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	return result.Count
+}
+
+func TestHash(t *testing.T) {
+	s := newTestServer(t)
+
+	w := doRequest(t, s, http.MethodGet, "/hash/get/user/name", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(t, s, http.MethodPut, "/hash/set/user", HashEntry{Fields: map[string]string{"name": "bob", "age": "20"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, decodeCount(t, w))
+
+	w = doRequest(t, s, http.MethodPut, "/hash/set/user", HashEntry{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodGet, "/hash/get/user/name", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var entry Entry
+	json.NewDecoder(w.Body).Decode(&entry)
+	assert.Equal(t, "bob", entry.Value)
+
+	w = doRequest(t, s, http.MethodGet, "/hash/get/user/city", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(t, s, http.MethodGet, "/hash/len/user", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, decodeCount(t, w))
+
+	w = doRequest(t, s, http.MethodGet, "/hash/getall/user", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var hash HashEntry
+	json.NewDecoder(w.Body).Decode(&hash)
+	assert.Equal(t, map[string]string{"name": "bob", "age": "20"}, hash.Fields)
+
+	w = doRequest(t, s, http.MethodPost, "/hash/del/user", HashFields{Fields: []string{"age", "city"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, decodeCount(t, w))
+
+	doRequest(t, s, http.MethodPut, "/scalar/set/scalar", Entry{Value: "1"})
+	w = doRequest(t, s, http.MethodPut, "/hash/set/scalar", HashEntry{Fields: map[string]string{"a": "b"}})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = doRequest(t, s, http.MethodPut, "/scalar/set/user", Entry{Value: "1"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestKeys(t *testing.T) {
+	s := newTestServer(t)
+
+	doRequest(t, s, http.MethodPut, "/scalar/set/user:1", Entry{Value: "bob"})
+	doRequest(t, s, http.MethodPut, "/scalar/set/user:2", Entry{Value: "alice"})
+	doRequest(t, s, http.MethodPost, "/array/rpush/users", ArrayEntry{Elements: []ListElement{"1"}})
+
+	var result KeysEntry
+	w := doRequest(t, s, http.MethodGet, "/keys?pattern=user:*", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.NewDecoder(w.Body).Decode(&result)
+	assert.Equal(t, []string{"user:1", "user:2"}, result.Keys)
+
+	w = doRequest(t, s, http.MethodGet, "/keys?regexp=s$", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.NewDecoder(w.Body).Decode(&result)
+	assert.Equal(t, []string{"users"}, result.Keys)
+
+	w = doRequest(t, s, http.MethodGet, "/keys", nil)
+	json.NewDecoder(w.Body).Decode(&result)
+	assert.Equal(t, []string{"user:1", "user:2", "users"}, result.Keys)
+
+	w = doRequest(t, s, http.MethodGet, "/keys?regexp=(", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestScan(t *testing.T) {
+	s := newTestServer(t)
+
+	for i := 0; i < 30; i++ {
+		doRequest(t, s, http.MethodPut, "/scalar/set/key"+strconv.Itoa(i), Entry{Value: "v"})
+	}
+	doRequest(t, s, http.MethodPost, "/array/rpush/list", ArrayEntry{Elements: []ListElement{"1"}})
+
+	seen := make(map[string]bool)
+	cursor := "0"
+	for {
+		w := doRequest(t, s, http.MethodGet, "/scan?count=4&type=string&cursor="+cursor, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var result ScanEntry
+		json.NewDecoder(w.Body).Decode(&result)
+		for _, key := range result.Keys {
+			seen[key] = true
+		}
+		if result.Cursor == "0" {
+			break
+		}
+		cursor = result.Cursor
+	}
+	assert.Len(t, seen, 30)
+	assert.False(t, seen["list"])
+
+	w := doRequest(t, s, http.MethodGet, "/scan?cursor=abc", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodGet, "/scan?type=unknown", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	s := newTestServer(t)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			key := "key" + strconv.Itoa(worker%2)
+			for i := 0; i < 50; i++ {
+				doRequest(t, s, http.MethodPut, "/scalar/set/"+key, Entry{Value: strconv.Itoa(i)})
+				doRequest(t, s, http.MethodGet, "/scalar/get/"+key, nil)
+				doRequest(t, s, http.MethodPost, "/array/rpush/list", ArrayEntry{Elements: []ListElement{ListElement(strconv.Itoa(i))}})
+				doRequest(t, s, http.MethodPost, "/array/lpop/list", nil)
+				doRequest(t, s, http.MethodGet, "/keys", nil)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+func TestCommand(t *testing.T) {
+	s := newTestServer(t)
+
+	w := doRequest(t, s, http.MethodPost, "/cmd", []string{"RPUSH", "cmdlist", "1", "2", "3"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"result":3}`, w.Body.String())
+
+	w = doRequest(t, s, http.MethodPost, "/cmd", []string{"lpop", "cmdlist", "2"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"result":["1","2"]}`, w.Body.String())
+
+	// the HTTP routes go through the same commands
+	w = doRequest(t, s, http.MethodPost, "/array/lpop/cmdlist", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"elements":[3]}`, w.Body.String())
+
+	w = doRequest(t, s, http.MethodPost, "/cmd", []string{"GET", "cmdmissing"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"result":null}`, w.Body.String())
+
+	w = doRequest(t, s, http.MethodPost, "/cmd", []string{"NOSUCH"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodPost, "/cmd", []string{"GET"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodPost, "/cmd", []string{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// an argument which is not a number is a bad request, a stored value which is not is a conflict
+	w = doRequest(t, s, http.MethodPost, "/cmd", []string{"INCRBY", "cmdcounter", "x"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	doRequest(t, s, http.MethodPost, "/cmd", []string{"SET", "cmdcounter", "x"})
+	w = doRequest(t, s, http.MethodPost, "/cmd", []string{"INCRBY", "cmdcounter", "1"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestTransaction(t *testing.T) {
+	s := newTestServer(t)
+
+	w := doRequest(t, s, http.MethodPost, "/tx", TxRequest{
+		Commands: [][]string{{"SET", "txkey", "1"}, {"LPUSH", "txkey", "1"}, {"GET", "txkey"}},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"results":[{"result":"OK"},{"result":null,"error":"key already exists"},{"result":"1"}]}`, w.Body.String())
+
+	// a rejected command discards the whole transaction
+	w = doRequest(t, s, http.MethodPost, "/tx", TxRequest{
+		Commands: [][]string{{"SET", "txkey", "2"}, {"NOSUCH"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodPost, "/tx/watch", WatchRequest{Keys: []string{"txkey"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var watched WatchEntry
+	json.NewDecoder(w.Body).Decode(&watched)
+
+	tx := TxRequest{
+		Watch:    watched.Versions,
+		Commands: [][]string{{"SET", "txkey", "3"}},
+	}
+	w = doRequest(t, s, http.MethodPost, "/tx", tx)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the first transaction changed the watched key
+	w = doRequest(t, s, http.MethodPost, "/tx", tx)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = doRequest(t, s, http.MethodGet, "/scalar/get/txkey", nil)
+	assert.JSONEq(t, `{"value":"3","type":"int"}`, w.Body.String())
+
+	w = doRequest(t, s, http.MethodPost, "/tx", TxRequest{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestIncrDecr(t *testing.T) {
+	s := newTestServer(t)
+
+	w := doRequest(t, s, http.MethodPost, "/scalar/incr/counter", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"value":1}`, w.Body.String())
+
+	by := int64(10)
+	w = doRequest(t, s, http.MethodPost, "/scalar/decr/counter", IncrRequest{By: &by})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"value":-9}`, w.Body.String())
+
+	w = doRequest(t, s, http.MethodGet, "/scalar/get/counter", nil)
+	assert.JSONEq(t, `{"value":"-9","type":"int"}`, w.Body.String())
+
+	doRequest(t, s, http.MethodPut, "/scalar/set/counter", Entry{Value: "text"})
+	w = doRequest(t, s, http.MethodPost, "/scalar/incr/counter", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	doRequest(t, s, http.MethodPut, "/scalar/set/counter", Entry{Value: "9223372036854775807"})
+	w = doRequest(t, s, http.MethodPost, "/scalar/incr/counter", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodPost, "/scalar/incr/counter", "1")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestStringCommands(t *testing.T) {
+	s := newTestServer(t)
+
+	w := doRequest(t, s, http.MethodPost, "/scalar/append/str", Entry{Value: "Hello"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"length":5}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPost, "/scalar/append/str", Entry{Value: " World"})
+	assert.JSONEq(t, `{"length":11}`, w.Body.String())
+
+	w = doRequest(t, s, http.MethodGet, "/scalar/strlen/str", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"length":11}`, w.Body.String())
+
+	w = doRequest(t, s, http.MethodGet, "/scalar/getrange/str?start=-5", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"value":"World"}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/scalar/getrange/str?start=0&end=x", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodPost, "/scalar/setrange/str", SetRangeRequest{Offset: 6, Value: "Redis"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"length":11}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPost, "/scalar/setrange/str", SetRangeRequest{Offset: -1, Value: "x"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodPost, "/scalar/getset/str", Entry{Value: "new"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"value":"Hello Redis"}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPost, "/scalar/getset/other", Entry{Value: "new"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"value":null}`, w.Body.String())
+
+	w = doRequest(t, s, http.MethodPost, "/scalar/getdel/str", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"value":"new"}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPost, "/scalar/getdel/str", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	doRequest(t, s, http.MethodPost, "/array/rpush/strlist", ArrayEntry{Elements: []ListElement{"1"}})
+	w = doRequest(t, s, http.MethodGet, "/scalar/strlen/strlist", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestSetTyped(t *testing.T) {
+	s := newTestServer(t)
+
+	for _, tc := range []struct {
+		set      Entry
+		expected string
+	}{
+		{Entry{Value: "007"}, `{"value":"007","type":"string"}`},
+		{Entry{Value: "42"}, `{"value":"42","type":"int"}`},
+		{Entry{Value: "42", Type: "string"}, `{"value":"42","type":"string"}`},
+		{Entry{Value: "007", Type: "int"}, `{"value":"7","type":"int"}`},
+		{Entry{Value: "text", Type: "auto", Ex: 100}, `{"value":"text","type":"string"}`},
+	} {
+		w := doRequest(t, s, http.MethodPut, "/scalar/set/typed", tc.set)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = doRequest(t, s, http.MethodGet, "/scalar/get/typed", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, tc.expected, w.Body.String())
+	}
+
+	w := doRequest(t, s, http.MethodPut, "/scalar/set/typed", Entry{Value: "text", Type: "int"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doRequest(t, s, http.MethodPut, "/scalar/set/typed", Entry{Value: "text", Type: "float"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	doRequest(t, s, http.MethodPost, "/array/rpush/typedlist", ArrayEntry{Elements: []ListElement{"1"}})
+	w = doRequest(t, s, http.MethodGet, "/scalar/get/typedlist", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestFloatAndBinary(t *testing.T) {
+	s := newTestServer(t)
+
+	w := doRequest(t, s, http.MethodPost, "/scalar/incrbyfloat/float", IncrByFloatRequest{By: 1.25})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"value":1.25}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/scalar/get/float", nil)
+	assert.JSONEq(t, `{"value":"1.25","type":"float"}`, w.Body.String())
+
+	doRequest(t, s, http.MethodPut, "/scalar/set/float", Entry{Value: "text"})
+	w = doRequest(t, s, http.MethodPost, "/scalar/incrbyfloat/float", IncrByFloatRequest{By: 1})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = doRequest(t, s, http.MethodPut, "/scalar/set/float", Entry{Value: "text", Type: "float"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// binary values are base64 in JSON
+	w = doRequest(t, s, http.MethodPut, "/scalar/set/binary", Entry{Value: "AP8=", Type: "binary"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(t, s, http.MethodGet, "/scalar/get/binary", nil)
+	assert.JSONEq(t, `{"value":"AP8=","type":"binary"}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPut, "/scalar/set/binary", Entry{Value: "not base64", Type: "binary"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// and raw bytes with application/octet-stream
+	req, _ := http.NewRequest(http.MethodPut, "/scalar/set/raw?ex=100", strings.NewReader("\x00\x01\xff"))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	w = httptest.NewRecorder()
+	s.newAPI().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/scalar/get/raw", nil)
+	req.Header.Set("Accept", "application/octet-stream")
+	w = httptest.NewRecorder()
+	s.newAPI().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "\x00\x01\xff", w.Body.String())
+	assert.Equal(t, "binary", w.Header().Get("X-Value-Type"))
+
+	w = doRequest(t, s, http.MethodGet, "/scalar/get/raw", nil)
+	assert.JSONEq(t, `{"value":"AAH/","type":"binary"}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/key/ttl/raw", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, `{"ttl":-1}`, w.Body.String())
+
+	// an invalid expiration is rejected, not ignored
+	for _, query := range []string{"ex=abc", "px=1.5"} {
+		req, _ = http.NewRequest(http.MethodPut, "/scalar/set/invalid?"+query, strings.NewReader("\x00"))
+		req.Header.Set("Content-Type", "application/octet-stream")
+		w = httptest.NewRecorder()
+		s.newAPI().ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+	w = doRequest(t, s, http.MethodGet, "/scalar/get/invalid", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestKeyspace(t *testing.T) {
+	s := newTestServer(t)
+
+	w := doRequest(t, s, http.MethodPost, "/keys/mset", MSetRequest{Values: map[string]string{"ks1": "1", "ks2": "two"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	doRequest(t, s, http.MethodPost, "/array/rpush/kslist", ArrayEntry{Elements: []ListElement{"1", "2"}})
+	w = doRequest(t, s, http.MethodPost, "/keys/mset", MSetRequest{Values: map[string]string{"ks3": "3", "kslist": "x"}})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = doRequest(t, s, http.MethodPost, "/keys/mget", KeysEntry{Keys: []string{"ks1", "ks2", "ks3", "kslist"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"values":["1","two",null,null]}`, w.Body.String())
+
+	w = doRequest(t, s, http.MethodPost, "/keys/exists", KeysEntry{Keys: []string{"ks1", "ks3", "kslist"}})
+	assert.JSONEq(t, `{"count":2}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPost, "/keys/type", KeysEntry{Keys: []string{"ks1", "ks3", "kslist"}})
+	assert.JSONEq(t, `{"types":{"ks1":"string","ks3":"none","kslist":"list"}}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/key/type/kslist", nil)
+	assert.JSONEq(t, `{"type":"list"}`, w.Body.String())
+
+	ex := int64(100)
+	doRequest(t, s, http.MethodPost, "/key/expire/ks1", ExpireRequest{Ex: &ex})
+	w = doRequest(t, s, http.MethodPost, "/key/rename/ks1", MoveRequest{To: "ksrenamed"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(t, s, http.MethodGet, "/key/ttl/ksrenamed", nil)
+	assert.JSONEq(t, `{"ttl":100}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPost, "/key/rename/ks1", MoveRequest{To: "ksrenamed"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(t, s, http.MethodPost, "/key/rename/ks2", MoveRequest{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodPost, "/key/copy/kslist", MoveRequest{To: "ks2"})
+	assert.JSONEq(t, `{"result":false}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPost, "/key/copy/kslist", MoveRequest{To: "ks2", Replace: true})
+	assert.JSONEq(t, `{"result":true}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/array/lget/ks2/1", nil)
+	assert.JSONEq(t, `{"index":1,"value":2}`, w.Body.String())
+
+	w = doRequest(t, s, http.MethodPost, "/keys/del", KeysEntry{Keys: []string{"ks2", "ksrenamed", "ks3"}})
+	assert.JSONEq(t, `{"count":2}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPost, "/keys/del", KeysEntry{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSets(t *testing.T) {
+	s := newTestServer(t)
+
+	w := doRequest(t, s, http.MethodPut, "/set/add/tags", json.RawMessage(`{"members":["go","db",1,"go"]}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"count":3}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPut, "/set/add/tags", json.RawMessage(`{"members":[1.5]}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doRequest(t, s, http.MethodGet, "/set/members/tags", nil)
+	assert.JSONEq(t, `{"members":["1","db","go"]}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/set/ismember/tags/1", nil)
+	assert.JSONEq(t, `{"result":true}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/set/card/tags", nil)
+	assert.JSONEq(t, `{"count":3}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/set/randmember/tags?count=-4", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, decodeSet(t, w), 4)
+
+	doRequest(t, s, http.MethodPut, "/set/add/other", SetRequest{Members: []SetMember{"db", "sql"}})
+	w = doRequest(t, s, http.MethodPost, "/set/inter", KeysEntry{Keys: []string{"tags", "other"}})
+	assert.JSONEq(t, `{"members":["db"]}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPost, "/set/diff", KeysEntry{Keys: []string{"tags", "other"}})
+	assert.JSONEq(t, `{"members":["1","go"]}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPost, "/set/unionstore/all", KeysEntry{Keys: []string{"tags", "other"}})
+	assert.JSONEq(t, `{"count":4}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/key/type/all", nil)
+	assert.JSONEq(t, `{"type":"set"}`, w.Body.String())
+
+	w = doRequest(t, s, http.MethodPost, "/set/rem/other", SetRequest{Members: []SetMember{"db", "missing"}})
+	assert.JSONEq(t, `{"count":1}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPost, "/set/pop/other", nil)
+	assert.JSONEq(t, `{"members":["sql"]}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/set/members/other", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(t, s, http.MethodPost, "/set/pop/all", PopRequest{Count: intPtr(10)})
+	assert.Len(t, decodeSet(t, w), 4)
+
+	doRequest(t, s, http.MethodPut, "/scalar/set/sstring", Entry{Value: "value"})
+	w = doRequest(t, s, http.MethodPut, "/set/add/sstring", SetRequest{Members: []SetMember{"a"}})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = doRequest(t, s, http.MethodPost, "/set/union", KeysEntry{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func decodeSet(t *testing.T, w *httptest.ResponseRecorder) []string {
+	var entry SetEntry
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+	return entry.Members
+}
+
+func TestSortedSets(t *testing.T) {
+	s := newTestServer(t)
+
+	w := doRequest(t, s, http.MethodPut, "/zset/add/board", ZAddRequest{Members: map[string]float64{"alice": 10, "bob": 20, "carol": 15}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"count":3}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPut, "/zset/add/board", ZAddRequest{Members: map[string]float64{"alice": 5, "dave": 1}, GT: true, CH: true})
+	assert.JSONEq(t, `{"count":1}`, w.Body.String())
+	w = doRequest(t, s, http.MethodPost, "/zset/incrby/board", ZIncrByRequest{Member: "alice", By: 12.5})
+	assert.JSONEq(t, `{"score":22.5}`, w.Body.String())
+
+	w = doRequest(t, s, http.MethodGet, "/zset/range/board?start=0&stop=1", nil)
+	assert.JSONEq(t, `{"members":[{"member":"dave","score":1},{"member":"carol","score":15}]}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/zset/range/board?rev=true&stop=0", nil)
+	assert.JSONEq(t, `{"members":[{"member":"alice","score":22.5}]}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/zset/rangebyscore/board?min=(1&max=20", nil)
+	assert.JSONEq(t, `{"members":[{"member":"carol","score":15},{"member":"bob","score":20}]}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/zset/rangebyscore/board?rev=true&count=1", nil)
+	assert.JSONEq(t, `{"members":[{"member":"alice","score":22.5}]}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/zset/rangebyscore/board?min=x", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(t, s, http.MethodGet, "/zset/rank/board/bob", nil)
+	assert.JSONEq(t, `{"rank":2}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/zset/rank/board/bob?rev=true", nil)
+	assert.JSONEq(t, `{"rank":1}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/zset/score/board/carol", nil)
+	assert.JSONEq(t, `{"score":15}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/zset/score/board/nobody", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(t, s, http.MethodPost, "/zset/rem/board", ZMembersRequest{Members: []string{"dave", "nobody"}})
+	assert.JSONEq(t, `{"count":1}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/zset/card/board", nil)
+	assert.JSONEq(t, `{"count":3}`, w.Body.String())
+	w = doRequest(t, s, http.MethodGet, "/zset/card/missing", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(t, s, http.MethodGet, "/key/type/board", nil)
+	assert.JSONEq(t, `{"type":"zset"}`, w.Body.String())
+
+	doRequest(t, s, http.MethodPut, "/scalar/set/zstring", Entry{Value: "value"})
+	w = doRequest(t, s, http.MethodPut, "/zset/add/zstring", ZAddRequest{Members: map[string]float64{"a": 1}})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = doRequest(t, s, http.MethodPut, "/zset/add/board", ZAddRequest{Members: map[string]float64{"a": 1}, NX: true, XX: true})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDatabases(t *testing.T) {
+	s := newTestServer(t)
+	api := s.newAPI()
+
+	doDB := func(method, url, db string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if db != "" {
+			req.Header.Set("X-DB", db)
+		}
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w
+	}
+
+	w := doDB(http.MethodPut, "/scalar/set/dbkey", "", `{"value":"default"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doDB(http.MethodPut, "/scalar/set/dbkey", "tenant", `{"value":"header"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the header and the path prefix choose the same database
+	w = doDB(http.MethodGet, "/db/tenant/scalar/get/dbkey", "", "")
+	assert.JSONEq(t, `{"value":"header","type":"string"}`, w.Body.String())
+	w = doDB(http.MethodGet, "/scalar/get/dbkey", "", "")
+	assert.JSONEq(t, `{"value":"default","type":"string"}`, w.Body.String())
+	w = doDB(http.MethodGet, "/db/tenant/dbsize", "", "")
+	assert.JSONEq(t, `{"size":1}`, w.Body.String())
+	w = doDB(http.MethodPost, "/db/tenant/cmd", "", `["DBSIZE"]`)
+	assert.JSONEq(t, `{"result":1}`, w.Body.String())
+
+	w = doDB(http.MethodGet, "/databases", "", "")
+	assert.JSONEq(t, `{"databases":["0","tenant"]}`, w.Body.String())
+	w = doDB(http.MethodGet, "/db/no%20space/dbsize", "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doDB(http.MethodPost, "/swapdb", "", `{"first":"0","second":"tenant"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doDB(http.MethodGet, "/scalar/get/dbkey", "", "")
+	assert.JSONEq(t, `{"value":"header","type":"string"}`, w.Body.String())
+
+	w = doDB(http.MethodPost, "/flushdb", "tenant", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doDB(http.MethodGet, "/scalar/get/dbkey", "tenant", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doDB(http.MethodGet, "/dbsize", "", "")
+	assert.JSONEq(t, `{"size":1}`, w.Body.String())
+}
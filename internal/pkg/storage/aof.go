@@ -0,0 +1,497 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+type FsyncPolicy string
+
+// Fsync policies of the append-only file, the same as appendfsync in redis.
+const (
+	FsyncAlways   = FsyncPolicy("always")   // every record is synced before the call returns
+	FsyncEverySec = FsyncPolicy("everysec") // the file is synced once a second
+	FsyncNo       = FsyncPolicy("no")       // syncing is left to the operating system
+)
+
+const (
+	// the log is rewritten when it becomes aofRewriteGrowth times bigger than after
+	// the previous rewrite, but not before it reaches aofRewriteMinSize
+	aofRewriteMinSize = 1 << 20
+	aofRewriteGrowth  = 2
+)
+
+var ErrAOFEnabled = errors.New("append-only file is already enabled")
+
+// aofRecord is a line of the append-only file. Relative expiration times are
+// written as absolute ones, so replaying the log at any moment gives the same result.
+type aofRecord struct {
+	Cmd     string          `json:"cmd"`
+	Key     string          `json:"key,omitempty"`
+	Args    []string        `json:"args,omitempty"`
+	Ints    []int           `json:"ints,omitempty"`
+	Kind    kind            `json:"kind,omitempty"`    // kind of the "set" value, records without it are KindAuto
+	Binary  []byte          `json:"binary,omitempty"`  // the "set" value if it is not valid UTF-8
+	At      int64           `json:"at,omitempty"`      // unix milliseconds
+	Payload json.RawMessage `json:"payload,omitempty"` // storage snapshot of the "snapshot" record
+	DB      string          `json:"db,omitempty"`      // database of the change, empty for DefaultDB
+}
+
+// aof is the append-only file. Records are appended by the writers while they
+// hold the lock of the key's shard, so the records of a key go in the order of changes.
+type aof struct {
+	mu          sync.Mutex
+	file        *os.File
+	filename    string
+	policy      FsyncPolicy
+	size        int64
+	rewriteSize int64         // size after the last rewrite
+	rewriteBuf  *bytes.Buffer // records written while the log is rewritten, nil otherwise
+	dirty       bool          // there are records which are not synced
+	closeChan   chan struct{}
+	logger      *zap.Logger
+}
+
+// EnableAOF replays the append-only file and starts logging every change to it.
+// A new file starts with the snapshot of the current data, an existing one replaces the data.
+// It has to be called before the storage is used.
+func (r *Storage) EnableAOF(filename string, policy FsyncPolicy) error {
+	switch policy {
+	case FsyncAlways, FsyncEverySec, FsyncNo:
+	default:
+		return ErrIncorrectArgs
+	}
+	if r.aof.Load() != nil {
+		return ErrAOFEnabled
+	}
+
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("error opening append-only file: %v", err)
+	}
+
+	size, err := r.replayAOF(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return fmt.Errorf("error opening append-only file: %v", err)
+	}
+
+	a := &aof{
+		file:        file,
+		filename:    filename,
+		policy:      policy,
+		size:        size,
+		rewriteSize: size,
+		closeChan:   make(chan struct{}),
+		logger:      r.logger,
+	}
+	r.aof.Store(a)
+
+	if size == 0 {
+		if err := r.RewriteAOF(); err != nil {
+			return err
+		}
+	}
+
+	go r.runAOF(a)
+
+	r.logger.Info("append-only file enabled", zap.String("filename", filename),
+		zap.String("fsync", string(policy)), zap.Int64("size", size))
+	return nil
+}
+
+// replayAOF applies the records of the file and returns the size of its correct part.
+// An unfinished last record, left by a crash in the middle of a write, is cut off.
+func (r *Storage) replayAOF(file *os.File) (int64, error) {
+	reader := bufio.NewReader(file)
+	size := int64(0)
+	records := 0
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) != 0 {
+				r.logger.Error("append-only file ends with an unfinished record, it is cut off",
+					zap.Int64("offset", size))
+				if err := file.Truncate(size); err != nil {
+					return 0, fmt.Errorf("error truncating append-only file: %v", err)
+				}
+			}
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error reading append-only file: %v", err)
+		}
+
+		var rec aofRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return 0, fmt.Errorf("error in append-only file at offset %d: %v", size, err)
+		}
+		// the key of a record may have expired since it was written, then the change is skipped
+		err = r.apply(rec)
+		if errors.Is(err, ErrKeyDoesntExist) || errors.Is(err, ErrIndexOutOfRange) {
+			r.logger.Info("append-only file record skipped", zap.Int64("offset", size),
+				zap.String("cmd", rec.Cmd), zap.Error(err))
+		} else if err != nil {
+			return 0, fmt.Errorf("error replaying append-only file at offset %d: %w", size, err)
+		}
+
+		size += int64(len(line))
+		records++
+	}
+
+	r.logger.Info("append-only file replayed", zap.Int("records", records), zap.Int64("size", size))
+	return size, nil
+}
+
+// apply repeats a change recorded in the append-only file.
+func (r *Storage) apply(rec aofRecord) error {
+	if rec.DB != "" {
+		db, err := r.DB(rec.DB)
+		if err != nil {
+			return err
+		}
+		rec.DB = ""
+		return db.apply(rec)
+	}
+
+	var err error
+	switch rec.Cmd {
+	case "snapshot":
+		err = r.UnmarshalJSON(rec.Payload)
+	case "set":
+		value := string(rec.Binary)
+		if rec.Binary == nil {
+			if len(rec.Args) != 1 {
+				return ErrIncorrectArgs
+			}
+			value = rec.Args[0]
+		}
+		err = r.setAt(rec.Key, value, rec.Kind, rec.At)
+	case "pexpireat":
+		r.pexpireAt(rec.Key, rec.At)
+	case "persist":
+		r.Persist(rec.Key)
+	case "del":
+		r.del(rec.Key)
+	case "flushdb":
+		r.FlushDB()
+	case "swapdb":
+		if len(rec.Args) != 2 {
+			return ErrIncorrectArgs
+		}
+		err = r.SwapDB(rec.Args[0], rec.Args[1])
+	case "rename", "copy":
+		if len(rec.Args) != 1 {
+			return ErrIncorrectArgs
+		}
+		if rec.Cmd == "rename" {
+			err = r.Rename(rec.Key, rec.Args[0])
+		} else {
+			_, err = r.Copy(rec.Key, rec.Args[0], true)
+		}
+	case "hset":
+		_, err = r.Hset(rec.Key, rec.Args...)
+	case "hdel":
+		_, err = r.Hdel(rec.Key, rec.Args...)
+	case "zadd":
+		err = r.applyZAdd(rec.Key, rec.Args)
+	case "zrem":
+		_, err = r.ZRem(rec.Key, rec.Args...)
+	case "sadd":
+		_, err = r.SAdd(rec.Key, rec.Args...)
+	case "srem":
+		_, err = r.SRem(rec.Key, rec.Args...)
+	case "sinterstore":
+		_, err = r.SInterStore(rec.Key, rec.Args...)
+	case "sunionstore":
+		_, err = r.SUnionStore(rec.Key, rec.Args...)
+	case "sdiffstore":
+		_, err = r.SDiffStore(rec.Key, rec.Args...)
+	case "rpush":
+		_, err = r.Rpush(rec.Key, rec.elements()...)
+	case "lpush":
+		_, err = r.Lpush(rec.Key, rec.elements()...)
+	case "raddtoset":
+		err = r.Raddtoset(rec.Key, rec.elements()...)
+	case "deletesegment":
+		if len(rec.Ints) != 2 {
+			return ErrIncorrectArgs
+		}
+		_, err = r.DeleteSegment(rec.Key, rec.Ints[0], rec.Ints[1])
+	case "lpop":
+		_, err = r.Lpop(rec.Key, rec.Ints...)
+	case "rpop":
+		_, err = r.Rpop(rec.Key, rec.Ints...)
+	case "linsert":
+		if len(rec.Args) != 3 {
+			return ErrIncorrectArgs
+		}
+		_, err = r.Linsert(rec.Key, rec.Args[0] == "before", rec.Args[1], rec.Args[2])
+	case "lrem":
+		if len(rec.Ints) != 1 || len(rec.Args) != 1 {
+			return ErrIncorrectArgs
+		}
+		_, err = r.Lrem(rec.Key, rec.Ints[0], rec.Args[0])
+	case "ltrim":
+		if len(rec.Ints) != 2 {
+			return ErrIncorrectArgs
+		}
+		err = r.Ltrim(rec.Key, rec.Ints[0], rec.Ints[1])
+	case "lmove":
+		if len(rec.Args) != 3 {
+			return ErrIncorrectArgs
+		}
+		_, err = r.Lmove(rec.Key, rec.Args[0], ListSide(rec.Args[1]), ListSide(rec.Args[2]))
+	case "lset":
+		switch {
+		case len(rec.Ints) == 1 && len(rec.Args) == 1:
+			err = r.Lset(rec.Key, rec.Ints[0], rec.Args[0])
+		case len(rec.Ints) == 2:
+			// written before the lists of strings
+			err = r.Lset(rec.Key, rec.Ints[0], strconv.Itoa(rec.Ints[1]))
+		default:
+			return ErrIncorrectArgs
+		}
+	default:
+		return fmt.Errorf("%w: unknown command %q", ErrIncorrectArgs, rec.Cmd)
+	}
+	return err
+}
+
+// elements returns the list elements of the record, the records written
+// before the lists of strings keep them in Ints.
+func (rec aofRecord) elements() []string {
+	if len(rec.Ints) == 0 {
+		return rec.Args
+	}
+	elements := make([]string, len(rec.Ints))
+	for i, n := range rec.Ints {
+		elements[i] = strconv.Itoa(n)
+	}
+	return elements
+}
+
+// setRecord is the record of a set. JSON strings would corrupt values which are not valid UTF-8,
+// so they and KindBinary values are written in base64 like in the snapshot. An empty value has no base64.
+func setRecord(key string, value string, k kind, t int64) aofRecord {
+	rec := aofRecord{Cmd: "set", Key: key, Kind: k, At: t}
+	if (k != KindBinary || value == "") && utf8.ValidString(value) {
+		rec.Args = []string{value}
+	} else {
+		rec.Binary = []byte(value)
+	}
+	return rec
+}
+
+// propagate appends the record of a change of the database to the append-only file if it is enabled.
+// It is called with the lock of the key's shard held.
+func (r *Storage) propagate(rec aofRecord) {
+	rec.DB = recordDB(r.db)
+	r.writeRecord(rec)
+}
+
+// recordDB is the database of a record, the default one is omitted.
+func recordDB(db string) string {
+	if db == DefaultDB {
+		return ""
+	}
+	return db
+}
+
+// writeRecord appends the record to the append-only file as it is.
+func (r *Storage) writeRecord(rec aofRecord) {
+	a := r.aof.Load()
+	if a == nil {
+		return
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		r.logger.Error("error marshalling append-only file record", zap.Error(err))
+		return
+	}
+	a.write(append(line, '\n'))
+}
+
+func (a *aof) write(line []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.rewriteBuf != nil {
+		a.rewriteBuf.Write(line)
+	}
+
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		a.logger.Error("error writing to append-only file", zap.Error(err))
+		return
+	}
+
+	if a.policy == FsyncAlways {
+		if err := a.file.Sync(); err != nil {
+			a.logger.Error("error syncing append-only file", zap.Error(err))
+		}
+		return
+	}
+	a.dirty = true
+}
+
+func (a *aof) sync() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.dirty {
+		return nil
+	}
+	a.dirty = false
+	return a.file.Sync()
+}
+
+// RewriteAOF replaces the append-only file by the snapshot of the data
+// followed by the records written while the snapshot was being saved.
+func (r *Storage) RewriteAOF() error {
+	a := r.aof.Load()
+	if a == nil {
+		return nil
+	}
+
+	// the records are written under the shard locks, so none of them
+	// can get both into the snapshot and into the buffer
+	unlock := r.lockDatabases(false)
+	a.mu.Lock()
+	if a.rewriteBuf != nil {
+		a.mu.Unlock()
+		unlock()
+		return nil
+	}
+	a.rewriteBuf = &bytes.Buffer{}
+	a.mu.Unlock()
+	payload, err := r.marshalSnapshot()
+	unlock()
+
+	var temp *os.File
+	if err == nil {
+		temp, err = createAOFSnapshot(a.filename, payload)
+	}
+	if err != nil {
+		a.mu.Lock()
+		a.rewriteBuf = nil
+		a.mu.Unlock()
+		r.logger.Error("error rewriting append-only file", zap.Error(err))
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	buffered := a.rewriteBuf.Len()
+	_, err = temp.Write(a.rewriteBuf.Bytes())
+	a.rewriteBuf = nil
+	if err == nil {
+		err = temp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), a.filename)
+	}
+	if err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		r.logger.Error("error rewriting append-only file", zap.Error(err))
+		return fmt.Errorf("error rewriting append-only file: %v", err)
+	}
+
+	a.file.Close()
+	a.file = temp
+	a.size, _ = temp.Seek(0, io.SeekEnd)
+	a.rewriteSize = a.size
+	a.dirty = false
+
+	r.logger.Info("append-only file rewritten", zap.Int64("size", a.size), zap.Int("buffered", buffered))
+	return nil
+}
+
+// createAOFSnapshot writes the snapshot record to a new file next to the log.
+func createAOFSnapshot(filename string, payload []byte) (*os.File, error) {
+	line, err := json.Marshal(aofRecord{Cmd: "snapshot", Payload: payload})
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling storage: %v", err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".rewrite-*")
+	if err != nil {
+		return nil, fmt.Errorf("error creating file: %v", err)
+	}
+	if _, err := temp.Write(append(line, '\n')); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return nil, fmt.Errorf("error writing to file: %v", err)
+	}
+	return temp, nil
+}
+
+// runAOF syncs the file once a second for the everysec policy and starts
+// the rewriting when the file grows too much.
+func (r *Storage) runAOF(a *aof) {
+	for {
+		select {
+		case <-a.closeChan:
+			return
+		case <-time.After(time.Second):
+			r.background.RLock()
+			if a.policy == FsyncEverySec {
+				if err := a.sync(); err != nil {
+					r.logger.Error("error syncing append-only file", zap.Error(err))
+				}
+			}
+
+			a.mu.Lock()
+			grown := a.size >= aofRewriteMinSize && a.size >= a.rewriteSize*aofRewriteGrowth
+			a.mu.Unlock()
+			if grown {
+				r.RewriteAOF()
+			}
+			r.background.RUnlock()
+		}
+	}
+}
+
+// closeAOF stops logging and syncs the file.
+func (r *Storage) closeAOF() error {
+	// no writer is in the middle of a record while all the shards are locked
+	unlock := r.lockDatabases(true)
+	a := r.aof.Swap(nil)
+	unlock()
+	if a == nil {
+		return nil
+	}
+
+	close(a.closeChan)
+	// a rewrite may be running
+	r.Wait()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.file.Sync(); err != nil {
+		a.file.Close()
+		return err
+	}
+	return a.file.Close()
+}
@@ -0,0 +1,318 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newAOFStorage(t *testing.T, filename string) *Storage {
+	r := newTestStorage(t)
+	if err := r.EnableAOF(filename, FsyncAlways); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// assertSameData compares the data of the storages through their snapshots.
+func assertSameData(t *testing.T, expected, actual *Storage) {
+	expectedJSON, err := json.Marshal(expected)
+	assert.NoError(t, err)
+	actualJSON, err := json.Marshal(actual)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(expectedJSON), string(actualJSON))
+}
+
+func TestAOFReplay(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	r := newAOFStorage(t, filename)
+
+	assert.NoError(t, r.Set("string", "value"))
+	assert.NoError(t, r.Set("int", "42", 100))
+	assert.NoError(t, r.SetPX("expired", "value", 1))
+	assert.True(t, expire(t, r, "string", 1000))
+	assert.True(t, r.Persist("int"))
+	_, err := r.Rpush("list", "1", "2", "3", "4", "5", "6")
+	assert.NoError(t, err)
+	_, err = r.Lpush("list", "0")
+	assert.NoError(t, err)
+	assert.NoError(t, r.Raddtoset("list", "1", "7"))
+	assert.NoError(t, r.Lset("list", 0, "10"))
+	_, err = r.Lpop("list")
+	assert.NoError(t, err)
+	_, err = r.Rpop("list", 2)
+	assert.NoError(t, err)
+	_, err = r.PopAtMost("list", ListLeft, 1)
+	assert.NoError(t, err)
+	_, err = r.DeleteSegment("list", 1, -2)
+	assert.NoError(t, err)
+	_, err = r.Rpush("queue", "a", "b", "a", "c", "d")
+	assert.NoError(t, err)
+	_, err = r.Linsert("queue", false, "b", "job")
+	assert.NoError(t, err)
+	_, err = r.Lrem("queue", -1, "a")
+	assert.NoError(t, err)
+	assert.NoError(t, r.Ltrim("queue", 0, -2))
+	_, err = r.Lmove("queue", "done", ListLeft, ListRight)
+	assert.NoError(t, err)
+	_, _, err = r.BRpop(context.Background(), 0, "missing", "queue")
+	assert.NoError(t, err)
+	_, err = r.BLmove(context.Background(), 0, "queue", "done", ListRight, ListLeft)
+	assert.NoError(t, err)
+	_, err = r.Hset("hash", "a", "1", "b", "2")
+	assert.NoError(t, err)
+	_, err = r.Hdel("hash", "a")
+	assert.NoError(t, err)
+	_, err = r.IncrBy("counter", 3)
+	assert.NoError(t, err)
+	_, err = r.IncrBy("counter", 3)
+	assert.NoError(t, err)
+	assert.NoError(t, r.SetTyped("typed", "123", KindString, 0))
+	assert.NoError(t, r.SetTyped("binary", "\xff\x00", KindBinary, 0))
+	assert.NoError(t, r.SetTyped("utf8", "a\x00b", KindBinary, 0))
+	assert.NoError(t, r.SetTyped("empty", "", KindBinary, 0))
+	_, err = r.IncrByFloat("float", 2.5)
+	assert.NoError(t, err)
+	_, err = r.Append("appended", "hello")
+	assert.NoError(t, err)
+	_, err = r.SetRange("appended", 1, "ola")
+	assert.NoError(t, err)
+	_, _, err = r.GetSet("getset", "value")
+	assert.NoError(t, err)
+	_, err = r.GetDel("getset")
+	assert.NoError(t, err)
+	assert.NoError(t, r.MSet("m1", "1", "m2", "2", "m3", "3"))
+	assert.Equal(t, 1, r.Del("m1", "missing"))
+	assert.NoError(t, r.Rename("m2", "renamed"))
+	_, err = r.Copy("list", "copied", false)
+	assert.NoError(t, err)
+	_, err = r.ZAdd("zset", ZAddOptions{}, ZMember{"a", 1}, ZMember{"b", 2.5}, ZMember{"c", 3})
+	assert.NoError(t, err)
+	_, err = r.ZIncrBy("zset", 0.1, "a")
+	assert.NoError(t, err)
+	_, err = r.ZRem("zset", "c")
+	assert.NoError(t, err)
+	_, err = r.SAdd("set", "a", "b", "c", "d")
+	assert.NoError(t, err)
+	_, err = r.SAdd("other", "c", "d", "e")
+	assert.NoError(t, err)
+	_, err = r.SPop("set", 1)
+	assert.NoError(t, err)
+	_, err = r.SRem("other", "e")
+	assert.NoError(t, err)
+	_, err = r.SInterStore("inter", "set", "other")
+	assert.NoError(t, err)
+	_, err = r.SUnionStore("union", "set", "other")
+	assert.NoError(t, err)
+	_, err = r.SDiffStore("set", "set", "other")
+	assert.NoError(t, err)
+
+	// failed calls are not written
+	_, err = r.Lpop("list", 100)
+	assert.ErrorIs(t, err, ErrIndexOutOfRange)
+	assert.ErrorIs(t, r.Set("list", "value"), ErrKeyAlreadyExists)
+
+	assert.NoError(t, r.closeAOF())
+
+	r2 := newAOFStorage(t, filename)
+	assertSameData(t, r, r2)
+
+	v, err := r2.Get("int")
+	assert.NoError(t, err)
+	assert.Equal(t, "42", v)
+	assert.Equal(t, int64(-1), r2.TTL("int"))
+	assert.Equal(t, int64(1000), r2.TTL("string"))
+	_, k, err := r2.GetTyped("typed")
+	assert.NoError(t, err)
+	assert.Equal(t, KindString, k)
+	v, k, err = r2.GetTyped("binary")
+	assert.NoError(t, err)
+	assert.Equal(t, "\xff\x00", v)
+	assert.Equal(t, KindBinary, k)
+	score, err := r2.ZScore("zset", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.1, score)
+	v, err = r2.Get("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, "6", v)
+	time.Sleep(5 * time.Millisecond)
+	_, err = r2.Get("expired")
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+}
+
+func TestAOFStartsWithSnapshot(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+
+	r := newTestStorage(t)
+	// the data loaded before the log is enabled
+	assert.NoError(t, r.Set("loaded", "value"))
+	assert.NoError(t, r.EnableAOF(filename, FsyncNo))
+	assert.ErrorIs(t, r.EnableAOF(filename, FsyncNo), ErrAOFEnabled)
+	assert.NoError(t, r.Set("logged", "value"))
+	assert.NoError(t, r.closeAOF())
+
+	r2 := newAOFStorage(t, filename)
+	assertSameData(t, r, r2)
+	assert.ElementsMatch(t, []string{"loaded", "logged"}, r2.Keys("*"))
+}
+
+func TestAOFRewrite(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	r := newAOFStorage(t, filename)
+
+	for i := 0; i < 100; i++ {
+		_, err := r.Rpush("list", strconv.Itoa(i))
+		assert.NoError(t, err)
+		assert.NoError(t, r.Set("key", strconv.Itoa(i)))
+	}
+	before, err := os.Stat(filename)
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.RewriteAOF())
+	after, err := os.Stat(filename)
+	assert.NoError(t, err)
+	assert.Less(t, after.Size(), before.Size())
+
+	_, err = r.Hset("hash", "field", "value")
+	assert.NoError(t, err)
+	assert.NoError(t, r.closeAOF())
+
+	file, err := os.Open(filename)
+	assert.NoError(t, err)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	cmds := make([]string, 0)
+	for scanner.Scan() {
+		var rec aofRecord
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		cmds = append(cmds, rec.Cmd)
+	}
+	assert.Equal(t, []string{"snapshot", "hset"}, cmds)
+
+	r2 := newAOFStorage(t, filename)
+	assertSameData(t, r, r2)
+}
+
+func TestAOFUnfinishedRecord(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	r := newAOFStorage(t, filename)
+	assert.NoError(t, r.Set("key", "value"))
+	assert.NoError(t, r.closeAOF())
+
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0666)
+	assert.NoError(t, err)
+	_, err = file.WriteString(`{"cmd":"set","key":"broken","ar`)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	r2 := newAOFStorage(t, filename)
+	assertSameData(t, r, r2)
+
+	// the log stays correct after the cut
+	assert.NoError(t, r2.Set("next", "value"))
+	assert.NoError(t, r2.closeAOF())
+	r3 := newAOFStorage(t, filename)
+	assertSameData(t, r2, r3)
+}
+
+func TestAOFReplayExpiredKeys(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	r := newAOFStorage(t, filename)
+
+	_, err := r.Rpush("queue", "a", "b", "c")
+	assert.NoError(t, err)
+	_, err = r.Hset("hash", "a", "1", "b", "2")
+	assert.NoError(t, err)
+	assert.True(t, pexpire(t, r, "queue", 20))
+	assert.True(t, pexpire(t, r, "hash", 20))
+	_, err = r.Lpop("queue")
+	assert.NoError(t, err)
+	assert.NoError(t, r.Lset("queue", 1, "x"))
+	_, err = r.Lmove("queue", "done", ListLeft, ListRight)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Rename("queue", "renamed"))
+	_, err = r.Hdel("hash", "a")
+	assert.NoError(t, err)
+	assert.NoError(t, r.closeAOF())
+
+	// the keys expire before the restart, the records of their changes are skipped
+	time.Sleep(30 * time.Millisecond)
+	r2 := newTestStorage(t)
+	assert.NoError(t, r2.EnableAOF(filename, FsyncAlways))
+	assert.Equal(t, int64(-2), r2.TTL("queue"))
+	assert.Equal(t, int64(-2), r2.TTL("renamed"))
+	assert.Equal(t, int64(-2), r2.TTL("hash"))
+}
+
+func TestAOFCorruptedRecord(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	assert.NoError(t, os.WriteFile(filename, []byte("{\"cmd\":\"unknown\"}\n"), 0666))
+
+	r := newTestStorage(t)
+	assert.ErrorIs(t, r.EnableAOF(filename, FsyncAlways), ErrIncorrectArgs)
+}
+
+func TestAOFEviction(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	r := newAOFStorage(t, filename)
+	assert.NoError(t, r.SetMaxMemory(1000, AllKeysLRU))
+
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, r.Set("key"+strconv.Itoa(i), "value"))
+	}
+	assert.Greater(t, r.MemoryStats().Evicted, int64(0))
+	assert.NoError(t, r.closeAOF())
+
+	r2 := newAOFStorage(t, filename)
+	assertSameData(t, r, r2)
+}
+
+func TestAOFConcurrentRewrite(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	r := newTestStorage(t)
+	assert.NoError(t, r.EnableAOF(filename, FsyncNo))
+
+	done := make(chan struct{})
+	rewritten := make(chan struct{})
+	go func() {
+		defer close(rewritten)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				assert.NoError(t, r.RewriteAOF())
+			}
+		}
+	}()
+
+	runWorkers(stressWorkers, func(worker int) {
+		for i := 0; i < stressIterations; i++ {
+			key := strconv.Itoa(i % 20)
+			switch i % 3 {
+			case 0:
+				_, err := r.Rpush("l"+key, strconv.Itoa(worker))
+				assert.NoError(t, err)
+			case 1:
+				_, err := r.Hset("h"+key, strconv.Itoa(worker), strconv.Itoa(i))
+				assert.NoError(t, err)
+			case 2:
+				r.Lpop("l" + key)
+			}
+		}
+	})
+	close(done)
+	<-rewritten
+	assert.NoError(t, r.closeAOF())
+
+	r2 := newAOFStorage(t, filename)
+	assertSameData(t, r, r2)
+}
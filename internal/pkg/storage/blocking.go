@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrTimeout is returned by the blocking pops when no element came in time.
+var ErrTimeout = errors.New("timeout waiting for an element")
+
+// waiter is a client blocked until an element is pushed to one of its lists.
+// It is queued on every key it waits for, the queues are guarded by the shard locks.
+type waiter struct {
+	ready    chan struct{}
+	signaled atomic.Bool
+}
+
+func newWaiter() *waiter {
+	return &waiter{ready: make(chan struct{}, 1)}
+}
+
+// signal wakes the waiter, a signaled waiter is not signaled again until it tries to pop.
+func (w *waiter) signal() {
+	if w.signaled.CompareAndSwap(false, true) {
+		w.ready <- struct{}{}
+	}
+}
+
+// reset prepares the waiter for the next try, the shards of its keys must be locked.
+func (w *waiter) reset() {
+	select {
+	case <-w.ready:
+	default:
+	}
+	w.signaled.Store(false)
+}
+
+// wake signals the first waiter of the key if the list at key is not empty. The waiters
+// are served one by one: the next one is signaled when the first leaves the queue.
+func (s *shard) wake(key string) {
+	queue := s.waiters[key]
+	if len(queue) == 0 {
+		return
+	}
+	if l, ok := s.arrays[key]; ok && l.len() > 0 && !s.expired(key) {
+		queue[0].signal()
+	}
+}
+
+// first reports whether w can pop from the list at key: only the first waiter can,
+// so the blocked clients are served in the order they came.
+func (s *shard) first(key string, w *waiter) bool {
+	queue := s.waiters[key]
+	return len(queue) == 0 || queue[0] == w
+}
+
+// wakeAll wakes the waiters of every key, it is called when the data of the shard is replaced.
+func (s *shard) wakeAll() {
+	for key := range s.waiters {
+		s.wake(key)
+	}
+}
+
+// enqueue puts the waiter at the end of the queues of the keys, the shards must be locked.
+func (r *Storage) enqueue(w *waiter, keys []string) {
+	for _, key := range keys {
+		s := r.shardOf(key)
+		if !slices.Contains(s.waiters[key], w) {
+			s.waiters[key] = append(s.waiters[key], w)
+		}
+	}
+}
+
+// dequeue removes the waiter from the queues of the keys and wakes the next waiters.
+// The shards must be locked.
+func (r *Storage) dequeue(w *waiter, keys []string) {
+	for _, key := range keys {
+		s := r.shardOf(key)
+		queue := slices.DeleteFunc(s.waiters[key], func(other *waiter) bool { return other == w })
+		if len(queue) == 0 {
+			delete(s.waiters, key)
+			continue
+		}
+		s.waiters[key] = queue
+	}
+	for _, key := range keys {
+		r.shardOf(key).wake(key)
+	}
+}
+
+// block calls try for the waiter with the shards of the locked keys locked until it is done.
+// While it is not, the client waits for an element pushed to one of the keys, up to timeout
+// (0 means no limit) or until ctx is done. A transaction can't wait, so it tries once.
+func (r *Storage) block(ctx context.Context, timeout time.Duration, keys, locked []string, try func(w *waiter) (bool, error)) error {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	w := newWaiter()
+	for {
+		unlock := r.lockKeys(locked...)
+		w.reset()
+		done, err := try(w)
+		if done || r.held {
+			if !done {
+				err = ErrTimeout
+			}
+			r.dequeue(w, keys)
+			unlock()
+			return err
+		}
+		r.enqueue(w, keys)
+		unlock()
+
+		select {
+		case <-w.ready:
+			continue
+		case <-deadline:
+			err = ErrTimeout
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		unlock = r.lockKeys(locked...)
+		r.dequeue(w, keys)
+		unlock()
+		r.logger.Info("client stopped waiting", zap.Strings("keys", keys), zap.Error(err))
+		return err
+	}
+}
+
+// BLpop pops an element from the left side of the first non-empty list of the keys
+// and returns the key with the element. If every list is empty or missing, it waits
+// for an element to be pushed up to timeout, 0 means no limit, or until ctx is done.
+// The clients waiting for the same key get the elements in the order they came. The
+// non-blocking pops are not queued, so they can take an element before a woken client.
+// Returns ErrTimeout if the time is out and the error of ctx if it is done.
+func (r *Storage) BLpop(ctx context.Context, timeout time.Duration, keys ...string) (string, string, error) {
+	return r.bpop(ctx, timeout, ListLeft, keys)
+}
+
+// BRpop works like BLpop, but pops from the right side of the lists.
+func (r *Storage) BRpop(ctx context.Context, timeout time.Duration, keys ...string) (string, string, error) {
+	return r.bpop(ctx, timeout, ListRight, keys)
+}
+
+func (r *Storage) bpop(ctx context.Context, timeout time.Duration, side ListSide, keys []string) (string, string, error) {
+	if len(keys) == 0 {
+		return "", "", ErrIncorrectArgs
+	}
+
+	var key, element string
+	err := r.block(ctx, timeout, keys, keys, func(w *waiter) (bool, error) {
+		for _, k := range keys {
+			s := r.shardOf(k)
+			s.dropExpired(k)
+			l, err := s.listOf(k)
+			if errors.Is(err, ErrKeyDoesntExist) {
+				continue
+			}
+			if err != nil {
+				return true, err
+			}
+			if l.len() == 0 || !s.first(k, w) {
+				continue
+			}
+
+			cmd, i := "lpop", 0
+			if side == ListRight {
+				cmd, i = "rpop", l.len()-1
+			}
+			key, element = k, l.remove(i, i)[0]
+			s.resize(k)
+			r.propagate(aofRecord{Cmd: cmd, Key: k})
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+	r.logger.Info("element popped", zap.String("key", key), zap.String("side", string(side)))
+	return key, element, nil
+}
+
+// BLmove works like Lmove, but waits for an element to be pushed to the list at src
+// like BLpop if it is empty or missing.
+func (r *Storage) BLmove(ctx context.Context, timeout time.Duration, src, dst string, from, to ListSide) (string, error) {
+	if !from.valid() || !to.valid() {
+		return "", ErrIncorrectArgs
+	}
+	if err := r.reserve(); err != nil {
+		return "", err
+	}
+
+	var element string
+	err := r.block(ctx, timeout, []string{src}, []string{src, dst}, func(w *waiter) (bool, error) {
+		s := r.shardOf(src)
+		s.dropExpired(src)
+		if !s.first(src, w) {
+			return false, nil
+		}
+		var err error
+		element, err = r.lmove(src, dst, from, to)
+		if errors.Is(err, ErrKeyDoesntExist) || errors.Is(err, ErrIndexOutOfRange) {
+			return false, nil
+		}
+		return true, err
+	})
+	return element, err
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waiting returns the number of the clients blocked on the key.
+func waiting(r *Storage, key string) int {
+	s, unlock := r.lock(key)
+	defer unlock()
+	return len(s.waiters[key])
+}
+
+type popped struct {
+	key, element string
+	err          error
+}
+
+// blpop starts BLpop in a goroutine and waits until it is blocked.
+func blpop(t *testing.T, ctx context.Context, r *Storage, timeout time.Duration, keys ...string) <-chan popped {
+	t.Helper()
+	before := waiting(r, keys[0])
+	result := make(chan popped, 1)
+	go func() {
+		key, element, err := r.BLpop(ctx, timeout, keys...)
+		result <- popped{key, element, err}
+	}()
+	assert.Eventually(t, func() bool { return waiting(r, keys[0]) == before+1 }, time.Second, time.Millisecond)
+	return result
+}
+
+func TestBlockingPopReady(t *testing.T) {
+	r := newTestStorage(t)
+
+	_, err := r.Rpush("second", "a", "b")
+	assert.NoError(t, err)
+	_, err = r.Rpush("empty", "x")
+	assert.NoError(t, err)
+	_, err = r.Lpop("empty")
+	assert.NoError(t, err)
+
+	// the first non-empty list is popped without waiting
+	key, element, err := r.BLpop(context.Background(), time.Second, "missing", "empty", "second")
+	assert.NoError(t, err)
+	assert.Equal(t, "second", key)
+	assert.Equal(t, "a", element)
+	key, element, err = r.BRpop(context.Background(), 0, "second")
+	assert.NoError(t, err)
+	assert.Equal(t, "second", key)
+	assert.Equal(t, "b", element)
+
+	assert.NoError(t, r.Set("string", "value"))
+	_, _, err = r.BLpop(context.Background(), 0, "missing", "string")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	_, _, err = r.BLpop(context.Background(), 0)
+	assert.ErrorIs(t, err, ErrIncorrectArgs)
+	_, err = r.BLmove(context.Background(), 0, "second", "dst", ListLeft, "up")
+	assert.ErrorIs(t, err, ErrIncorrectArgs)
+	assert.Equal(t, exactUsage(r), r.MemoryStats().Used)
+}
+
+func TestBlockingPopFIFO(t *testing.T) {
+	r := newTestStorage(t)
+	ctx := context.Background()
+
+	first := blpop(t, ctx, r, 0, "queue")
+	second := blpop(t, ctx, r, 0, "queue", "other")
+	third := blpop(t, ctx, r, 0, "queue")
+
+	_, err := r.Rpush("queue", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, popped{"queue", "a", nil}, <-first)
+	_, err = r.Lpush("queue", "b", "c")
+	assert.NoError(t, err)
+	assert.Equal(t, popped{"queue", "b", nil}, <-second)
+	assert.Equal(t, popped{"queue", "c", nil}, <-third)
+
+	assert.Eventually(t, func() bool { return waiting(r, "queue") == 0 && waiting(r, "other") == 0 },
+		time.Second, time.Millisecond)
+	n, err := r.Llen("queue")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestBlockingPopTimeout(t *testing.T) {
+	r := newTestStorage(t)
+
+	start := time.Now()
+	_, _, err := r.BRpop(context.Background(), 20*time.Millisecond, "queue")
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	assert.Equal(t, 0, waiting(r, "queue"))
+
+	// the canceled client leaves the queue and the next one gets the element
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := blpop(t, ctx, r, 0, "queue")
+	next := blpop(t, context.Background(), r, 0, "queue")
+	cancel()
+	assert.ErrorIs(t, (<-canceled).err, context.Canceled)
+	_, err = r.Rpush("queue", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, popped{"queue", "a", nil}, <-next)
+
+	// a transaction does not wait
+	r.Atomically(func(tx *Storage) {
+		_, _, err = tx.BLpop(context.Background(), 0, "queue")
+	})
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.Equal(t, 0, waiting(r, "queue"))
+}
+
+func TestBLmove(t *testing.T) {
+	r := newTestStorage(t)
+	ctx := context.Background()
+
+	moved := make(chan string, 1)
+	go func() {
+		element, err := r.BLmove(ctx, 0, "src", "dst", ListRight, ListLeft)
+		assert.NoError(t, err)
+		moved <- element
+	}()
+	assert.Eventually(t, func() bool { return waiting(r, "src") == 1 }, time.Second, time.Millisecond)
+	// the client waiting for dst is woken by the move
+	fromDst := blpop(t, ctx, r, 0, "dst")
+
+	_, err := r.Rpush("src", "a", "b")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", <-moved)
+	assert.Equal(t, popped{"dst", "b", nil}, <-fromDst)
+	elements, _ := r.Lrange("src", 0, -1)
+	assert.Equal(t, []string{"a"}, elements)
+
+	_, err = r.BLmove(ctx, 10*time.Millisecond, "missing", "dst", ListLeft, ListLeft)
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.Equal(t, exactUsage(r), r.MemoryStats().Used)
+}
+
+func TestBlockingPopRename(t *testing.T) {
+	r := newTestStorage(t)
+	ctx := context.Background()
+
+	_, err := r.Rpush("src", "a", "b")
+	assert.NoError(t, err)
+	renamed := blpop(t, ctx, r, 0, "queue")
+	assert.NoError(t, r.Rename("src", "queue"))
+	assert.Equal(t, popped{"queue", "a", nil}, <-renamed)
+
+	copied := blpop(t, ctx, r, 0, "copy")
+	_, err = r.Copy("queue", "copy", false)
+	assert.NoError(t, err)
+	assert.Equal(t, popped{"copy", "b", nil}, <-copied)
+}
+
+func TestBlockingPopAcrossDBs(t *testing.T) {
+	r := newTestStorage(t)
+	other, err := r.DB("1")
+	assert.NoError(t, err)
+
+	result := blpop(t, context.Background(), r, 0, "queue")
+	_, err = other.Rpush("queue", "a")
+	assert.NoError(t, err)
+	select {
+	case <-result:
+		t.Fatal("the client was woken by a push to another database")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// the swapped in list is popped
+	assert.NoError(t, r.SwapDB(DefaultDB, "1"))
+	assert.Equal(t, popped{"queue", "a", nil}, <-result)
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// AnyVersion makes CompareAndSet write the value whatever the version of the key is.
+	AnyVersion = uint64(math.MaxUint64)
+	// KeepTTL makes CompareAndSet keep the expiration time of the key.
+	KeepTTL = int64(-1)
+)
+
+var ErrVersionMismatch = errors.New("key version has changed")
+
+// GetVersion works like Get, but also returns the version of the key.
+// The version changes on every write of the key and is never given to another write.
+func (r *Storage) GetVersion(key string) (string, uint64, error) {
+	var (
+		value   string
+		version uint64
+	)
+	err := r.read(key, func(s *shard) error {
+		v, err := s.getValue(key)
+		if err != nil {
+			return err
+		}
+		value = v.string()
+		version = s.meta[key].version
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return value, version, nil
+}
+
+// CompareAndSet works like SetPX, but writes the value only if the version of the key
+// is the given one and returns the new version. Version 0 means that the key must not exist.
+// ErrVersionMismatch is returned if the version is another one
+// and ErrKeyDoesntExist if the key is missing.
+func (r *Storage) CompareAndSet(key string, inputVal string, version uint64, expirationMilliseconds int64) (uint64, error) {
+	if (expirationMilliseconds < 0 && expirationMilliseconds != KeepTTL) || expirationMilliseconds > maxExpireMilliseconds {
+		return 0, ErrIncorrectArgs
+	}
+	if err := r.reserve(); err != nil {
+		return 0, err
+	}
+
+	s, unlock := r.lock(key)
+	defer unlock()
+
+	s.dropExpired(key)
+	current := uint64(0)
+	if m, ok := s.meta[key]; ok {
+		current = m.version
+	}
+	switch {
+	case version == AnyVersion || version == current:
+	case current == 0:
+		return 0, ErrKeyDoesntExist
+	default:
+		r.logger.Info("version mismatch", zap.String("key", key),
+			zap.Uint64("version", version), zap.Uint64("current", current))
+		return 0, ErrVersionMismatch
+	}
+
+	t := int64(0)
+	switch {
+	case expirationMilliseconds == KeepTTL:
+		t = s.expirationTime[key]
+	case expirationMilliseconds > 0:
+		t = time.Now().Add(time.Duration(expirationMilliseconds) * time.Millisecond).UnixMilli()
+	}
+
+	err := s.set(key, inputVal, KindAuto, t)
+	s.resize(key)
+	if err != nil {
+		return 0, err
+	}
+	r.propagate(setRecord(key, inputVal, KindAuto, t))
+	return s.meta[key].version, nil
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareAndSet(t *testing.T) {
+	r := newTestStorage(t)
+
+	_, _, err := r.GetVersion("key")
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+
+	// version 0 only creates the key
+	v1, err := r.CompareAndSet("key", "value", 0, 0)
+	assert.NoError(t, err)
+	_, err = r.CompareAndSet("key", "other", 0, 0)
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+
+	value, version, err := r.GetVersion("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", value)
+	assert.Equal(t, v1, version)
+
+	// any write changes the version
+	assert.NoError(t, r.Set("key", "42"))
+	value, v2, err := r.GetVersion("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "42", value)
+	assert.NotEqual(t, v1, v2)
+
+	_, err = r.CompareAndSet("key", "stale", v1, 0)
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+	v3, err := r.CompareAndSet("key", "fresh", v2, 100000)
+	assert.NoError(t, err)
+	assert.NotEqual(t, v2, v3)
+	assert.InDelta(t, 100000, r.PTTL("key"), 1000)
+
+	// the version doesnt come back after the key is recreated
+	assert.True(t, r.Delete("key"))
+	assert.False(t, r.Delete("key"))
+	_, err = r.CompareAndSet("key", "value", v3, 0)
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+	assert.NoError(t, r.Set("key", "value"))
+	_, v4, _ := r.GetVersion("key")
+	assert.NotEqual(t, v3, v4)
+
+	_, err = r.CompareAndSet("key", "value", AnyVersion, KeepTTL)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), r.PTTL("key"))
+	_, err = r.CompareAndSet("key", "value", AnyVersion, -5)
+	assert.ErrorIs(t, err, ErrIncorrectArgs)
+
+	_, err = r.Rpush("list", "1")
+	assert.NoError(t, err)
+	_, err = r.CompareAndSet("list", "value", AnyVersion, 0)
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	assert.True(t, r.Delete("list"))
+	assert.Zero(t, exactUsage(r)-r.MemoryStats().Used)
+}
+
+func TestConcurrentCompareAndSet(t *testing.T) {
+	r := newTestStorage(t)
+	assert.NoError(t, r.Set("counter", "0"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for {
+					value, version, err := r.GetVersion("counter")
+					assert.NoError(t, err)
+					n, _ := strconv.Atoi(value)
+					if _, err := r.CompareAndSet("counter", strconv.Itoa(n+1), version, KeepTTL); err == nil {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, err := r.Get("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, "800", value)
+}
@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"encoding/json"
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// These tests are meant to be run with -race.
+
+const (
+	stressWorkers    = 8
+	stressIterations = 300
+)
+
+func runWorkers(workers int, fn func(worker int)) {
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			fn(worker)
+		}(w)
+	}
+	wg.Wait()
+}
+
+func TestConcurrentScalars(t *testing.T) {
+	r := newTestStorage(t)
+
+	runWorkers(stressWorkers, func(worker int) {
+		rnd := rand.New(rand.NewSource(int64(worker)))
+		for i := 0; i < stressIterations; i++ {
+			key := "key" + strconv.Itoa(rnd.Intn(10))
+			switch rnd.Intn(7) {
+			case 0:
+				r.Set(key, strconv.Itoa(i))
+			case 1:
+				r.SetPX(key, "value", int64(rnd.Intn(5)+1))
+			case 2:
+				r.Get(key)
+			case 3:
+				r.GetKind(key)
+			case 4:
+				r.Expire(key, 100)
+			case 5:
+				r.TTL(key)
+			case 6:
+				r.Persist(key)
+			}
+		}
+	})
+
+	for i := 0; i < 10; i++ {
+		key := "key" + strconv.Itoa(i)
+		assert.NoError(t, r.Set(key, "final"))
+		v, err := r.Get(key)
+		assert.NoError(t, err)
+		assert.Equal(t, "final", v)
+	}
+}
+
+func TestConcurrentArrays(t *testing.T) {
+	r := newTestStorage(t)
+
+	var mu sync.Mutex
+	pushed, popped := 0, 0
+
+	runWorkers(stressWorkers, func(worker int) {
+		rnd := rand.New(rand.NewSource(int64(worker)))
+		for i := 0; i < stressIterations; i++ {
+			switch rnd.Intn(6) {
+			case 0:
+				if _, err := r.Rpush("list", strconv.Itoa(i), strconv.Itoa(i)); err == nil {
+					mu.Lock()
+					pushed += 2
+					mu.Unlock()
+				}
+			case 1:
+				if _, err := r.Lpush("list", strconv.Itoa(i)); err == nil {
+					mu.Lock()
+					pushed++
+					mu.Unlock()
+				}
+			case 2:
+				if deleted, err := r.Lpop("list"); err == nil {
+					mu.Lock()
+					popped += len(deleted)
+					mu.Unlock()
+				}
+			case 3:
+				if deleted, err := r.Rpop("list", 2); err == nil {
+					mu.Lock()
+					popped += len(deleted)
+					mu.Unlock()
+				}
+			case 4:
+				r.Lset("list", 0, strconv.Itoa(i))
+			case 5:
+				r.Lget("list", 0)
+			}
+		}
+	})
+
+	length := 0
+	if arr, err := r.Lpop("list", 0); err == nil {
+		assert.Empty(t, arr)
+		for {
+			if _, err := r.Lpop("list"); err != nil {
+				break
+			}
+			length++
+		}
+	}
+	assert.Equal(t, pushed-popped, length)
+}
+
+func TestConcurrentHashes(t *testing.T) {
+	r := newTestStorage(t)
+
+	runWorkers(stressWorkers, func(worker int) {
+		field := "field" + strconv.Itoa(worker)
+		for i := 0; i < stressIterations; i++ {
+			_, err := r.Hset("hash", field, strconv.Itoa(i))
+			assert.NoError(t, err)
+
+			v, err := r.Hget("hash", field)
+			assert.NoError(t, err)
+			assert.Equal(t, strconv.Itoa(i), v)
+
+			r.Hgetall("hash")
+			r.Hlen("hash")
+		}
+	})
+
+	length, err := r.Hlen("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, stressWorkers, length)
+}
+
+func TestConcurrentWithBackgroundWork(t *testing.T) {
+	r := newTestStorage(t)
+
+	done := make(chan struct{})
+	var background sync.WaitGroup
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				r.GarbageCollect()
+				_, err := json.Marshal(r)
+				assert.NoError(t, err)
+				r.Keys("*")
+				r.Scan(0, ScanOptions{Count: 5})
+			}
+		}
+	}()
+
+	runWorkers(stressWorkers, func(worker int) {
+		rnd := rand.New(rand.NewSource(int64(worker)))
+		for i := 0; i < stressIterations; i++ {
+			key := strconv.Itoa(rnd.Intn(50))
+			switch rnd.Intn(4) {
+			case 0:
+				r.SetPX("s"+key, "value", 1)
+			case 1:
+				r.Rpush("l"+key, strconv.Itoa(i))
+				r.PExpire("l"+key, 1)
+			case 2:
+				r.Hset("h"+key, "field", "value")
+				r.PExpire("h"+key, 1)
+			case 3:
+				r.Get("s" + key)
+				r.Lget("l"+key, 0)
+				r.Hget("h"+key, "field")
+			}
+		}
+	})
+
+	close(done)
+	background.Wait()
+
+	time.Sleep(5 * time.Millisecond)
+	assert.Empty(t, r.Keys("*"))
+}
+
+func TestConcurrentBackgroundLoops(t *testing.T) {
+	r, err := NewStorageWithPersister(time.Millisecond, time.Millisecond, NewMemoryPersister())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runWorkers(stressWorkers, func(worker int) {
+		for i := 0; i < stressIterations; i++ {
+			key := strconv.Itoa(worker*stressIterations + i)
+			r.SetPX(key, "value", 1)
+			r.Get(key)
+		}
+	})
+
+	r.Wait()
+}
+
+func TestConcurrentEviction(t *testing.T) {
+	r := newTestStorage(t)
+	assert.NoError(t, r.SetMaxMemory(10000, AllKeysLRU))
+
+	runWorkers(stressWorkers, func(worker int) {
+		rnd := rand.New(rand.NewSource(int64(worker)))
+		for i := 0; i < stressIterations; i++ {
+			key := strconv.Itoa(rnd.Intn(200))
+			switch rnd.Intn(4) {
+			case 0:
+				assert.NoError(t, r.Set("s"+key, "value"))
+			case 1:
+				_, err := r.Rpush("l"+key, strconv.Itoa(i))
+				assert.NoError(t, err)
+			case 2:
+				_, err := r.Hset("h"+key, "field", "value")
+				assert.NoError(t, err)
+			case 3:
+				r.Get("s" + key)
+			}
+		}
+	})
+
+	assert.Equal(t, exactUsage(r), r.MemoryStats().Used)
+	assert.Greater(t, r.MemoryStats().Evicted, int64(0))
+}
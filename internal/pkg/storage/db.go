@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultDB is the database of the storage returned by NewStorage
+	DefaultDB = "0"
+	// DefaultMaxDatabases is how many databases can be created if SetMaxDatabases was not called
+	DefaultMaxDatabases = 16
+	maxDBNameLength     = 64
+)
+
+var (
+	ErrInvalidDB  = errors.New("invalid database name")
+	ErrTooManyDBs = errors.New("too many databases")
+	ErrSwapDBInTx = errors.New("SWAPDB is not allowed in transactions")
+)
+
+// databases are the logical keyspaces of one storage. They share the memory limit,
+// the append-only file and the snapshots, but every one of them has its own shards.
+//
+// The lock of the set is taken before the locks of the shards: lockDatabases holds it
+// while it locks every shard, so no database is created in the middle of a snapshot.
+type databases struct {
+	mu     sync.RWMutex
+	shards map[string][]*shard
+	max    int
+}
+
+// database is a named set of shards.
+type database struct {
+	name   string
+	shards []*shard
+}
+
+func newDatabases(shards []*shard) *databases {
+	return &databases{
+		shards: map[string][]*shard{DefaultDB: shards},
+		max:    DefaultMaxDatabases,
+	}
+}
+
+// list returns the databases sorted by name, it is the order they are locked in.
+func (d *databases) list() []database {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.sorted()
+}
+
+func (d *databases) sorted() []database {
+	list := make([]database, 0, len(d.shards))
+	for name, shards := range d.shards {
+		list = append(list, database{name: name, shards: shards})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+	return list
+}
+
+// DB returns the storage working with the database of the given name, it is created
+// if it doesnt exist. A database name consists of letters, digits and "_-.:" characters,
+// numbers like in redis are names too. The returned storage shares everything else with r.
+func (r *Storage) DB(name string) (*Storage, error) {
+	if !validDBName(name) {
+		return nil, ErrInvalidDB
+	}
+
+	r.dbs.mu.RLock()
+	shards, ok := r.dbs.shards[name]
+	r.dbs.mu.RUnlock()
+	if !ok {
+		r.dbs.mu.Lock()
+		if shards, ok = r.dbs.shards[name]; !ok {
+			if len(r.dbs.shards) >= r.dbs.max {
+				r.dbs.mu.Unlock()
+				return nil, ErrTooManyDBs
+			}
+			shards = newShards(r.logger, r.memory, name)
+			r.dbs.shards[name] = shards
+			r.logger.Info("database created", zap.String("db", name))
+		}
+		r.dbs.mu.Unlock()
+	}
+
+	return r.view(name, shards, r.held), nil
+}
+
+// view makes a storage working with the shards of the database.
+func (r *Storage) view(db string, shards []*shard, held bool) *Storage {
+	v := &Storage{
+		shards:     shards,
+		logger:     r.logger,
+		persister:  r.persister,
+		background: r.background,
+		memory:     r.memory,
+		dbs:        r.dbs,
+		db:         db,
+		held:       held,
+	}
+	v.aof.Store(r.aof.Load())
+	return v
+}
+
+func validDBName(name string) bool {
+	if name == "" || len(name) > maxDBNameLength {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '_' || c == '-' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// DBName returns the name of the database the storage works with.
+func (r *Storage) DBName() string {
+	return r.db
+}
+
+// SetMaxDatabases limits how many databases can exist, the existing ones are kept.
+func (r *Storage) SetMaxDatabases(n int) error {
+	if n < 1 {
+		return ErrIncorrectArgs
+	}
+
+	r.dbs.mu.Lock()
+	r.dbs.max = n
+	r.dbs.mu.Unlock()
+	r.logger.Info("databases limit set", zap.Int("max", n))
+	return nil
+}
+
+// Databases returns the names of the existing databases sorted.
+func (r *Storage) Databases() []string {
+	list := r.dbs.list()
+	names := make([]string, 0, len(list))
+	for _, db := range list {
+		names = append(names, db.name)
+	}
+	return names
+}
+
+// DBSize returns the number of keys in the database.
+func (r *Storage) DBSize() int {
+	unlock := r.rlockAll()
+	defer unlock()
+
+	size := 0
+	for _, s := range r.shards {
+		s.walkKeys(func(string) {
+			size++
+		})
+	}
+	return size
+}
+
+// FlushDB deletes every key of the database.
+func (r *Storage) FlushDB() {
+	unlock := r.lockAll()
+	defer unlock()
+
+	for _, s := range r.shards {
+		s.flush()
+	}
+	r.propagate(aofRecord{Cmd: "flushdb"})
+	r.logger.Info("database flushed", zap.String("db", r.db))
+}
+
+// SwapDB exchanges the data of two databases, the clients working with one of them
+// see the data of the other one at once. It is not allowed in a transaction,
+// which has only the shards of its own database locked.
+func (r *Storage) SwapDB(first, second string) error {
+	if r.held {
+		return ErrSwapDBInTx
+	}
+	a, err := r.DB(first)
+	if err != nil {
+		return err
+	}
+	b, err := r.DB(second)
+	if err != nil {
+		return err
+	}
+	if first == second {
+		return nil
+	}
+
+	// the databases are locked in the order of their names
+	if first > second {
+		a, b = b, a
+	}
+	unlockA := a.lockAll()
+	unlockB := b.lockAll()
+	defer unlockA()
+	defer unlockB()
+
+	for i := range a.shards {
+		a.shards[i].swap(b.shards[i])
+	}
+	r.propagate(aofRecord{Cmd: "swapdb", Args: []string{first, second}})
+	r.logger.Info("databases swapped", zap.String("first", first), zap.String("second", second))
+	return nil
+}
+
+// flush deletes every key of the shard.
+func (s *shard) flush() {
+	for _, m := range s.meta {
+		s.memory.used.Add(-m.size)
+	}
+	s.inner = make(map[string]*val)
+	s.arrays = make(map[string]*list)
+	s.hashes = make(map[string]map[string]string)
+	s.zsets = make(map[string]*zset)
+	s.sets = make(map[string]set)
+	s.expirationTime = make(map[string]int64)
+	s.expiry = newExpiryIndex()
+	s.meta = make(map[string]*entryMeta)
+	s.keysVersion++
+	s.deleted = s.memory.versions.Add(1)
+}
+
+// swap exchanges the data with the shard of the same index in another database.
+// Every key of both gets a new version, so the transactions watching them are aborted.
+func (s *shard) swap(other *shard) {
+	s.inner, other.inner = other.inner, s.inner
+	s.arrays, other.arrays = other.arrays, s.arrays
+	s.hashes, other.hashes = other.hashes, s.hashes
+	s.zsets, other.zsets = other.zsets, s.zsets
+	s.sets, other.sets = other.sets, s.sets
+	s.expirationTime, other.expirationTime = other.expirationTime, s.expirationTime
+	s.expiry, other.expiry = other.expiry, s.expiry
+	s.meta, other.meta = other.meta, s.meta
+
+	for _, sh := range []*shard{s, other} {
+		for _, m := range sh.meta {
+			m.version = sh.memory.versions.Add(1)
+		}
+		sh.deleted = sh.memory.versions.Add(1)
+		sh.keysVersion++
+		sh.wakeAll()
+	}
+}
+
+// lockDatabases locks every shard of every database, for writing or reading,
+// and returns the function unlocking them.
+func (r *Storage) lockDatabases(write bool) func() {
+	if r.held {
+		return func() {}
+	}
+
+	r.dbs.mu.RLock()
+	list := r.dbs.sorted()
+	for _, db := range list {
+		for _, s := range db.shards {
+			if write {
+				s.mu.Lock()
+			} else {
+				s.mu.RLock()
+			}
+		}
+	}
+	return func() {
+		for _, db := range list {
+			for _, s := range db.shards {
+				if write {
+					s.mu.Unlock()
+				} else {
+					s.mu.RUnlock()
+				}
+			}
+		}
+		r.dbs.mu.RUnlock()
+	}
+}
+
+// allShards returns the shards of every database.
+func (r *Storage) allShards() []*shard {
+	var shards []*shard
+	for _, db := range r.dbs.list() {
+		shards = append(shards, db.shards...)
+	}
+	return shards
+}
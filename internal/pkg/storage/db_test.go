@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB(t *testing.T) {
+	r := newTestStorage(t)
+	assert.Equal(t, DefaultDB, r.DBName())
+
+	db, err := r.DB("tenant:1")
+	assert.NoError(t, err)
+	assert.Equal(t, "tenant:1", db.DBName())
+
+	// the databases have their own keys
+	assert.NoError(t, r.Set("key", "default"))
+	assert.NoError(t, db.Set("key", "tenant"))
+	_, err = db.Rpush("list", "1", "2")
+	assert.NoError(t, err)
+	v, _ := r.Get("key")
+	assert.Equal(t, "default", v)
+	v, _ = db.Get("key")
+	assert.Equal(t, "tenant", v)
+	assert.Equal(t, 1, r.DBSize())
+	assert.Equal(t, 2, db.DBSize())
+	assert.Equal(t, []string{"key", "list"}, db.Keys("*"))
+
+	// the same database is returned by name
+	again, err := r.DB("tenant:1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, again.DBSize())
+	assert.Equal(t, []string{DefaultDB, "tenant:1"}, r.Databases())
+
+	_, err = r.DB("")
+	assert.ErrorIs(t, err, ErrInvalidDB)
+	_, err = r.DB("a b")
+	assert.ErrorIs(t, err, ErrInvalidDB)
+
+	assert.ErrorIs(t, r.SetMaxDatabases(0), ErrIncorrectArgs)
+	assert.NoError(t, r.SetMaxDatabases(3))
+	_, err = r.DB("2")
+	assert.NoError(t, err)
+	_, err = r.DB("3")
+	assert.ErrorIs(t, err, ErrTooManyDBs)
+}
+
+func TestFlushDB(t *testing.T) {
+	r := newTestStorage(t)
+	db, err := r.DB("1")
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.Set("key", "value"))
+	used := r.MemoryStats().Used
+	assert.NoError(t, db.Set("key", "value", 100))
+	_, err = db.Hset("hash", "f", "v")
+	assert.NoError(t, err)
+	version := db.KeyVersion("key")
+
+	db.FlushDB()
+	assert.Equal(t, 0, db.DBSize())
+	assert.Equal(t, 1, r.DBSize())
+	assert.Equal(t, used, r.MemoryStats().Used)
+	assert.Equal(t, 0, r.ExpireStats().Tracked)
+	assert.NotEqual(t, version, db.KeyVersion("key"))
+}
+
+func TestSwapDB(t *testing.T) {
+	r := newTestStorage(t)
+	db, err := r.DB("1")
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.Set("a", "default", 100))
+	assert.NoError(t, db.Set("b", "other"))
+	version := r.KeyVersion("a")
+
+	assert.NoError(t, db.SwapDB("1", DefaultDB))
+	assert.Equal(t, []string{"b"}, r.Keys("*"))
+	assert.Equal(t, []string{"a"}, db.Keys("*"))
+	assert.Equal(t, int64(100), db.TTL("a"))
+	assert.NotEqual(t, version, db.KeyVersion("a"))
+
+	assert.NoError(t, r.SwapDB(DefaultDB, DefaultDB))
+	assert.ErrorIs(t, r.SwapDB(DefaultDB, "no space"), ErrInvalidDB)
+	r.Atomically(func(tx *Storage) {
+		assert.ErrorIs(t, tx.SwapDB(DefaultDB, "1"), ErrSwapDBInTx)
+	})
+}
+
+func TestDBSnapshot(t *testing.T) {
+	r := newTestStorage(t)
+	db, err := r.DB("named")
+	assert.NoError(t, err)
+	_, err = r.DB("empty")
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.Set("key", "default"))
+	assert.NoError(t, db.Set("key", "named", 100))
+	_, err = db.Hset("hash", "f", "v")
+	assert.NoError(t, err)
+
+	data, err := json.Marshal(r)
+	assert.NoError(t, err)
+	var aux storageJSON
+	assert.NoError(t, json.Unmarshal(data, &aux))
+	assert.Len(t, aux.Inner, 1)
+	assert.Len(t, aux.Databases, 1)
+	assert.Len(t, aux.Databases["named"].Hashes, 1)
+
+	r2 := newTestStorage(t)
+	other, err := r2.DB("other")
+	assert.NoError(t, err)
+	assert.NoError(t, other.Set("key", "value"))
+
+	assert.NoError(t, json.Unmarshal(data, r2))
+	assertSameData(t, r, r2)
+	// the databases missing in the snapshot become empty
+	assert.Equal(t, 0, other.DBSize())
+	loaded, err := r2.DB("named")
+	assert.NoError(t, err)
+	v, _ := loaded.Get("key")
+	assert.Equal(t, "named", v)
+	assert.Equal(t, int64(100), loaded.TTL("key"))
+	assert.Equal(t, r.MemoryStats().Used, r2.MemoryStats().Used)
+}
+
+func TestDBAOFReplay(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	r := newAOFStorage(t, filename)
+
+	first, err := r.DB("1")
+	assert.NoError(t, err)
+	second, err := r.DB("2")
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.Set("key", "default"))
+	assert.NoError(t, first.Set("key", "first"))
+	_, err = first.Rpush("list", "1", "2", "3")
+	assert.NoError(t, err)
+	assert.NoError(t, second.Set("key", "second"))
+	assert.NoError(t, second.SwapDB("1", "2"))
+	assert.NoError(t, first.Set("flushed", "value"))
+	first.FlushDB()
+	assert.NoError(t, first.Set("after", "flush"))
+	assert.NoError(t, r.closeAOF())
+
+	r2 := newAOFStorage(t, filename)
+	assertSameData(t, r, r2)
+	loaded, err := r2.DB("2")
+	assert.NoError(t, err)
+	v, _ := loaded.Get("key")
+	assert.Equal(t, "first", v)
+	assert.Equal(t, []string{DefaultDB, "1", "2"}, r2.Databases())
+}
+
+func TestEvictionAcrossDBs(t *testing.T) {
+	r := newTestStorage(t)
+	db, err := r.DB("1")
+	assert.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, r.Set(strconv.Itoa(i), "value"))
+	}
+	assert.NoError(t, r.SetMaxMemory(r.MemoryStats().Used, AllKeysLRU))
+
+	// the keys of another database are evicted to fit the new ones
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, db.Set(strconv.Itoa(i), "value"))
+	}
+	assert.Equal(t, 10, db.DBSize())
+	assert.Less(t, r.DBSize(), 100)
+}
+
+func TestEvictionInTransaction(t *testing.T) {
+	r := newTestStorage(t)
+	db, err := r.DB("1")
+	assert.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, r.Set(strconv.Itoa(i), "value"))
+		assert.NoError(t, db.Set(strconv.Itoa(i), "value"))
+	}
+	assert.NoError(t, r.SetMaxMemory(r.MemoryStats().Used, AllKeysLRU))
+
+	// the transactions evict the keys of their own database while another one is written
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			assert.NoError(t, db.Set(strconv.Itoa(i%1000), "value"))
+		}
+	}()
+	for i := 100; i < 300; i++ {
+		r.Atomically(func(tx *Storage) {
+			assert.NoError(t, tx.Set(strconv.Itoa(i), "value"))
+		})
+	}
+	close(stop)
+	<-done
+
+	assert.Less(t, r.DBSize()+db.DBSize(), 210)
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"container/heap"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// gcTimeBudget limits the time of one garbage collection cycle,
+	// the keys which are left are collected by the next cycles
+	gcTimeBudget = 25 * time.Millisecond
+	// gcBatchSize is how many keys are deleted under one shard lock
+	gcBatchSize = 256
+)
+
+// ExpireStats describes the work of the garbage collector.
+type ExpireStats struct {
+	Cycles         int64         `json:"cycles"`
+	Reclaimed      int64         `json:"reclaimed"`       // keys deleted by the collector since the start
+	LastReclaimed  int64         `json:"last_reclaimed"`  // keys deleted by the last cycle
+	LastDuration   time.Duration `json:"last_duration"`   // duration of the last cycle in nanoseconds
+	BudgetExceeded int64         `json:"budget_exceeded"` // cycles stopped by the time budget with due keys left
+	Tracked        int           `json:"tracked"`         // keys with expiration time
+}
+
+type gcStats struct {
+	cycles         atomic.Int64
+	reclaimed      atomic.Int64
+	lastReclaimed  atomic.Int64
+	lastDuration   atomic.Int64
+	budgetExceeded atomic.Int64
+	nextShard      atomic.Int64 // the shard the next cycle starts from
+}
+
+// GarbageCollect deletes the expired keys of every database in the order of their expiration time.
+// A cycle stops after gcTimeBudget, the next one continues from the shard where it stopped.
+func (r *Storage) GarbageCollect() {
+	r.logger.Info("garbage collection started")
+
+	start := time.Now()
+	deadline := start.Add(gcTimeBudget)
+	shards := r.allShards()
+	first := int(r.gcStats.nextShard.Load())
+	reclaimed := 0
+	exceeded := false
+
+loop:
+	for i := 0; i < len(shards); i++ {
+		idx := (first + i) % len(shards)
+		s := shards[idx]
+		for {
+			s.mu.Lock()
+			n, more := s.collectExpired(time.Now().UnixMilli(), gcBatchSize)
+			s.mu.Unlock()
+
+			reclaimed += n
+			if !more {
+				break
+			}
+			if time.Now().After(deadline) {
+				exceeded = true
+				r.gcStats.nextShard.Store(int64(idx))
+				break loop
+			}
+		}
+	}
+
+	duration := time.Since(start)
+	r.gcStats.cycles.Add(1)
+	r.gcStats.reclaimed.Add(int64(reclaimed))
+	r.gcStats.lastReclaimed.Store(int64(reclaimed))
+	r.gcStats.lastDuration.Store(int64(duration))
+	if exceeded {
+		r.gcStats.budgetExceeded.Add(1)
+	}
+
+	r.logger.Info("garbage collection finished", zap.Int("reclaimed", reclaimed),
+		zap.Duration("duration", duration), zap.Bool("budget exceeded", exceeded))
+}
+
+// ExpireStats returns the garbage collector metrics.
+func (r *Storage) ExpireStats() ExpireStats {
+	tracked := 0
+	for _, s := range r.allShards() {
+		s.mu.RLock()
+		tracked += s.expiry.Len()
+		s.mu.RUnlock()
+	}
+
+	return ExpireStats{
+		Cycles:         r.gcStats.cycles.Load(),
+		Reclaimed:      r.gcStats.reclaimed.Load(),
+		LastReclaimed:  r.gcStats.lastReclaimed.Load(),
+		LastDuration:   time.Duration(r.gcStats.lastDuration.Load()),
+		BudgetExceeded: r.gcStats.budgetExceeded.Load(),
+		Tracked:        tracked,
+	}
+}
+
+// collectExpired deletes up to limit keys which expired before now.
+// It returns the number of deleted keys and whether there are due keys left.
+func (s *shard) collectExpired(now int64, limit int) (int, bool) {
+	deleted := 0
+	for s.expiry.Len() > 0 && s.expiry.items[0].at < now {
+		if deleted == limit {
+			return deleted, true
+		}
+		s.deleteKey(s.expiry.items[0].key)
+		deleted++
+	}
+	return deleted, false
+}
+
+// setExpiration sets the absolute expiration time of the key in unix milliseconds, 0 means no expiration.
+func (s *shard) setExpiration(key string, t int64) {
+	s.expirationTime[key] = t
+	if t != 0 {
+		s.expiry.set(key, t)
+	} else {
+		s.expiry.remove(key)
+	}
+}
+
+// forgetExpiration removes every trace of the key's expiration time.
+func (s *shard) forgetExpiration(key string) {
+	delete(s.expirationTime, key)
+	s.expiry.remove(key)
+}
+
+type expiryItem struct {
+	key string
+	at  int64
+}
+
+// expiryIndex is a min-heap of keys ordered by their expiration time.
+// It remembers the position of every key, so a key is updated or removed in O(log n).
+type expiryIndex struct {
+	items []expiryItem
+	pos   map[string]int
+}
+
+func newExpiryIndex() *expiryIndex {
+	return &expiryIndex{pos: make(map[string]int)}
+}
+
+func (e *expiryIndex) set(key string, at int64) {
+	if i, ok := e.pos[key]; ok {
+		e.items[i].at = at
+		heap.Fix(e, i)
+		return
+	}
+	heap.Push(e, expiryItem{key: key, at: at})
+}
+
+func (e *expiryIndex) remove(key string) {
+	if i, ok := e.pos[key]; ok {
+		heap.Remove(e, i)
+	}
+}
+
+func (e *expiryIndex) Len() int           { return len(e.items) }
+func (e *expiryIndex) Less(i, j int) bool { return e.items[i].at < e.items[j].at }
+func (e *expiryIndex) Swap(i, j int) {
+	e.items[i], e.items[j] = e.items[j], e.items[i]
+	e.pos[e.items[i].key] = i
+	e.pos[e.items[j].key] = j
+}
+
+func (e *expiryIndex) Push(x any) {
+	item := x.(expiryItem)
+	e.pos[item.key] = len(e.items)
+	e.items = append(e.items, item)
+}
+
+func (e *expiryIndex) Pop() any {
+	item := e.items[len(e.items)-1]
+	e.items = e.items[:len(e.items)-1]
+	delete(e.pos, item.key)
+	return item
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"container/heap"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiryIndex(t *testing.T) {
+	e := newExpiryIndex()
+	e.set("a", 30)
+	e.set("b", 10)
+	e.set("c", 20)
+	e.set("d", 40)
+
+	e.set("d", 5)  // moves up
+	e.set("b", 50) // moves down
+	e.remove("c")
+	e.remove("missing")
+
+	got := make([]string, 0)
+	for e.Len() > 0 {
+		got = append(got, heap.Pop(e).(expiryItem).key)
+	}
+	assert.Equal(t, []string{"d", "a", "b"}, got)
+	assert.Empty(t, e.pos)
+}
+
+func TestGarbageCollectReclaimsDueKeys(t *testing.T) {
+	r := newTestStorage(t)
+
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, r.SetPX("due"+strconv.Itoa(i), "value", 500))
+	}
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, r.Set("alive"+strconv.Itoa(i), "value", 100))
+		assert.NoError(t, r.Set("persistent"+strconv.Itoa(i), "value"))
+	}
+	// expiration changes must be reflected by the index
+	assert.True(t, r.Persist("due0"))
+	assert.True(t, expire(t, r, "due1", 100))
+	_, err := r.Rpush("list", "1")
+	assert.NoError(t, err)
+	assert.True(t, pexpire(t, r, "list", 500))
+	_, err = r.Hset("hash", "field", "value")
+	assert.NoError(t, err)
+	assert.True(t, pexpire(t, r, "hash", 500))
+	_, err = r.Hdel("hash", "field")
+	assert.NoError(t, err)
+
+	time.Sleep(600 * time.Millisecond)
+	r.GarbageCollect()
+
+	stats := r.ExpireStats()
+	assert.Equal(t, int64(1), stats.Cycles)
+	assert.Equal(t, int64(998+1), stats.LastReclaimed)
+	assert.Equal(t, stats.LastReclaimed, stats.Reclaimed)
+	assert.Equal(t, int64(0), stats.BudgetExceeded)
+	assert.Equal(t, 10+1, stats.Tracked)
+
+	keys := 0
+	for _, s := range r.shards {
+		keys += len(s.inner) + len(s.arrays) + len(s.hashes)
+	}
+	assert.Equal(t, 10+10+2, keys)
+
+	r.GarbageCollect()
+	stats = r.ExpireStats()
+	assert.Equal(t, int64(2), stats.Cycles)
+	assert.Equal(t, int64(0), stats.LastReclaimed)
+}
+
+func TestCollectExpiredLimit(t *testing.T) {
+	r := newTestStorage(t)
+	s := newShards(r.logger, r.memory, DefaultDB)[0]
+
+	for i := 0; i < 5; i++ {
+		key := strconv.Itoa(i)
+		s.inner[key] = &val{valueType: KindString, stringValue: "value"}
+		s.setExpiration(key, int64(10+i))
+	}
+
+	n, more := s.collectExpired(100, 3)
+	assert.Equal(t, 3, n)
+	assert.True(t, more)
+
+	n, more = s.collectExpired(14, 3)
+	assert.Equal(t, 1, n)
+	assert.False(t, more)
+
+	assert.Equal(t, 1, s.expiry.Len())
+	assert.Len(t, s.inner, 1)
+	assert.Contains(t, s.inner, "4")
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"errors"
+	"math"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNotInteger    = errors.New("value is not an integer or out of range")
+	ErrOverflow      = errors.New("increment or decrement would overflow")
+	ErrFloatOverflow = errors.New("increment would produce NaN or Infinity")
+)
+
+// IncrBy adds delta to the integer stored at key and returns the new value.
+// A missing key is created with 0 first, the expiration of an existing key is kept.
+// ErrNotInteger is returned if the key holds a value of another kind
+// and ErrOverflow if the result doesnt fit into int64, the value is not changed then.
+func (r *Storage) IncrBy(key string, delta int64) (int64, error) {
+	if err := r.reserve(); err != nil {
+		return 0, err
+	}
+
+	s, unlock := r.lock(key)
+	defer unlock()
+
+	s.dropExpired(key)
+	if err := s.checkType(key, TypeString); err != nil {
+		return 0, err
+	}
+
+	current := int64(0)
+	if v, ok := s.inner[key]; ok {
+		if v.valueType != KindInt {
+			r.logger.Info("value is not an integer", zap.String("key", key))
+			return 0, ErrNotInteger
+		}
+		current = int64(v.intValue)
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		r.logger.Info("integer overflow", zap.String("key", key),
+			zap.Int64("val", current), zap.Int64("delta", delta))
+		return 0, ErrOverflow
+	}
+
+	result := current + delta
+	s.inner[key] = &val{
+		valueType: KindInt,
+		intValue:  int(result),
+	}
+	// a new key gets no expiration, an existing one keeps it
+	t := s.expirationTime[key]
+	s.setExpiration(key, t)
+	s.resize(key)
+
+	// the result is logged as a set, so replaying it does not depend on the value before
+	r.propagate(setRecord(key, s.inner[key].string(), KindAuto, t))
+	r.logger.Info("integer incremented", zap.String("key", key), zap.Int64("delta", delta), zap.Int64("val", result))
+	return result, nil
+}
+
+// IncrByFloat adds delta to the number stored at key and returns the new value.
+// Both KindInt and KindFloat values can be incremented, the result is stored
+// the way Set would store its canonical form, so 1.5 + 0.5 gives the KindInt 2.
+// A missing key is created with 0 first, the expiration of an existing key is kept.
+// ErrNotFloat is returned if the key holds a value of another kind
+// and ErrFloatOverflow if the result is an infinity.
+func (r *Storage) IncrByFloat(key string, delta float64) (float64, error) {
+	if math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return 0, ErrNotFloat
+	}
+	if err := r.reserve(); err != nil {
+		return 0, err
+	}
+
+	s, unlock := r.lock(key)
+	defer unlock()
+
+	s.dropExpired(key)
+	if err := s.checkType(key, TypeString); err != nil {
+		return 0, err
+	}
+
+	current := float64(0)
+	if v, ok := s.inner[key]; ok {
+		switch v.valueType {
+		case KindInt:
+			current = float64(v.intValue)
+		case KindFloat:
+			current = v.floatValue
+		default:
+			r.logger.Info("value is not a number", zap.String("key", key))
+			return 0, ErrNotFloat
+		}
+	}
+
+	result := current + delta
+	if math.IsInf(result, 0) {
+		r.logger.Info("float overflow", zap.String("key", key),
+			zap.Float64("val", current), zap.Float64("delta", delta))
+		return 0, ErrFloatOverflow
+	}
+
+	t := s.expirationTime[key]
+	formatted := formatFloat(result)
+	s.set(key, formatted, KindAuto, t)
+	s.resize(key)
+
+	r.propagate(setRecord(key, formatted, KindAuto, t))
+	r.logger.Info("float incremented", zap.String("key", key), zap.Float64("delta", delta), zap.Float64("val", result))
+	return result, nil
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncrBy(t *testing.T) {
+	r := newTestStorage(t)
+
+	// a missing key starts from 0
+	n, err := r.IncrBy("counter", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	n, err = r.IncrBy("counter", -7)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-2), n)
+
+	kind, err := r.GetKind("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, KindInt, kind)
+
+	// the expiration is kept
+	assert.NoError(t, r.Set("ttl", "10", 100))
+	n, err = r.IncrBy("ttl", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), n)
+	assert.Greater(t, r.TTL("ttl"), int64(90))
+
+	assert.NoError(t, r.Set("string", "value"))
+	_, err = r.IncrBy("string", 1)
+	assert.ErrorIs(t, err, ErrNotInteger)
+
+	_, err = r.Rpush("list", "1")
+	assert.NoError(t, err)
+	_, err = r.IncrBy("list", 1)
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+
+	assert.NoError(t, r.Set("max", strconv.FormatInt(math.MaxInt64, 10)))
+	_, err = r.IncrBy("max", 1)
+	assert.ErrorIs(t, err, ErrOverflow)
+	n, err = r.IncrBy("max", -1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(math.MaxInt64-1), n)
+
+	assert.NoError(t, r.Set("min", strconv.FormatInt(math.MinInt64, 10)))
+	_, err = r.IncrBy("min", -1)
+	assert.ErrorIs(t, err, ErrOverflow)
+	value, err := r.Get("min")
+	assert.NoError(t, err)
+	assert.Equal(t, strconv.FormatInt(math.MinInt64, 10), value)
+}
+
+func TestConcurrentIncrBy(t *testing.T) {
+	r := newTestStorage(t)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				_, err := r.IncrBy("counter", 1)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, err := r.Get("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, "800", value)
+}
+
+func TestIncrByFloat(t *testing.T) {
+	r := newTestStorage(t)
+
+	f, err := r.IncrByFloat("counter", 1.5)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, f)
+	value, k, err := r.GetTyped("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, "1.5", value)
+	assert.Equal(t, KindFloat, k)
+
+	// a whole result is stored as an integer
+	f, err = r.IncrByFloat("counter", 0.5)
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, f)
+	_, k, _ = r.GetTyped("counter")
+	assert.Equal(t, KindInt, k)
+	n, err := r.IncrBy("counter", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	assert.NoError(t, r.Set("ttl", "10.25", 100))
+	f, err = r.IncrByFloat("ttl", -0.25e1)
+	assert.NoError(t, err)
+	assert.Equal(t, 7.75, f)
+	assert.Greater(t, r.TTL("ttl"), int64(90))
+
+	_, err = r.IncrBy("ttl", 1)
+	assert.ErrorIs(t, err, ErrNotInteger)
+
+	assert.NoError(t, r.Set("string", "1.50"))
+	_, err = r.IncrByFloat("string", 1)
+	assert.ErrorIs(t, err, ErrNotFloat)
+	_, err = r.IncrByFloat("counter", math.Inf(1))
+	assert.ErrorIs(t, err, ErrNotFloat)
+
+	assert.NoError(t, r.SetTyped("max", "1.7e308", KindFloat, 0))
+	_, err = r.IncrByFloat("max", 1.7e308)
+	assert.ErrorIs(t, err, ErrFloatOverflow)
+}
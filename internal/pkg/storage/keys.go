@@ -0,0 +1,314 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// Types of values stored at keys, as returned by TYPE and accepted by SCAN.
+const (
+	TypeNone   = "none"
+	TypeString = "string"
+	TypeList   = "list"
+	TypeHash   = "hash"
+	TypeZSet   = "zset"
+	TypeSet    = "set"
+)
+
+const defaultScanCount = 10
+
+type ScanOptions struct {
+	Match string // glob pattern, empty matches every key
+	Count int    // how many keys to look through, 10 by default
+	Type  string // TypeString, TypeList, TypeHash, TypeZSet or TypeSet, empty means any type
+}
+
+// Keys returns sorted keys matching the glob pattern.
+// Supported wildcards: *, ?, [abc], [^abc], [a-z] and \ to escape them.
+func (r *Storage) Keys(pattern string) []string {
+	keys := r.filterKeys(func(key string) bool {
+		return matchGlob(pattern, key)
+	})
+
+	r.logger.Info("keys requested", zap.String("pattern", pattern), zap.Int("count", len(keys)))
+	return keys
+}
+
+// KeysRegexp returns sorted keys matching the regular expression.
+func (r *Storage) KeysRegexp(expr string) ([]string, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIncorrectArgs, err)
+	}
+
+	keys := r.filterKeys(re.MatchString)
+
+	r.logger.Info("keys requested", zap.String("regexp", expr), zap.Int("count", len(keys)))
+	return keys, nil
+}
+
+// filterKeys walks the shards one by one and returns sorted keys accepted by match.
+func (r *Storage) filterKeys(match func(key string) bool) []string {
+	keys := make([]string, 0)
+	for _, s := range r.shards {
+		runlock := r.rlockShard(s)
+		s.walkKeys(func(key string) {
+			if match(key) {
+				keys = append(keys, key)
+			}
+		})
+		runlock()
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Scan iterates over the keyspace in small batches. Start with cursor 0 and pass
+// the returned cursor to the next call, the iteration is over when it returns 0.
+// Keys which exist during the whole iteration are returned at least once.
+//
+// Keys are ordered by their hash and the cursor is the next hash to continue from.
+// The top bits of the hash select the shard, so a call walks the shards one by one
+// holding a single shard lock at a time.
+// Like in redis, MATCH and TYPE are applied after the batch is taken,
+// so a call may return no keys while the iteration is not over yet.
+func (r *Storage) Scan(cursor uint64, opts ScanOptions) (uint64, []string, error) {
+	switch opts.Type {
+	case "", TypeString, TypeList, TypeHash, TypeZSet, TypeSet:
+	default:
+		return 0, nil, ErrIncorrectArgs
+	}
+	count := opts.Count
+	if count < 0 {
+		return 0, nil, ErrIncorrectArgs
+	}
+	if count == 0 {
+		count = defaultScanCount
+	}
+
+	keys := make([]string, 0, count)
+	taken := 0
+	for {
+		idx := cursor >> shardShift
+		s := r.shards[idx]
+
+		runlock := r.rlockShard(s)
+		next, batch, n := s.scan(cursor, count-taken, opts)
+		runlock()
+
+		keys = append(keys, batch...)
+		taken += n
+
+		if next == 0 {
+			// the shard is over, continue from the beginning of the next one
+			if idx+1 == shardCount {
+				cursor = 0
+				break
+			}
+			next = (idx + 1) << shardShift
+		}
+		cursor = next
+		if taken >= count {
+			break
+		}
+	}
+
+	r.logger.Info("keyspace scanned", zap.Uint64("next cursor", cursor), zap.Int("count", len(keys)))
+	return cursor, keys, nil
+}
+
+// scan takes up to count keys of the shard with hashes starting from cursor.
+// It returns the cursor to continue from or 0 if the shard is over,
+// the keys which passed the filters and the number of keys taken before filtering.
+// The position of the cursor is found by a binary search in the sorted keys of the shard,
+// so a call costs O(log n + count) until a key is added or deleted and the keys are sorted again.
+func (s *shard) scan(cursor uint64, count int, opts ScanOptions) (uint64, []string, int) {
+	entries := s.sortedKeys()
+	from := sort.Search(len(entries), func(i int) bool { return entries[i].hash >= cursor })
+	if from == len(entries) {
+		return 0, nil, 0
+	}
+	to := min(from+count, len(entries))
+	// keys with equal hashes never get split between batches
+	for to < len(entries) && entries[to].hash == entries[to-1].hash {
+		to++
+	}
+
+	keys := make([]string, 0, to-from)
+	for _, e := range entries[from:to] {
+		if s.expired(e.key) {
+			continue
+		}
+		if opts.Match != "" && !matchGlob(opts.Match, e.key) {
+			continue
+		}
+		if opts.Type != "" && s.keyType(e.key) != opts.Type {
+			continue
+		}
+		keys = append(keys, e.key)
+	}
+
+	if to == len(entries) {
+		return 0, keys, to - from
+	}
+	return entries[to-1].hash + 1, keys, to - from
+}
+
+// scanIndex holds the keys of a shard sorted by their hashes.
+type scanIndex struct {
+	keysVersion uint64
+	entries     []scanEntry
+}
+
+type scanEntry struct {
+	hash uint64
+	key  string
+}
+
+// sortedKeys returns the keys of the shard sorted by their hashes, expired ones included.
+// It needs the read lock, the readers which find the index outdated build it concurrently
+// and the last one stays.
+func (s *shard) sortedKeys() []scanEntry {
+	if idx := s.scanIndex.Load(); idx != nil && idx.keysVersion == s.keysVersion {
+		return idx.entries
+	}
+
+	entries := make([]scanEntry, 0, len(s.meta))
+	add := func(key string) {
+		entries = append(entries, scanEntry{hash: keyHash(key), key: key})
+	}
+	for key := range s.inner {
+		add(key)
+	}
+	for key := range s.arrays {
+		add(key)
+	}
+	for key := range s.hashes {
+		add(key)
+	}
+	for key := range s.zsets {
+		add(key)
+	}
+	for key := range s.sets {
+		add(key)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].hash != entries[j].hash {
+			return entries[i].hash < entries[j].hash
+		}
+		return entries[i].key < entries[j].key
+	})
+
+	s.scanIndex.Store(&scanIndex{keysVersion: s.keysVersion, entries: entries})
+	return entries
+}
+
+// keyHash is a 64-bit FNV-1a hash of the key.
+func keyHash(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// matchGlob reports whether str matches the redis-style glob pattern.
+// Only the last star is backtracked to: when the rest of the pattern fails, the star takes
+// one more rune, so the match takes O(len(pattern)*len(str)) whatever the number of stars.
+func matchGlob(pattern, str string) bool {
+	starPattern, starStr := "", ""
+	star := false
+	for {
+		if len(pattern) > 0 && pattern[0] == '*' {
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			star = true
+			starPattern, starStr = pattern, str
+			continue
+		}
+		if len(pattern) == 0 && len(str) == 0 {
+			return true
+		}
+		if len(pattern) > 0 && len(str) > 0 {
+			if rest, tail, ok := matchRune(pattern, str); ok {
+				pattern, str = rest, tail
+				continue
+			}
+		}
+		if !star || len(starStr) == 0 {
+			return false
+		}
+		_, size := utf8.DecodeRuneInString(starStr)
+		starStr = starStr[size:]
+		pattern, str = starPattern, starStr
+	}
+}
+
+// matchRune matches the first rune of str against the first element of the pattern, which is not a star.
+// It returns the rest of the pattern and of str and whether the rune matched.
+func matchRune(pattern, str string) (string, string, bool) {
+	c, size := utf8.DecodeRuneInString(str)
+	switch pattern[0] {
+	case '?':
+		return pattern[1:], str[size:], true
+	case '[':
+		rest, ok := matchClass(pattern[1:], c)
+		return rest, str[size:], ok
+	default:
+		if pattern[0] == '\\' && len(pattern) > 1 {
+			pattern = pattern[1:]
+		}
+		p, psize := utf8.DecodeRuneInString(pattern)
+		return pattern[psize:], str[size:], p == c
+	}
+}
+
+// matchClass matches c against the character class which starts right after '['.
+// It returns the pattern after the closing ']' and whether c belongs to the class.
+// An unterminated class lasts till the end of the pattern.
+func matchClass(pattern string, c rune) (string, bool) {
+	negate := false
+	if len(pattern) > 0 && pattern[0] == '^' {
+		negate = true
+		pattern = pattern[1:]
+	}
+
+	matched := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		if pattern[0] == '\\' && len(pattern) > 1 {
+			pattern = pattern[1:]
+		}
+		lo, size := utf8.DecodeRuneInString(pattern)
+		pattern = pattern[size:]
+
+		hi := lo
+		if len(pattern) > 1 && pattern[0] == '-' && pattern[1] != ']' {
+			pattern = pattern[1:]
+			if pattern[0] == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			hi, size = utf8.DecodeRuneInString(pattern)
+			pattern = pattern[size:]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+	}
+	if len(pattern) > 0 {
+		pattern = pattern[1:]
+	}
+
+	return pattern, matched != negate
+}
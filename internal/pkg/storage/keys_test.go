@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern string
+		str     string
+		match   bool
+	}{
+		{"*", "", true},
+		{"*", "anything/with/slashes", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "hllo", true},
+		{"h*llo", "heeeello", true},
+		{"h*llo", "hellow", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[c-a]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"user:*:name", "user:42:name", true},
+		{"user:*:name", "user:42:age", false},
+		{"п?ивет", "привет", true},
+		{"[abc", "b", true},
+		{"*a*b", "xaxb", true},
+		{"a*b*c", "abxbc", true},
+		{"a*b*c", "abxbcd", false},
+		{"*?", "", false},
+		{"*[xy]", "abcy", true},
+		{`\`, `\`, true},
+		// the stars don't multiply the work
+		{"a*a*a*a*a*a*a*b", strings.Repeat("a", 10000), false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.match, matchGlob(c.pattern, c.str), "pattern %q, string %q", c.pattern, c.str)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	r := newTestStorage(t)
+
+	r.Set("user:1", "bob")
+	r.Set("user:2", "alice")
+	r.Rpush("users", "1", "2")
+	r.Hset("user:3:info", "name", "eve")
+	r.SetPX("user:4", "expired", 1)
+	time.Sleep(10 * time.Millisecond)
+
+	assert.Equal(t, []string{"user:1", "user:2", "user:3:info", "users"}, r.Keys("*"))
+	assert.Equal(t, []string{"user:1", "user:2"}, r.Keys("user:?"))
+	assert.Equal(t, []string{}, r.Keys("nothing*"))
+
+	keys, err := r.KeysRegexp(`^user:\d+$`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user:1", "user:2"}, keys)
+
+	_, err = r.KeysRegexp(`(`)
+	assert.ErrorIs(t, err, ErrIncorrectArgs)
+}
+
+func TestScan(t *testing.T) {
+	r := newTestStorage(t)
+
+	for i := 0; i < 100; i++ {
+		r.Set("scalar:"+strconv.Itoa(i), "value")
+	}
+	for i := 0; i < 20; i++ {
+		r.Rpush("list:"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+
+	scanAll := func(opts ScanOptions) map[string]int {
+		seen := make(map[string]int)
+		cursor := uint64(0)
+		for calls := 0; ; calls++ {
+			if calls > 1000 {
+				t.Fatal("scan doesnt finish")
+			}
+			next, keys, err := r.Scan(cursor, opts)
+			assert.NoError(t, err)
+			for _, key := range keys {
+				seen[key]++
+			}
+			if next == 0 {
+				return seen
+			}
+			cursor = next
+		}
+	}
+
+	seen := scanAll(ScanOptions{Count: 7})
+	assert.Len(t, seen, 120)
+	for key, times := range seen {
+		assert.Equal(t, 1, times, "key %s", key)
+	}
+
+	seen = scanAll(ScanOptions{Match: "list:1*"})
+	assert.Len(t, seen, 11)
+
+	seen = scanAll(ScanOptions{Type: TypeList, Count: 1000})
+	assert.Len(t, seen, 20)
+
+	_, _, err := r.Scan(0, ScanOptions{Type: "unknown"})
+	assert.ErrorIs(t, err, ErrIncorrectArgs)
+}
+
+func TestScanWithModifications(t *testing.T) {
+	r := newTestStorage(t)
+
+	for i := 0; i < 50; i++ {
+		r.Set("stable:"+strconv.Itoa(i), "value")
+	}
+
+	seen := make(map[string]bool)
+	cursor := uint64(0)
+	for i := 0; ; i++ {
+		next, keys, err := r.Scan(cursor, ScanOptions{Count: 5})
+		assert.NoError(t, err)
+		for _, key := range keys {
+			seen[key] = true
+		}
+		r.Set("added:"+strconv.Itoa(i), "value")
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+
+	for i := 0; i < 50; i++ {
+		assert.True(t, seen["stable:"+strconv.Itoa(i)])
+	}
+}
+
+func TestScanIndex(t *testing.T) {
+	r := newTestStorage(t)
+
+	assert.NoError(t, r.Set("key", "value"))
+	s := r.shardOf("key")
+	cursor := uint64(shardIndex("key")) << shardShift
+	_, keys, err := r.Scan(cursor, ScanOptions{Count: 1})
+	assert.NoError(t, err)
+	assert.Contains(t, keys, "key")
+	idx := s.scanIndex.Load()
+
+	// changing a value keeps the sorted keys, adding or deleting a key sorts them again
+	assert.NoError(t, r.Set("key", "other"))
+	s.sortedKeys()
+	assert.Same(t, idx, s.scanIndex.Load())
+	assert.Equal(t, 1, r.Del("key"))
+	assert.Empty(t, s.sortedKeys())
+	assert.NotSame(t, idx, s.scanIndex.Load())
+	assert.NoError(t, r.Set("key", "value"))
+	assert.Len(t, s.sortedKeys(), 1)
+}
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"maps"
+	"slices"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// lockKeys write-locks the shards owning the keys in the order of their indexes
+// and returns the function unlocking them.
+func (r *Storage) lockKeys(keys ...string) func() {
+	indexes := make([]int, 0, len(keys))
+	for _, key := range keys {
+		indexes = append(indexes, shardIndex(key))
+	}
+	sort.Ints(indexes)
+	indexes = slices.Compact(indexes)
+
+	unlocks := make([]func(), 0, len(indexes))
+	for _, i := range indexes {
+		unlocks = append(unlocks, r.lockShard(r.shards[i]))
+	}
+	return func() {
+		for _, unlock := range slices.Backward(unlocks) {
+			unlock()
+		}
+	}
+}
+
+func (r *Storage) shardOf(key string) *shard {
+	return r.shards[shardIndex(key)]
+}
+
+// MGet returns the scalars stored at the keys, nil for missing keys and keys of other types.
+// The keys are read at the same moment.
+func (r *Storage) MGet(keys ...string) []*string {
+	unlock := r.lockKeys(keys...)
+	defer unlock()
+
+	values := make([]*string, len(keys))
+	for i, key := range keys {
+		s := r.shardOf(key)
+		s.dropExpired(key)
+		if v, ok := s.inner[key]; ok {
+			str := v.string()
+			values[i] = &str
+			s.touch(key)
+		}
+	}
+	return values
+}
+
+// MSet sets the scalars given as key value pairs without expiration.
+// Either every key is set or, if any of them holds a value of another type, none of them.
+func (r *Storage) MSet(args ...string) error {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return ErrIncorrectArgs
+	}
+	if err := r.reserve(); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		keys = append(keys, args[i])
+	}
+	unlock := r.lockKeys(keys...)
+	defer unlock()
+
+	for _, key := range keys {
+		s := r.shardOf(key)
+		s.dropExpired(key)
+		if err := s.checkType(key, TypeString); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < len(args); i += 2 {
+		key, value := args[i], args[i+1]
+		s := r.shardOf(key)
+		if err := s.set(key, value, KindAuto, 0); err != nil {
+			return err
+		}
+		s.resize(key)
+		r.propagate(setRecord(key, value, KindAuto, 0))
+	}
+	return nil
+}
+
+// Del deletes the keys of any type and returns how many of them existed.
+func (r *Storage) Del(keys ...string) int {
+	unlock := r.lockKeys(keys...)
+	defer unlock()
+
+	deleted := 0
+	for _, key := range keys {
+		s := r.shardOf(key)
+		s.dropExpired(key)
+		if !s.alive(key) {
+			continue
+		}
+
+		s.deleteKey(key)
+		r.propagate(aofRecord{Cmd: "del", Key: key})
+		r.logger.Info("key deleted", zap.String("key", key))
+		deleted++
+	}
+	return deleted
+}
+
+// Exists returns how many of the keys exist, a key given several times is counted every time.
+func (r *Storage) Exists(keys ...string) int {
+	count := 0
+	for _, key := range keys {
+		r.read(key, func(s *shard) error {
+			if s.alive(key) {
+				count++
+			}
+			return nil
+		})
+	}
+	return count
+}
+
+// Type returns the type of the value stored at key: TypeString, TypeList, TypeHash, TypeZSet, TypeSet or TypeNone.
+func (r *Storage) Type(key string) string {
+	typ := TypeNone
+	r.read(key, func(s *shard) error {
+		if s.alive(key) {
+			typ = s.keyType(key)
+		}
+		return nil
+	})
+	return typ
+}
+
+// Rename moves the value with its expiration from src to dst, the old value of dst is deleted.
+// Returns ErrKeyDoesntExist if there is no src.
+func (r *Storage) Rename(src, dst string) error {
+	unlock := r.lockKeys(src, dst)
+	defer unlock()
+
+	from := r.shardOf(src)
+	from.dropExpired(src)
+	if !from.alive(src) {
+		return ErrKeyDoesntExist
+	}
+	if src == dst {
+		return nil
+	}
+
+	e := from.dump(src)
+	from.deleteKey(src)
+	r.shardOf(dst).restore(dst, e)
+	r.propagate(aofRecord{Cmd: "rename", Key: src, Args: []string{dst}})
+	r.logger.Info("key renamed", zap.String("key", src), zap.String("to", dst))
+	return nil
+}
+
+// Copy copies the value with its expiration from src to dst. If dst exists, it is replaced
+// only with replace set, otherwise false is returned. Returns ErrKeyDoesntExist if there is no src.
+func (r *Storage) Copy(src, dst string, replace bool) (bool, error) {
+	if err := r.reserve(); err != nil {
+		return false, err
+	}
+
+	unlock := r.lockKeys(src, dst)
+	defer unlock()
+
+	from, to := r.shardOf(src), r.shardOf(dst)
+	from.dropExpired(src)
+	to.dropExpired(dst)
+	if !from.alive(src) {
+		return false, ErrKeyDoesntExist
+	}
+	if src == dst || (to.alive(dst) && !replace) {
+		return false, nil
+	}
+
+	to.restore(dst, from.dump(src))
+	r.propagate(aofRecord{Cmd: "copy", Key: src, Args: []string{dst}})
+	r.logger.Info("key copied", zap.String("key", src), zap.String("to", dst))
+	return true, nil
+}
+
+// entry is a copy of a key's value of any type with its expiration time.
+type entry struct {
+	value *val
+	list  *list
+	hash  map[string]string
+	zset  *zset
+	set   set
+	at    int64
+}
+
+// dump returns a copy of the value stored at key, which must exist.
+func (s *shard) dump(key string) entry {
+	e := entry{at: s.expirationTime[key]}
+	if v, ok := s.inner[key]; ok {
+		copied := *v
+		e.value = &copied
+	}
+	if l, ok := s.arrays[key]; ok {
+		e.list = l.clone()
+	}
+	if hash, ok := s.hashes[key]; ok {
+		e.hash = maps.Clone(hash)
+	}
+	if z, ok := s.zsets[key]; ok {
+		e.zset = z.clone()
+	}
+	if st, ok := s.sets[key]; ok {
+		e.set = maps.Clone(st)
+	}
+	return e
+}
+
+// restore replaces the value stored at key of any type with the dumped one.
+func (s *shard) restore(key string, e entry) {
+	if s.keyType(key) != TypeNone {
+		s.deleteKey(key)
+	}
+
+	switch {
+	case e.value != nil:
+		s.inner[key] = e.value
+	case e.list != nil:
+		s.arrays[key] = e.list
+	case e.hash != nil:
+		s.hashes[key] = e.hash
+	case e.zset != nil:
+		s.zsets[key] = e.zset
+	case e.set != nil:
+		s.sets[key] = e.set
+	}
+	s.setExpiration(key, e.at)
+	s.resize(key)
+	if e.list != nil {
+		s.wake(key)
+	}
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMGetMSet(t *testing.T) {
+	r := newTestStorage(t)
+
+	assert.NoError(t, r.MSet("a", "1", "b", "text", "a", "2"))
+	_, err := r.Rpush("list", "1")
+	assert.NoError(t, err)
+
+	values := r.MGet("a", "b", "missing", "list")
+	assert.Len(t, values, 4)
+	assert.Equal(t, "2", *values[0])
+	assert.Equal(t, "text", *values[1])
+	assert.Nil(t, values[2])
+	assert.Nil(t, values[3])
+
+	// nothing is set if any key has another type
+	assert.ErrorIs(t, r.MSet("c", "1", "list", "2"), ErrKeyAlreadyExists)
+	assert.Equal(t, 0, r.Exists("c"))
+
+	assert.ErrorIs(t, r.MSet("a"), ErrIncorrectArgs)
+	assert.ErrorIs(t, r.MSet(), ErrIncorrectArgs)
+}
+
+func TestDelExistsType(t *testing.T) {
+	r := newTestStorage(t)
+
+	assert.NoError(t, r.Set("string", "value"))
+	_, err := r.Rpush("list", "1", "2")
+	assert.NoError(t, err)
+	_, err = r.Hset("hash", "f", "v")
+	assert.NoError(t, err)
+	assert.NoError(t, r.SetPX("expired", "value", 1))
+	time.Sleep(5 * time.Millisecond)
+
+	assert.Equal(t, TypeString, r.Type("string"))
+	assert.Equal(t, TypeList, r.Type("list"))
+	assert.Equal(t, TypeHash, r.Type("hash"))
+	assert.Equal(t, TypeNone, r.Type("expired"))
+	assert.Equal(t, TypeNone, r.Type("missing"))
+
+	assert.Equal(t, 4, r.Exists("string", "list", "hash", "string", "expired", "missing"))
+	assert.Equal(t, 3, r.Del("string", "list", "hash", "expired", "missing"))
+	assert.Equal(t, 0, r.Exists("string", "list", "hash"))
+	assert.Equal(t, int64(0), r.MemoryStats().Used)
+}
+
+func TestRenameCopy(t *testing.T) {
+	r := newTestStorage(t)
+
+	assert.NoError(t, r.Set("src", "value", 100))
+	_, err := r.Hset("dst", "f", "v")
+	assert.NoError(t, err)
+
+	// the value of another type is replaced, the expiration is moved with the value
+	assert.NoError(t, r.Rename("src", "dst"))
+	v, err := r.Get("dst")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", v)
+	assert.Equal(t, int64(100), r.TTL("dst"))
+	assert.Equal(t, TypeNone, r.Type("src"))
+	assert.ErrorIs(t, r.Rename("src", "dst"), ErrKeyDoesntExist)
+	assert.NoError(t, r.Rename("dst", "dst"))
+
+	_, err = r.Rpush("list", "1", "2", "3")
+	assert.NoError(t, err)
+	copied, err := r.Copy("list", "dst", false)
+	assert.NoError(t, err)
+	assert.False(t, copied)
+	copied, err = r.Copy("list", "dst", true)
+	assert.NoError(t, err)
+	assert.True(t, copied)
+	assert.Equal(t, int64(-1), r.TTL("dst"))
+
+	// the copy is independent of the original
+	assert.NoError(t, r.Lset("dst", 0, "10"))
+	n, err := r.Lget("list", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", n)
+
+	_, err = r.Copy("missing", "dst", true)
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+}
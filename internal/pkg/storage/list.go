@@ -0,0 +1,555 @@
+package storage
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// list is the value of a list key. While every element is an integer in its canonical decimal form
+// the elements are kept as ints, which is several times smaller. The first other element turns
+// the list into a list of strings for good.
+type list struct {
+	ints  []int
+	strs  []string
+	text  bool // the elements are in strs
+	bytes int  // total length of strs
+}
+
+func newList() *list {
+	return &list{}
+}
+
+// listInt parses an element which can be kept as an int without changing its text.
+func listInt(element string) (int, bool) {
+	n, err := strconv.Atoi(element)
+	if err != nil || strconv.Itoa(n) != element {
+		return 0, false
+	}
+	return n, true
+}
+
+func (l *list) len() int {
+	if l.text {
+		return len(l.strs)
+	}
+	return len(l.ints)
+}
+
+// size estimates the memory taken by the elements.
+func (l *list) size() int64 {
+	if l.text {
+		return int64(arrayOverhead + cap(l.strs)*stringSize + l.bytes)
+	}
+	return int64(arrayOverhead + cap(l.ints)*intSize)
+}
+
+// fits reports whether the elements can be kept in the current form.
+func (l *list) fits(elements []string) bool {
+	if l.text {
+		return true
+	}
+	for _, element := range elements {
+		if _, ok := listInt(element); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// toText moves the elements to strs.
+func (l *list) toText() {
+	l.strs = make([]string, len(l.ints), cap(l.ints))
+	for i, n := range l.ints {
+		l.strs[i] = strconv.Itoa(n)
+		l.bytes += len(l.strs[i])
+	}
+	l.ints = nil
+	l.text = true
+}
+
+func (l *list) pushBack(elements ...string) {
+	if !l.fits(elements) {
+		l.toText()
+	}
+	if l.text {
+		l.strs = append(l.strs, elements...)
+		for _, element := range elements {
+			l.bytes += len(element)
+		}
+		return
+	}
+	for _, element := range elements {
+		n, _ := listInt(element)
+		l.ints = append(l.ints, n)
+	}
+}
+
+// pushFront prepends the elements as a block, keeping their order.
+func (l *list) pushFront(elements ...string) {
+	if !l.fits(elements) {
+		l.toText()
+	}
+	if l.text {
+		strs := make([]string, 0, len(elements)+len(l.strs))
+		strs = append(strs, elements...)
+		l.strs = append(strs, l.strs...)
+		for _, element := range elements {
+			l.bytes += len(element)
+		}
+		return
+	}
+	ints := make([]int, 0, len(elements)+len(l.ints))
+	for _, element := range elements {
+		n, _ := listInt(element)
+		ints = append(ints, n)
+	}
+	l.ints = append(ints, l.ints...)
+}
+
+func (l *list) index(i int) string {
+	if l.text {
+		return l.strs[i]
+	}
+	return strconv.Itoa(l.ints[i])
+}
+
+func (l *list) set(i int, element string) {
+	if !l.text {
+		if n, ok := listInt(element); ok {
+			l.ints[i] = n
+			return
+		}
+		l.toText()
+	}
+	l.bytes += len(element) - len(l.strs[i])
+	l.strs[i] = element
+}
+
+// elements returns a copy of the elements between the indexes, both are included.
+func (l *list) elements(from, to int) []string {
+	elements := make([]string, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		elements = append(elements, l.index(i))
+	}
+	return elements
+}
+
+// remove deletes the elements between the indexes, both are included, and returns them.
+// The elements taken from an end are resliced, like the old integer lists did.
+func (l *list) remove(from, to int) []string {
+	removed := l.elements(from, to)
+	if !l.text {
+		switch {
+		case from == 0:
+			l.ints = l.ints[to+1:]
+		case to == len(l.ints)-1:
+			l.ints = l.ints[:from]
+		default:
+			l.ints = append(l.ints[:from], l.ints[to+1:]...)
+		}
+		return removed
+	}
+
+	for i := from; i <= to; i++ {
+		l.bytes -= len(l.strs[i])
+		// the backing array must not keep the strings alive
+		l.strs[i] = ""
+	}
+	switch {
+	case from == 0:
+		l.strs = l.strs[to+1:]
+	case to == len(l.strs)-1:
+		l.strs = l.strs[:from]
+	default:
+		l.strs = append(l.strs[:from], l.strs[to+1:]...)
+		clear(l.strs[len(l.strs) : len(l.strs)+to-from+1])
+	}
+	return removed
+}
+
+// insert inserts the element before the index, the length of the list appends it.
+func (l *list) insert(i int, element string) {
+	if !l.fits([]string{element}) {
+		l.toText()
+	}
+	if l.text {
+		l.strs = slices.Insert(l.strs, i, element)
+		l.bytes += len(element)
+		return
+	}
+	n, _ := listInt(element)
+	l.ints = slices.Insert(l.ints, i, n)
+}
+
+// removeAt deletes the elements at the indexes, which are in any order.
+func (l *list) removeAt(indexes []int) {
+	indexes = slices.Clone(indexes)
+	slices.Sort(indexes)
+	if !l.text {
+		l.ints = removeSorted(l.ints, indexes)
+		return
+	}
+	for _, i := range indexes {
+		l.bytes -= len(l.strs[i])
+	}
+	l.strs = removeSorted(l.strs, indexes)
+}
+
+func removeSorted[T any](items []T, indexes []int) []T {
+	kept := items[:0]
+	j := 0
+	for i, item := range items {
+		if j < len(indexes) && indexes[j] == i {
+			j++
+			continue
+		}
+		kept = append(kept, item)
+	}
+	// the backing array must not keep the removed strings alive
+	clear(items[len(kept):])
+	return kept
+}
+
+// find returns the indexes of the elements equal to element, from the tail with rev.
+// The first skip matches are skipped, at most count are returned if count is positive
+// and at most maxLen elements are compared if maxLen is positive.
+func (l *list) find(element string, rev bool, skip, count, maxLen int) []int {
+	length := l.len()
+	if maxLen <= 0 || maxLen > length {
+		maxLen = length
+	}
+	n, ok := listInt(element)
+	if !l.text && !ok {
+		return nil
+	}
+
+	var found []int
+	for c := 0; c < maxLen; c++ {
+		i := c
+		if rev {
+			i = length - 1 - c
+		}
+		if l.text && l.strs[i] != element || !l.text && l.ints[i] != n {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		found = append(found, i)
+		if len(found) == count {
+			break
+		}
+	}
+	return found
+}
+
+// listRange turns the indexes of a range into the ones inside the list like redis does:
+// negative indexes count from the end and the range is cut by the ends of the list.
+// Returns false if the range is empty.
+func listRange(start, stop, length int) (int, int, bool) {
+	if start < 0 {
+		start = max(length+start, 0)
+	}
+	if stop < 0 {
+		stop += length
+	}
+	stop = min(stop, length-1)
+	return start, stop, start <= stop
+}
+
+func (l *list) contains(element string) bool {
+	if l.text {
+		return slices.Contains(l.strs, element)
+	}
+	n, ok := listInt(element)
+	return ok && slices.Contains(l.ints, n)
+}
+
+func (l *list) clone() *list {
+	return &list{ints: slices.Clone(l.ints), strs: slices.Clone(l.strs), text: l.text, bytes: l.bytes}
+}
+
+// MarshalJSON writes the elements of an integer list as numbers, so the snapshots
+// of such lists are the same as before the lists of strings, and the others as strings.
+func (l *list) MarshalJSON() ([]byte, error) {
+	if l.len() == 0 {
+		return []byte("[]"), nil
+	}
+	if l.text {
+		return json.Marshal(l.strs)
+	}
+	return json.Marshal(l.ints)
+}
+
+// UnmarshalJSON accepts numbers and strings, a list with any string is a list of strings.
+func (l *list) UnmarshalJSON(data []byte) error {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+
+	elements := make([]string, len(items))
+	text := false
+	for i, item := range items {
+		if len(item) > 0 && item[0] == '"' {
+			if err := json.Unmarshal(item, &elements[i]); err != nil {
+				return err
+			}
+			text = true
+			continue
+		}
+		var n int
+		if err := json.Unmarshal(item, &n); err != nil {
+			return err
+		}
+		elements[i] = strconv.Itoa(n)
+	}
+
+	*l = list{}
+	if text {
+		l.toText()
+	}
+	l.pushBack(elements...)
+	return nil
+}
+
+// ListSide is an end of a list.
+type ListSide string
+
+const (
+	ListLeft  = ListSide("left")
+	ListRight = ListSide("right")
+)
+
+// LPosOptions are the options of LPos, the zero value finds the first match.
+type LPosOptions struct {
+	Rank   int // the rank-th match is the first one returned, a negative rank searches from the tail, 0 is 1
+	Count  int // the number of matches to return, 0 means all of them
+	MaxLen int // the number of elements to compare, 0 means all of them
+}
+
+// listOf returns the list stored at key. Returns ErrKeyAlreadyExists
+// if the key holds a value of another type and ErrKeyDoesntExist if there is no key.
+func (s *shard) listOf(key string) (*list, error) {
+	if err := s.checkType(key, TypeList); err != nil {
+		return nil, err
+	}
+	l, ok := s.arrays[key]
+	if !ok || s.expired(key) {
+		return nil, ErrKeyDoesntExist
+	}
+	return l, nil
+}
+
+// Llen returns the length of the list.
+func (r *Storage) Llen(key string) (int, error) {
+	length := 0
+	err := r.read(key, func(s *shard) error {
+		l, err := s.listOf(key)
+		if err != nil {
+			return err
+		}
+		length = l.len()
+		return nil
+	})
+	return length, err
+}
+
+// Lrange returns the elements between the indexes, both are included. Negative indexes
+// count from the end and the indexes out of the list are cut by its ends, like in redis.
+func (r *Storage) Lrange(key string, start, stop int) ([]string, error) {
+	var elements []string
+	err := r.read(key, func(s *shard) error {
+		l, err := s.listOf(key)
+		if err != nil {
+			return err
+		}
+		from, to, ok := listRange(start, stop, l.len())
+		if !ok {
+			elements = []string{}
+			return nil
+		}
+		elements = l.elements(from, to)
+		return nil
+	})
+	return elements, err
+}
+
+// Linsert inserts the element before or after the first pivot and returns the new length
+// of the list or -1 if there is no pivot.
+func (r *Storage) Linsert(key string, before bool, pivot, element string) (int, error) {
+	if err := r.reserve(); err != nil {
+		return 0, err
+	}
+
+	s, unlock := r.lock(key)
+	defer unlock()
+
+	s.dropExpired(key)
+	l, err := s.listOf(key)
+	if err != nil {
+		return 0, err
+	}
+	found := l.find(pivot, false, 0, 1, 0)
+	if len(found) == 0 {
+		return -1, nil
+	}
+
+	i, where := found[0], "before"
+	if !before {
+		i, where = i+1, "after"
+	}
+	l.insert(i, element)
+	s.resize(key)
+	s.wake(key)
+	r.propagate(aofRecord{Cmd: "linsert", Key: key, Args: []string{where, pivot, element}})
+
+	r.logger.Info("element inserted", zap.String("key", key), zap.Int("index", i))
+	return l.len(), nil
+}
+
+// Lrem removes count elements equal to element from the head of the list, -count ones
+// from the tail if count is negative and all of them if count is 0. Returns the number of removed ones.
+func (r *Storage) Lrem(key string, count int, element string) (int, error) {
+	s, unlock := r.lock(key)
+	defer unlock()
+
+	s.dropExpired(key)
+	l, err := s.listOf(key)
+	if err != nil {
+		return 0, err
+	}
+	found := l.find(element, count < 0, 0, max(count, -count), 0)
+	if len(found) == 0 {
+		return 0, nil
+	}
+
+	l.removeAt(found)
+	s.resize(key)
+	r.propagate(aofRecord{Cmd: "lrem", Key: key, Ints: []int{count}, Args: []string{element}})
+
+	r.logger.Info("elements removed", zap.String("key", key), zap.Int("removed", len(found)))
+	return len(found), nil
+}
+
+// Ltrim leaves only the elements between the indexes, both are included,
+// the indexes work like in Lrange. The list can become empty.
+func (r *Storage) Ltrim(key string, start, stop int) error {
+	s, unlock := r.lock(key)
+	defer unlock()
+
+	s.dropExpired(key)
+	l, err := s.listOf(key)
+	if err != nil {
+		return err
+	}
+
+	length := l.len()
+	if from, to, ok := listRange(start, stop, length); !ok {
+		if length > 0 {
+			l.remove(0, length-1)
+		}
+	} else {
+		if to < length-1 {
+			l.remove(to+1, length-1)
+		}
+		if from > 0 {
+			l.remove(0, from-1)
+		}
+	}
+	s.resize(key)
+	r.propagate(aofRecord{Cmd: "ltrim", Key: key, Ints: []int{start, stop}})
+
+	r.logger.Info("list trimmed", zap.String("key", key), zap.Int("length", l.len()))
+	return nil
+}
+
+// Lpos returns the indexes of the elements equal to element, see LPosOptions.
+func (r *Storage) Lpos(key string, element string, opts LPosOptions) ([]int, error) {
+	if opts.Count < 0 || opts.MaxLen < 0 {
+		return nil, ErrIncorrectArgs
+	}
+
+	var found []int
+	err := r.read(key, func(s *shard) error {
+		l, err := s.listOf(key)
+		if err != nil {
+			return err
+		}
+		// -Rank would overflow for math.MinInt
+		skip := 0
+		switch {
+		case opts.Rank > 0:
+			skip = opts.Rank - 1
+		case opts.Rank < 0:
+			skip = -(opts.Rank + 1)
+		}
+		found = l.find(element, opts.Rank < 0, skip, opts.Count, opts.MaxLen)
+		return nil
+	})
+	return found, err
+}
+
+// Lmove pops an element from the side of the list at src, pushes it to the side of the list at dst
+// and returns it. The list at dst is created if there is none, src and dst can be the same list.
+// Returns ErrIndexOutOfRange if the list at src is empty.
+func (r *Storage) Lmove(src, dst string, from, to ListSide) (string, error) {
+	if !from.valid() || !to.valid() {
+		return "", ErrIncorrectArgs
+	}
+	if err := r.reserve(); err != nil {
+		return "", err
+	}
+
+	unlock := r.lockKeys(src, dst)
+	defer unlock()
+	return r.lmove(src, dst, from, to)
+}
+
+// lmove is Lmove for the locked shards of src and dst.
+func (r *Storage) lmove(src, dst string, from, to ListSide) (string, error) {
+	fromShard, toShard := r.shardOf(src), r.shardOf(dst)
+	fromShard.dropExpired(src)
+	toShard.dropExpired(dst)
+	l, err := fromShard.listOf(src)
+	if err != nil {
+		return "", err
+	}
+	if err := toShard.checkType(dst, TypeList); err != nil {
+		return "", err
+	}
+	if l.len() == 0 {
+		return "", ErrIndexOutOfRange
+	}
+
+	i := 0
+	if from == ListRight {
+		i = l.len() - 1
+	}
+	element := l.remove(i, i)[0]
+	fromShard.resize(src)
+
+	if _, ok := toShard.arrays[dst]; !ok {
+		toShard.arrays[dst] = newList()
+		toShard.setExpiration(dst, 0)
+	}
+	if to == ListLeft {
+		toShard.arrays[dst].pushFront(element)
+	} else {
+		toShard.arrays[dst].pushBack(element)
+	}
+	toShard.resize(dst)
+	toShard.wake(dst)
+	r.propagate(aofRecord{Cmd: "lmove", Key: src, Args: []string{dst, string(from), string(to)}})
+
+	r.logger.Info("element moved", zap.String("key", src), zap.String("to", dst))
+	return element, nil
+}
+
+func (side ListSide) valid() bool {
+	return side == ListLeft || side == ListRight
+}
@@ -0,0 +1,339 @@
+package storage
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringList(t *testing.T) {
+	r := newTestStorage(t)
+
+	n, err := r.Rpush("list", "1", "2", "3")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.False(t, r.shardOf("list").arrays["list"].text)
+
+	// an element which is not an integer turns the list into a list of strings
+	n, err = r.Rpush("list", "job:1", `{"id":2}`)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.True(t, r.shardOf("list").arrays["list"].text)
+	n, err = r.Lpush("list", "a", "b")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, n)
+
+	v, err := r.Lget("list", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", v)
+	assert.NoError(t, r.Lset("list", 2, "one"))
+	v, _ = r.Lget("list", 2)
+	assert.Equal(t, "one", v)
+
+	assert.NoError(t, r.Raddtoset("list", "a", "c", "2"))
+	popped, err := r.Rpop("list", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`{"id":2}`, "c"}, popped)
+	popped, err = r.Lpop("list")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, popped)
+	deleted, err := r.DeleteSegment("list", 1, -2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"one", "2", "3"}, deleted)
+	popped, err = r.Lpop("list", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "job:1"}, popped)
+	assert.Equal(t, exactUsage(r), r.MemoryStats().Used)
+}
+
+func TestIntegerList(t *testing.T) {
+	r := newTestStorage(t)
+
+	// only the canonical form of an integer can be kept as an int
+	_, err := r.Rpush("list", "1", "-2", "0")
+	assert.NoError(t, err)
+	assert.NoError(t, r.Lset("list", 0, "10"))
+	assert.NoError(t, r.Raddtoset("list", "10", "-2", "3"))
+	assert.False(t, r.shardOf("list").arrays["list"].text)
+	_, err = r.Rpush("list", "07")
+	assert.NoError(t, err)
+	assert.True(t, r.shardOf("list").arrays["list"].text)
+	v, err := r.Lget("list", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, "07", v)
+
+	_, err = r.Rpush("ints", "1", "2")
+	assert.NoError(t, err)
+	popped, err := r.Lpop("ints", 3)
+	assert.ErrorIs(t, err, ErrIndexOutOfRange)
+	// the length is returned instead of the elements
+	assert.Equal(t, []string{"2"}, popped)
+	assert.NoError(t, r.Lset("ints", 1, "two"))
+	popped, err = r.Rpop("ints", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "two"}, popped)
+	assert.Equal(t, exactUsage(r), r.MemoryStats().Used)
+}
+
+func TestListMarshal(t *testing.T) {
+	r := newTestStorage(t)
+
+	_, err := r.Rpush("ints", "1", "2", "3")
+	assert.NoError(t, err)
+	_, err = r.Rpush("strings", "a", "1")
+	assert.NoError(t, err)
+	_, err = r.Rpush("empty", "a")
+	assert.NoError(t, err)
+	_, err = r.Lpop("empty")
+	assert.NoError(t, err)
+
+	data, err := json.Marshal(r)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"ints":[1,2,3]`)
+	assert.Contains(t, string(data), `"strings":["a","1"]`)
+
+	r2 := newTestStorage(t)
+	assert.NoError(t, json.Unmarshal(data, r2))
+	assertSameData(t, r, r2)
+	assert.Equal(t, r.MemoryStats().Used, r2.MemoryStats().Used)
+
+	// the snapshots written before the lists of strings have arrays of numbers
+	assert.NoError(t, json.Unmarshal([]byte(`{"inner":{},"arrays":{"old":[5,6]},"ExpirationTime":{}}`), r2))
+	v, err := r2.Lget("old", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "6", v)
+	assert.False(t, r2.shardOf("old").arrays["old"].text)
+	assert.Error(t, json.Unmarshal([]byte(`{"arrays":{"bad":[1.5]}}`), r2))
+}
+
+func TestAOFOldListRecords(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	records := `{"cmd":"rpush","key":"list","ints":[1,2,3]}
+{"cmd":"lpush","key":"list","ints":[0]}
+{"cmd":"raddtoset","key":"list","ints":[3,4]}
+{"cmd":"lset","key":"list","ints":[0,10]}
+{"cmd":"lpop","key":"list"}
+`
+	assert.NoError(t, os.WriteFile(filename, []byte(records), 0666))
+
+	r := newAOFStorage(t, filename)
+	popped, err := r.Lpop("list", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3", "4"}, popped)
+}
+
+func TestListNegativeIndexes(t *testing.T) {
+	r := newTestStorage(t)
+
+	_, err := r.Rpush("list", "a", "b", "c")
+	assert.NoError(t, err)
+	v, err := r.Lget("list", -1)
+	assert.NoError(t, err)
+	assert.Equal(t, "c", v)
+	assert.NoError(t, r.Lset("list", -3, "x"))
+	v, _ = r.Lget("list", 0)
+	assert.Equal(t, "x", v)
+	_, err = r.Lget("list", -4)
+	assert.ErrorIs(t, err, ErrIndexOutOfRange)
+	assert.ErrorIs(t, r.Lset("list", -4, "y"), ErrIndexOutOfRange)
+	deleted, err := r.DeleteSegment("list", -2, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c"}, deleted)
+}
+
+func TestPopAtMost(t *testing.T) {
+	r := newTestStorage(t)
+
+	_, err := r.Rpush("list", "a", "b", "c")
+	assert.NoError(t, err)
+	popped, err := r.PopAtMost("list", ListRight, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c"}, popped)
+	popped, err = r.PopAtMost("list", ListLeft, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, popped)
+	popped, err = r.PopAtMost("list", ListLeft, 5)
+	assert.NoError(t, err)
+	assert.Empty(t, popped)
+
+	_, err = r.PopAtMost("missing", ListLeft, 1)
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+	_, err = r.PopAtMost("list", ListLeft, -1)
+	assert.ErrorIs(t, err, ErrIncorrectArgs)
+	assert.NoError(t, r.Set("string", "value"))
+	_, err = r.PopAtMost("string", ListLeft, 1)
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+}
+
+func TestListWrongType(t *testing.T) {
+	r := newTestStorage(t)
+
+	assert.NoError(t, r.Set("string", "value"))
+	_, err := r.Hset("hash", "f", "v")
+	assert.NoError(t, err)
+	_, err = r.SAdd("set", "a")
+	assert.NoError(t, err)
+	_, err = r.ZAdd("zset", ZAddOptions{}, ZMember{"a", 1})
+	assert.NoError(t, err)
+
+	// every list operation fails on a key of another type
+	for _, key := range []string{"string", "hash", "set", "zset"} {
+		_, err = r.Lpop(key)
+		assert.ErrorIs(t, err, ErrKeyAlreadyExists, key)
+		_, err = r.Rpop(key, 2)
+		assert.ErrorIs(t, err, ErrKeyAlreadyExists, key)
+		_, err = r.Lget(key, 0)
+		assert.ErrorIs(t, err, ErrKeyAlreadyExists, key)
+		_, err = r.DeleteSegment(key, 0, -1)
+		assert.ErrorIs(t, err, ErrKeyAlreadyExists, key)
+		assert.ErrorIs(t, r.Raddtoset(key, "1"), ErrKeyAlreadyExists, key)
+	}
+	_, err = r.Lpop("missing")
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+	_, err = r.Lget("missing", 0)
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+}
+
+func TestLrangeLtrim(t *testing.T) {
+	r := newTestStorage(t)
+
+	_, err := r.Rpush("list", "0", "1", "2", "3", "4")
+	assert.NoError(t, err)
+	for _, tc := range []struct {
+		start, stop int
+		expected    []string
+	}{
+		{0, -1, []string{"0", "1", "2", "3", "4"}},
+		{1, 2, []string{"1", "2"}},
+		{-2, 100, []string{"3", "4"}},
+		{-100, 0, []string{"0"}},
+		{3, 1, []string{}},
+		{5, 10, []string{}},
+	} {
+		elements, err := r.Lrange("list", tc.start, tc.stop)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, elements, "%d %d", tc.start, tc.stop)
+	}
+	n, err := r.Llen("list")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	assert.NoError(t, r.Ltrim("list", 1, -2))
+	elements, _ := r.Lrange("list", 0, -1)
+	assert.Equal(t, []string{"1", "2", "3"}, elements)
+	assert.NoError(t, r.Ltrim("list", 5, 10))
+	n, _ = r.Llen("list")
+	assert.Equal(t, 0, n)
+	assert.Equal(t, exactUsage(r), r.MemoryStats().Used)
+
+	_, err = r.Lrange("missing", 0, -1)
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+	assert.ErrorIs(t, r.Ltrim("missing", 0, -1), ErrKeyDoesntExist)
+	assert.NoError(t, r.Set("string", "value"))
+	_, err = r.Llen("string")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	_, err = r.Lrange("string", 0, -1)
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+}
+
+func TestLinsertLremLpos(t *testing.T) {
+	r := newTestStorage(t)
+
+	_, err := r.Rpush("list", "a", "b", "a", "c", "a")
+	assert.NoError(t, err)
+	n, err := r.Linsert("list", true, "b", "x")
+	assert.NoError(t, err)
+	assert.Equal(t, 6, n)
+	n, err = r.Linsert("list", false, "c", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, n)
+	n, err = r.Linsert("list", false, "missing", "y")
+	assert.NoError(t, err)
+	assert.Equal(t, -1, n)
+	elements, _ := r.Lrange("list", 0, -1)
+	assert.Equal(t, []string{"a", "x", "b", "a", "c", "1", "a"}, elements)
+
+	found, err := r.Lpos("list", "a", LPosOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 3, 6}, found)
+	found, _ = r.Lpos("list", "a", LPosOptions{Rank: 2, Count: 1})
+	assert.Equal(t, []int{3}, found)
+	found, _ = r.Lpos("list", "a", LPosOptions{Rank: -1, Count: 2})
+	assert.Equal(t, []int{6, 3}, found)
+	found, _ = r.Lpos("list", "a", LPosOptions{MaxLen: 4})
+	assert.Equal(t, []int{0, 3}, found)
+	found, _ = r.Lpos("list", "z", LPosOptions{})
+	assert.Empty(t, found)
+	// the ranks beyond the list skip every match
+	found, _ = r.Lpos("list", "a", LPosOptions{Rank: math.MinInt})
+	assert.Empty(t, found)
+	found, _ = r.Lpos("list", "a", LPosOptions{Rank: math.MaxInt})
+	assert.Empty(t, found)
+
+	removed, err := r.Lrem("list", -2, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	elements, _ = r.Lrange("list", 0, -1)
+	assert.Equal(t, []string{"a", "x", "b", "c", "1"}, elements)
+	removed, err = r.Lrem("list", 0, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	removed, err = r.Lrem("list", 1, "z")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	assert.Equal(t, exactUsage(r), r.MemoryStats().Used)
+
+	// the integer lists are searched by the value
+	_, err = r.Rpush("ints", "1", "2", "1")
+	assert.NoError(t, err)
+	removed, _ = r.Lrem("ints", 0, "1")
+	assert.Equal(t, 2, removed)
+	found, _ = r.Lpos("ints", "02", LPosOptions{})
+	assert.Empty(t, found)
+	n, _ = r.Linsert("ints", true, "2", "job")
+	assert.Equal(t, 2, n)
+	elements, _ = r.Lrange("ints", 0, -1)
+	assert.Equal(t, []string{"job", "2"}, elements)
+}
+
+func TestLmove(t *testing.T) {
+	r := newTestStorage(t)
+
+	_, err := r.Rpush("src", "a", "b", "c")
+	assert.NoError(t, err)
+	moved, err := r.Lmove("src", "dst", ListLeft, ListRight)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", moved)
+	moved, err = r.Lmove("src", "dst", ListRight, ListLeft)
+	assert.NoError(t, err)
+	assert.Equal(t, "c", moved)
+	elements, _ := r.Lrange("dst", 0, -1)
+	assert.Equal(t, []string{"c", "a"}, elements)
+	assert.Equal(t, int64(-1), r.TTL("dst"))
+
+	// the same list is rotated
+	moved, err = r.Lmove("dst", "dst", ListLeft, ListRight)
+	assert.NoError(t, err)
+	assert.Equal(t, "c", moved)
+	elements, _ = r.Lrange("dst", 0, -1)
+	assert.Equal(t, []string{"a", "c"}, elements)
+
+	_, err = r.Lmove("src", "dst", ListLeft, ListLeft)
+	assert.NoError(t, err)
+	_, err = r.Lmove("src", "dst", ListLeft, ListLeft)
+	assert.ErrorIs(t, err, ErrIndexOutOfRange)
+	_, err = r.Lmove("missing", "dst", ListLeft, ListLeft)
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+	_, err = r.Lmove("dst", "dst", "up", ListLeft)
+	assert.ErrorIs(t, err, ErrIncorrectArgs)
+	assert.NoError(t, r.Set("string", "value"))
+	_, err = r.Lmove("dst", "string", ListLeft, ListLeft)
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	n, _ := r.Llen("dst")
+	assert.Equal(t, 3, n)
+	assert.Equal(t, exactUsage(r), r.MemoryStats().Used)
+}
@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type EvictionPolicy string
+
+// Eviction policies, the same as in redis.
+const (
+	NoEviction  = EvictionPolicy("noeviction")   // writes fail with ErrOutOfMemory
+	AllKeysLRU  = EvictionPolicy("allkeys-lru")  // evicts the least recently used keys
+	AllKeysLFU  = EvictionPolicy("allkeys-lfu")  // evicts the least frequently used keys
+	VolatileLRU = EvictionPolicy("volatile-lru") // evicts the least recently used keys with expiration
+	VolatileTTL = EvictionPolicy("volatile-ttl") // evicts the keys with the nearest expiration
+)
+
+// Estimated sizes in bytes of the storage structures, the key itself is added to them.
+const (
+	entryOverhead      = 96 // map entries for the value, the expiration and the metadata
+	valSize            = 40
+	arrayOverhead      = 24
+	intSize            = 8
+	stringSize         = 16 // the header of a list element, its bytes are added
+	hashOverhead       = 48
+	hashFieldOverhead  = 48
+	zsetOverhead       = 560 // the map and the skiplist header with all its levels
+	zsetMemberOverhead = 112 // the map entry and the skiplist node
+	setOverhead        = 48
+	setMemberOverhead  = 32
+)
+
+const (
+	// evictionSamples is how many keys are compared to choose one to evict
+	evictionSamples = 16
+	lfuInitFreq     = 5
+	lfuLogFactor    = 10
+)
+
+// MemoryStats describes the memory usage of the storage.
+type MemoryStats struct {
+	Used    int64          `json:"used"` // estimated size of the data in bytes
+	Max     int64          `json:"max"`  // 0 means no limit
+	Policy  EvictionPolicy `json:"policy"`
+	Evicted int64          `json:"evicted"` // keys evicted since the start
+}
+
+// memory accounts the estimated size of the data, it is shared by the shards.
+type memory struct {
+	used     atomic.Int64
+	max      atomic.Int64
+	policy   atomic.Value // EvictionPolicy
+	evicted  atomic.Int64
+	versions atomic.Uint64 // the last version given to a written key
+}
+
+func newMemory() *memory {
+	m := &memory{}
+	m.policy.Store(NoEviction)
+	return m
+}
+
+// entryMeta is kept for every key to account its size and to choose keys to evict.
+// The access fields are changed under the read lock, so they are atomic.
+type entryMeta struct {
+	size       int64
+	version    uint64        // changes on every write of the key, see CompareAndSet
+	lastAccess atomic.Int64  // unix nanoseconds
+	freq       atomic.Uint32 // logarithmic access counter, decays by one every minute
+}
+
+// SetMaxMemory limits the estimated size of the data in bytes, 0 removes the limit.
+// When the limit is reached, writes evict keys according to the policy or fail with ErrOutOfMemory.
+func (r *Storage) SetMaxMemory(bytes int64, policy EvictionPolicy) error {
+	switch policy {
+	case NoEviction, AllKeysLRU, AllKeysLFU, VolatileLRU, VolatileTTL:
+	default:
+		return ErrIncorrectArgs
+	}
+	if bytes < 0 {
+		return ErrIncorrectArgs
+	}
+
+	r.memory.max.Store(bytes)
+	r.memory.policy.Store(policy)
+	r.logger.Info("memory limit set", zap.Int64("bytes", bytes), zap.String("policy", string(policy)))
+	return nil
+}
+
+func (r *Storage) MemoryStats() MemoryStats {
+	return MemoryStats{
+		Used:    r.memory.used.Load(),
+		Max:     r.memory.max.Load(),
+		Policy:  r.memory.policy.Load().(EvictionPolicy),
+		Evicted: r.memory.evicted.Load(),
+	}
+}
+
+// reserve is called by writes before they lock the key. If the memory limit is exceeded,
+// it evicts keys until the data fits, ErrOutOfMemory is returned when nothing can be evicted.
+// Like in redis, the write itself may exceed the limit.
+func (r *Storage) reserve() error {
+	limit := r.memory.max.Load()
+	if limit == 0 {
+		return nil
+	}
+
+	for r.memory.used.Load() > limit {
+		policy := r.memory.policy.Load().(EvictionPolicy)
+		if policy == NoEviction || !r.evict(policy) {
+			r.logger.Error("out of memory", zap.Int64("used", r.memory.used.Load()), zap.Int64("max", limit))
+			return ErrOutOfMemory
+		}
+	}
+	return nil
+}
+
+type evictionCandidate struct {
+	shard *shard
+	key   string
+	meta  *entryMeta
+	score int64 // the key with the biggest score is evicted
+}
+
+// evict samples keys of several shards of any database and deletes the best candidate.
+// It returns false if there are no keys to evict. A transaction holds the locks of its own
+// database only, so it evicts from that database. Otherwise no lock is held by the caller
+// (see reserve) and the shards are locked one at a time, which can't break the lock order.
+func (r *Storage) evict(policy EvictionPolicy) bool {
+	var best *evictionCandidate
+	now := time.Now().UnixNano()
+	sampled := 0
+
+	shards := r.shards
+	if !r.held {
+		shards = r.allShards()
+	}
+	first := rand.Intn(len(shards))
+	for i := 0; i < len(shards) && sampled < evictionSamples; i++ {
+		s := shards[(first+i)%len(shards)]
+		runlock := r.rlockShard(s)
+		for _, c := range s.sample(policy, evictionSamples-sampled, now) {
+			if best == nil || c.score > best.score {
+				best = &c
+			}
+			sampled++
+		}
+		runlock()
+	}
+	if best == nil {
+		return false
+	}
+
+	s := best.shard
+	unlock := r.lockShard(s)
+	// the key could be changed while no lock was held, then another one is chosen by the next call
+	if s.meta[best.key] == best.meta {
+		s.deleteKey(best.key)
+		r.writeRecord(aofRecord{Cmd: "del", Key: best.key, DB: recordDB(s.db)})
+		r.memory.evicted.Add(1)
+		r.logger.Info("key evicted", zap.String("key", best.key), zap.String("policy", string(policy)))
+	}
+	unlock()
+	return true
+}
+
+// sample returns up to count eviction candidates of the shard.
+func (s *shard) sample(policy EvictionPolicy, count int, now int64) []evictionCandidate {
+	candidates := make([]evictionCandidate, 0, count)
+	add := func(key string, score int64) {
+		candidates = append(candidates, evictionCandidate{shard: s, key: key, meta: s.meta[key], score: score})
+	}
+
+	switch policy {
+	case AllKeysLRU, AllKeysLFU:
+		// map iteration starts at a random entry
+		for key, m := range s.meta {
+			if len(candidates) == count {
+				break
+			}
+			if policy == AllKeysLRU {
+				add(key, now-m.lastAccess.Load())
+			} else {
+				add(key, -int64(m.decayedFreq(now)))
+			}
+		}
+	case VolatileLRU:
+		items := s.expiry.items
+		for i := 0; i < count && i < len(items); i++ {
+			key := items[rand.Intn(len(items))].key
+			if m, ok := s.meta[key]; ok {
+				add(key, now-m.lastAccess.Load())
+			}
+		}
+	case VolatileTTL:
+		// the nearest expiration of the shard is on top of the index
+		if len(s.expiry.items) > 0 {
+			item := s.expiry.items[0]
+			add(item.key, -item.at)
+		}
+	}
+	return candidates
+}
+
+// valueSize estimates the size of the key with its value, 0 means there is no value.
+// It is O(1) for scalars and lists and O(n) for hashes and sets.
+func (s *shard) valueSize(key string) int64 {
+	base := int64(entryOverhead + len(key))
+	if v, ok := s.inner[key]; ok {
+		return base + valSize + int64(len(v.stringValue))
+	}
+	if l, ok := s.arrays[key]; ok {
+		return base + l.size()
+	}
+	if hash, ok := s.hashes[key]; ok {
+		size := base + hashOverhead
+		for field, value := range hash {
+			size += hashFieldSize(field, value)
+		}
+		return size
+	}
+	if z, ok := s.zsets[key]; ok {
+		size := base + zsetOverhead
+		for member := range z.scores {
+			size += zsetMemberSize(member)
+		}
+		return size
+	}
+	if st, ok := s.sets[key]; ok {
+		size := base + setOverhead
+		for member := range st {
+			size += setMemberSize(member)
+		}
+		return size
+	}
+	return 0
+}
+
+func hashFieldSize(field, value string) int64 {
+	return int64(hashFieldOverhead + len(field) + len(value))
+}
+
+// resize recalculates the size of the key after a change and marks it as accessed.
+// Hashes and sets are resized by their writers with setSize, valueSize is too slow for them.
+func (s *shard) resize(key string) {
+	s.setSize(key, s.valueSize(key))
+	s.touch(key)
+}
+
+// setSize sets the size of the key and accounts the difference, 0 forgets the key.
+// Every write of the key ends here, so it also gives the key a new version.
+func (s *shard) setSize(key string, size int64) {
+	m, ok := s.meta[key]
+	if size == 0 {
+		if ok {
+			s.memory.used.Add(-m.size)
+			delete(s.meta, key)
+			s.keysVersion++
+		}
+		return
+	}
+
+	if !ok {
+		m = &entryMeta{}
+		m.freq.Store(lfuInitFreq)
+		s.meta[key] = m
+		s.keysVersion++
+	}
+	s.memory.used.Add(size - m.size)
+	m.size = size
+	m.version = s.memory.versions.Add(1)
+}
+
+func (s *shard) sizeOf(key string) int64 {
+	if m, ok := s.meta[key]; ok {
+		return m.size
+	}
+	return 0
+}
+
+// touch marks the key as accessed, it only needs the read lock.
+func (s *shard) touch(key string) {
+	if m, ok := s.meta[key]; ok {
+		m.touch(time.Now().UnixNano())
+	}
+}
+
+func (m *entryMeta) touch(now int64) {
+	freq := m.decayedFreq(now)
+	// the more accesses the key had, the less likely the counter grows
+	if freq < 255 && rand.Float64() < 1/(float64(max(0, int(freq)-lfuInitFreq))*lfuLogFactor+1) {
+		freq++
+	}
+	m.freq.Store(freq)
+	m.lastAccess.Store(now)
+}
+
+// decayedFreq returns the access counter decreased by the minutes passed since the last access.
+func (m *entryMeta) decayedFreq(now int64) uint32 {
+	freq := m.freq.Load()
+	last := m.lastAccess.Load()
+	if last == 0 {
+		return freq
+	}
+
+	idle := uint32(time.Duration(now - last).Minutes())
+	if idle >= freq {
+		return 0
+	}
+	return freq - idle
+}
@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// exactUsage recalculates the size of all the data from scratch.
+func exactUsage(r *Storage) int64 {
+	total := int64(0)
+	for _, s := range r.shards {
+		for key := range s.inner {
+			total += s.valueSize(key)
+		}
+		for key := range s.arrays {
+			total += s.valueSize(key)
+		}
+		for key := range s.hashes {
+			total += s.valueSize(key)
+		}
+		for key := range s.zsets {
+			total += s.valueSize(key)
+		}
+		for key := range s.sets {
+			total += s.valueSize(key)
+		}
+	}
+	return total
+}
+
+func TestMemoryAccounting(t *testing.T) {
+	r := newTestStorage(t)
+
+	assert.NoError(t, r.Set("string", "value"))
+	assert.NoError(t, r.Set("string", "a longer value"))
+	assert.NoError(t, r.Set("int", "42"))
+	assert.NoError(t, r.SetPX("volatile", "value", 1))
+	_, err := r.Rpush("list", "1", "2", "3")
+	assert.NoError(t, err)
+	_, err = r.Lpush("list", "0")
+	assert.NoError(t, err)
+	_, err = r.Lpop("list", 2)
+	assert.NoError(t, err)
+	_, err = r.Hset("hash", "a", "1", "b", "2", "c", "3")
+	assert.NoError(t, err)
+	_, err = r.Hset("hash", "a", "one")
+	assert.NoError(t, err)
+	_, err = r.Hdel("hash", "b")
+	assert.NoError(t, err)
+	_, err = r.ZAdd("zset", ZAddOptions{}, ZMember{"a", 1}, ZMember{"b", 2}, ZMember{"c", 3})
+	assert.NoError(t, err)
+	_, err = r.ZIncrBy("zset", 1, "d")
+	assert.NoError(t, err)
+	_, err = r.ZRem("zset", "a", "missing")
+	assert.NoError(t, err)
+	_, err = r.SAdd("set", "a", "b", "c")
+	assert.NoError(t, err)
+	_, err = r.SRem("set", "b")
+	assert.NoError(t, err)
+	_, err = r.SUnionStore("union", "set", "missing")
+	assert.NoError(t, err)
+	assert.Equal(t, exactUsage(r), r.MemoryStats().Used)
+
+	time.Sleep(5 * time.Millisecond)
+	r.GarbageCollect()
+	assert.Equal(t, exactUsage(r), r.MemoryStats().Used)
+
+	data, err := json.Marshal(r)
+	assert.NoError(t, err)
+	used := r.MemoryStats().Used
+	assert.NoError(t, json.Unmarshal(data, r))
+	assert.Equal(t, used, r.MemoryStats().Used)
+
+	_, err = r.Hdel("hash", "a", "c")
+	assert.NoError(t, err)
+	_, err = r.ZRem("zset", "b", "c", "d")
+	assert.NoError(t, err)
+	_, err = r.SPop("set", 2)
+	assert.NoError(t, err)
+	_, err = r.SInterStore("union", "set")
+	assert.NoError(t, err)
+	assert.True(t, pexpire(t, r, "string", 1))
+	assert.True(t, pexpire(t, r, "int", 1))
+	assert.True(t, pexpire(t, r, "list", 1))
+	time.Sleep(5 * time.Millisecond)
+	r.GarbageCollect()
+	assert.Equal(t, int64(0), r.MemoryStats().Used)
+}
+
+func TestNoEviction(t *testing.T) {
+	r := newTestStorage(t)
+
+	assert.ErrorIs(t, r.SetMaxMemory(1000, "unknown"), ErrIncorrectArgs)
+	assert.ErrorIs(t, r.SetMaxMemory(-1, NoEviction), ErrIncorrectArgs)
+	assert.NoError(t, r.SetMaxMemory(1000, NoEviction))
+
+	i := 0
+	for ; r.MemoryStats().Used <= 1000; i++ {
+		assert.NoError(t, r.Set("key"+strconv.Itoa(i), "value"))
+	}
+	assert.ErrorIs(t, r.Set("key", "value"), ErrOutOfMemory)
+	_, err := r.Rpush("list", "1")
+	assert.ErrorIs(t, err, ErrOutOfMemory)
+	_, err = r.Lpush("list", "1")
+	assert.ErrorIs(t, err, ErrOutOfMemory)
+	_, err = r.Hset("hash", "field", "value")
+	assert.ErrorIs(t, err, ErrOutOfMemory)
+
+	// reads and deletions still work
+	v, err := r.Get("key0")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", v)
+	assert.True(t, pexpire(t, r, "key0", 1))
+	time.Sleep(5 * time.Millisecond)
+	r.GarbageCollect()
+
+	assert.NoError(t, r.Set("key", "value"))
+	assert.Equal(t, int64(0), r.MemoryStats().Evicted)
+}
+
+func TestEviction(t *testing.T) {
+	const (
+		keys  = 200
+		hot   = 10
+		limit = 100 * (entryOverhead + valSize + 10)
+	)
+	cold := func(i int) string { return "cold" + strconv.Itoa(i) }
+	hotKey := func(i int) string { return "hot" + strconv.Itoa(i) }
+
+	cases := []struct {
+		policy EvictionPolicy
+		fill   func(r *Storage)
+	}{
+		{
+			policy: AllKeysLRU,
+			fill: func(r *Storage) {
+				for i := 0; i < keys; i++ {
+					assert.NoError(t, r.Set(cold(i), "value"))
+				}
+				for i := 0; i < hot; i++ {
+					assert.NoError(t, r.Set(hotKey(i), "value"))
+				}
+			},
+		},
+		{
+			policy: AllKeysLFU,
+			fill: func(r *Storage) {
+				for i := 0; i < hot; i++ {
+					assert.NoError(t, r.Set(hotKey(i), "value"))
+					for j := 0; j < 1000; j++ {
+						r.Get(hotKey(i))
+					}
+				}
+				for i := 0; i < keys; i++ {
+					assert.NoError(t, r.Set(cold(i), "value"))
+				}
+			},
+		},
+		{
+			policy: VolatileLRU,
+			fill: func(r *Storage) {
+				for i := 0; i < hot; i++ {
+					assert.NoError(t, r.Set(hotKey(i), "value"))
+				}
+				for i := 0; i < keys; i++ {
+					assert.NoError(t, r.Set(cold(i), "value", 100))
+				}
+			},
+		},
+		{
+			policy: VolatileTTL,
+			fill: func(r *Storage) {
+				for i := 0; i < hot; i++ {
+					assert.NoError(t, r.Set(hotKey(i), "value", 1000))
+				}
+				for i := 0; i < keys; i++ {
+					assert.NoError(t, r.Set(cold(i), "value", 100))
+				}
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.policy), func(t *testing.T) {
+			r := newTestStorage(t)
+
+			c.fill(r)
+			assert.NoError(t, r.SetMaxMemory(limit, c.policy))
+			assert.NoError(t, r.Set("new", "value"))
+
+			stats := r.MemoryStats()
+			assert.LessOrEqual(t, stats.Used, int64(limit)+r.shards[shardIndex("new")].sizeOf("new"))
+			assert.Greater(t, stats.Evicted, int64(0))
+			assert.Equal(t, exactUsage(r), stats.Used)
+			for i := 0; i < hot; i++ {
+				_, err := r.Get(hotKey(i))
+				assert.NoError(t, err, "%s should not be evicted", hotKey(i))
+			}
+		})
+	}
+}
+
+func TestVolatileEvictionWithoutVolatileKeys(t *testing.T) {
+	r := newTestStorage(t)
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, r.Set("key"+strconv.Itoa(i), "value"))
+	}
+	assert.NoError(t, r.SetMaxMemory(100, VolatileLRU))
+	assert.ErrorIs(t, r.Set("key", "value"), ErrOutOfMemory)
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Persister keeps snapshots of the storage.
+type Persister interface {
+	// Save stores a new version of the snapshot.
+	Save(snapshot []byte) error
+	// LoadLatest returns the latest snapshot or nil if there are no snapshots.
+	LoadLatest() ([]byte, error)
+	// Versions returns the kept versions from the latest to the oldest.
+	Versions() ([]Version, error)
+}
+
+type Version struct {
+	Version   int64 `json:"version"`
+	Timestamp int64 `json:"timestamp"` // unix seconds
+}
+
+// keptVersions is how many latest snapshots the persisters keep.
+const keptVersions = 5
+
+// FilePersister keeps the only snapshot in a json file.
+type FilePersister struct {
+	filename string
+}
+
+func NewFilePersister(filename string) *FilePersister {
+	return &FilePersister{filename: filename}
+}
+
+// Save writes the snapshot to a temporary file and renames it,
+// so the file always contains a whole snapshot.
+func (p *FilePersister) Save(snapshot []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(p.filename), filepath.Base(p.filename)+".temp-*")
+	if err != nil {
+		return fmt.Errorf("error writing to file: %v", err)
+	}
+
+	_, err = temp.Write(snapshot)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), p.filename)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return fmt.Errorf("error writing to file: %v", err)
+	}
+	return nil
+}
+
+func (p *FilePersister) LoadLatest() ([]byte, error) {
+	snapshot, err := os.ReadFile(p.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	return snapshot, nil
+}
+
+// Versions returns the only version, its number is the modification time of the file in nanoseconds.
+func (p *FilePersister) Versions() ([]Version, error) {
+	info, err := os.Stat(p.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Version{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	return []Version{{
+		Version:   info.ModTime().UnixNano(),
+		Timestamp: info.ModTime().Unix(),
+	}}, nil
+}
+
+// MemoryPersister keeps snapshots in memory, it is meant for tests.
+type MemoryPersister struct {
+	mu        sync.Mutex
+	snapshots [][]byte
+	versions  []Version // in the order of saving
+	last      int64
+}
+
+func NewMemoryPersister() *MemoryPersister {
+	return &MemoryPersister{}
+}
+
+func (p *MemoryPersister) Save(snapshot []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.last++
+	p.snapshots = append(p.snapshots, append([]byte(nil), snapshot...))
+	p.versions = append(p.versions, Version{Version: p.last, Timestamp: time.Now().Unix()})
+	if len(p.snapshots) > keptVersions {
+		p.snapshots = p.snapshots[1:]
+		p.versions = p.versions[1:]
+	}
+	return nil
+}
+
+func (p *MemoryPersister) LoadLatest() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.snapshots) == 0 {
+		return nil, nil
+	}
+	return append([]byte(nil), p.snapshots[len(p.snapshots)-1]...), nil
+}
+
+func (p *MemoryPersister) Versions() ([]Version, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	versions := make([]Version, len(p.versions))
+	for i, v := range p.versions {
+		versions[len(versions)-1-i] = v
+	}
+	return versions, nil
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersisters(t *testing.T) {
+	cases := []struct {
+		name      string
+		persister Persister
+		kept      int
+	}{
+		{"file", NewFilePersister(filepath.Join(t.TempDir(), "storage.json")), 1},
+		{"memory", NewMemoryPersister(), keptVersions},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			snapshot, err := c.persister.LoadLatest()
+			assert.NoError(t, err)
+			assert.Nil(t, snapshot)
+			versions, err := c.persister.Versions()
+			assert.NoError(t, err)
+			assert.Empty(t, versions)
+
+			for i := 0; i < keptVersions+2; i++ {
+				assert.NoError(t, c.persister.Save([]byte(`{"version":`+strconv.Itoa(i)+`}`)))
+			}
+
+			snapshot, err = c.persister.LoadLatest()
+			assert.NoError(t, err)
+			assert.Equal(t, `{"version":6}`, string(snapshot))
+
+			versions, err = c.persister.Versions()
+			assert.NoError(t, err)
+			assert.Len(t, versions, c.kept)
+			for i := 1; i < len(versions); i++ {
+				assert.Greater(t, versions[i-1].Version, versions[i].Version)
+			}
+		})
+	}
+}
+
+func TestStorageSaveLoad(t *testing.T) {
+	persister := NewMemoryPersister()
+	r, err := NewStorageWithPersister(time.Minute*20, time.Minute*60, persister)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, r.Set("key", "value"))
+	assert.NoError(t, r.SetTyped("float", "1.5", KindFloat, 0))
+	assert.NoError(t, r.SetTyped("binary", "\x00\xff\xfe", KindBinary, 0))
+	assert.NoError(t, r.SetTyped("utf8", "a\x00b", KindBinary, 0))
+	_, err = r.Rpush("list", "1", "2")
+	assert.NoError(t, err)
+	_, err = r.Hset("hash", "field", "value")
+	assert.NoError(t, err)
+	assert.NoError(t, r.Save())
+
+	versions, err := r.Versions()
+	assert.NoError(t, err)
+	assert.Len(t, versions, 1)
+
+	r2, err := NewStorageWithPersister(time.Minute*20, time.Minute*60, persister)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, r2.Load())
+	assertSameData(t, r, r2)
+	value, k, err := r2.GetTyped("binary")
+	assert.NoError(t, err)
+	assert.Equal(t, "\x00\xff\xfe", value)
+	assert.Equal(t, KindBinary, k)
+	// binary values are written in base64 even if they are valid UTF-8, Postgres JSONB rejects \u0000
+	snapshot, err := json.Marshal(r2)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(snapshot), `\u0000`)
+	value, k, err = r2.GetTyped("utf8")
+	assert.NoError(t, err)
+	assert.Equal(t, "a\x00b", value)
+	assert.Equal(t, KindBinary, k)
+	value, k, err = r2.GetTyped("float")
+	assert.NoError(t, err)
+	assert.Equal(t, "1.5", value)
+	assert.Equal(t, KindFloat, k)
+
+	// nothing to load
+	r3 := newTestStorage(t)
+	assert.NoError(t, r3.Load())
+	assert.Empty(t, r3.Keys("*"))
+}
+
+func TestStorageSavingLoop(t *testing.T) {
+	persister := NewMemoryPersister()
+	r, err := NewStorageWithPersister(time.Millisecond, time.Minute*60, persister)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, r.Set("key", "value"))
+
+	time.Sleep(50 * time.Millisecond)
+	r.Stop()
+
+	versions, err := persister.Versions()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, versions)
+
+	r2, err := NewStorageWithPersister(time.Minute*20, time.Minute*60, persister)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, r2.Load())
+	v, err := r2.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", v)
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	CreateTable = `CREATE TABLE IF NOT EXISTS core (
+		version bigserial PRIMARY KEY,
+		timestamp bigint NOT NULL,
+		payload JSONB NOT NULL
+	)`
+)
+
+// PostgresPersister keeps the latest snapshots in the core table.
+// The driver named "postgres" has to be registered by the caller.
+type PostgresPersister struct {
+	db *sql.DB
+}
+
+// NewPostgresPersister connects to the database and creates the table if needed.
+func NewPostgresPersister(dsn string) (*PostgresPersister, error) {
+	fmt.Println("Attempting to connect to PostgreSQL")
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("connection: %v", err)
+	}
+
+	fmt.Println("Connected to PostgreSQL, pinging...")
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping: %v", err)
+	}
+	fmt.Println("Connected to PostgreSQL")
+
+	// Создание таблицы при необходимости
+	if _, err := db.Exec(CreateTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating table: %v", err)
+	}
+
+	return &PostgresPersister{db: db}, nil
+}
+
+func (p *PostgresPersister) Save(snapshot []byte) error {
+	timestamp := time.Now().Unix()
+
+	_, err := p.db.Exec(`INSERT INTO core (timestamp, payload) VALUES ($1, $2)`, timestamp, snapshot)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.Exec(`DELETE FROM core WHERE version NOT IN (SELECT version FROM core ORDER BY version DESC LIMIT $1)`,
+		keptVersions)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PostgresPersister) LoadLatest() ([]byte, error) {
+	row := p.db.QueryRow(`SELECT payload FROM core ORDER BY version DESC LIMIT 1`)
+
+	var payload []byte
+	err := row.Scan(&payload)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении последней версии состояния из базы данных: %v", err)
+	}
+	return payload, nil
+}
+
+func (p *PostgresPersister) Versions() ([]Version, error) {
+	rows, err := p.db.Query(`SELECT version, timestamp FROM core ORDER BY version DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]Version, 0, keptVersions)
+	for rows.Next() {
+		var v Version
+		if err := rows.Scan(&v.Version, &v.Timestamp); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
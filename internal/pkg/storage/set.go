@@ -0,0 +1,380 @@
+package storage
+
+import (
+	"errors"
+	"math/rand"
+	"slices"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// set is an unordered set of strings, integers are kept in their decimal form.
+type set map[string]struct{}
+
+func (st set) members() []string {
+	members := make([]string, 0, len(st))
+	for member := range st {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// setOf returns the set stored at key. Returns ErrKeyAlreadyExists
+// if the key holds a value of another type and ErrKeyDoesntExist if there is no key.
+func (s *shard) setOf(key string) (set, error) {
+	if err := s.checkType(key, TypeSet); err != nil {
+		return nil, err
+	}
+	st, ok := s.sets[key]
+	if !ok || s.expired(key) {
+		return nil, ErrKeyDoesntExist
+	}
+	return st, nil
+}
+
+func setMemberSize(member string) int64 {
+	return int64(setMemberOverhead + len(member))
+}
+
+// SAdd adds the members to the set stored at key and returns the number of added ones.
+// A missing key is created.
+func (r *Storage) SAdd(key string, members ...string) (int, error) {
+	if len(members) == 0 {
+		return 0, ErrIncorrectArgs
+	}
+	if err := r.reserve(); err != nil {
+		return 0, err
+	}
+
+	s, unlock := r.lock(key)
+	defer unlock()
+
+	s.dropExpired(key)
+	if err := s.checkType(key, TypeSet); err != nil {
+		return 0, err
+	}
+	if _, exists := s.sets[key]; !exists {
+		s.sets[key] = make(set)
+		s.setExpiration(key, 0)
+		s.setSize(key, int64(entryOverhead+len(key)+setOverhead))
+	}
+
+	st := s.sets[key]
+	added := 0
+	size := s.sizeOf(key)
+	for _, member := range members {
+		if _, exists := st[member]; !exists {
+			st[member] = struct{}{}
+			added++
+			size += setMemberSize(member)
+		}
+	}
+	s.setSize(key, size)
+	s.touch(key)
+	r.propagate(aofRecord{Cmd: "sadd", Key: key, Args: members})
+
+	r.logger.Info("set members added", zap.String("key", key),
+		zap.Int("count of members", len(members)), zap.Int("added", added))
+	return added, nil
+}
+
+// SRem removes the members from the set and returns the number of removed ones.
+// The key is deleted when the set becomes empty.
+func (r *Storage) SRem(key string, members ...string) (int, error) {
+	s, unlock := r.lock(key)
+	defer unlock()
+
+	s.dropExpired(key)
+	if _, err := s.setOf(key); err != nil {
+		return 0, err
+	}
+
+	removed := s.removeMembers(key, members)
+	if removed > 0 {
+		r.propagate(aofRecord{Cmd: "srem", Key: key, Args: members})
+	}
+
+	r.logger.Info("set members removed", zap.String("key", key), zap.Int("removed", removed))
+	return removed, nil
+}
+
+// removeMembers removes the members from the set, which must exist, and deletes it if it becomes empty.
+func (s *shard) removeMembers(key string, members []string) int {
+	st := s.sets[key]
+	removed := 0
+	size := s.sizeOf(key)
+	for _, member := range members {
+		if _, exists := st[member]; exists {
+			delete(st, member)
+			removed++
+			size -= setMemberSize(member)
+		}
+	}
+
+	if len(st) == 0 {
+		delete(s.sets, key)
+		s.forgetExpiration(key)
+		size = 0
+	}
+	s.setSize(key, size)
+	s.touch(key)
+	return removed
+}
+
+// SIsMember reports whether the member is in the set.
+func (r *Storage) SIsMember(key string, member string) (bool, error) {
+	found := false
+	err := r.read(key, func(s *shard) error {
+		st, err := s.setOf(key)
+		if err != nil {
+			return err
+		}
+		_, found = st[member]
+		return nil
+	})
+	return found, err
+}
+
+// SMembers returns the members of the set sorted.
+func (r *Storage) SMembers(key string) ([]string, error) {
+	var members []string
+	err := r.read(key, func(s *shard) error {
+		st, err := s.setOf(key)
+		if err != nil {
+			return err
+		}
+		members = st.members()
+		return nil
+	})
+	return members, err
+}
+
+// SCard returns the number of members of the set.
+func (r *Storage) SCard(key string) (int, error) {
+	length := 0
+	err := r.read(key, func(s *shard) error {
+		st, err := s.setOf(key)
+		if err != nil {
+			return err
+		}
+		length = len(st)
+		return nil
+	})
+	return length, err
+}
+
+// SPop removes up to count random members from the set and returns them.
+// The key is deleted when the set becomes empty.
+func (r *Storage) SPop(key string, count int) ([]string, error) {
+	if count < 0 {
+		return nil, ErrIncorrectArgs
+	}
+
+	s, unlock := r.lock(key)
+	defer unlock()
+
+	s.dropExpired(key)
+	st, err := s.setOf(key)
+	if err != nil {
+		return nil, err
+	}
+
+	popped := randomMembers(st, min(count, len(st)), false)
+	if len(popped) > 0 {
+		s.removeMembers(key, popped)
+		// the members are random, so the record names them
+		r.propagate(aofRecord{Cmd: "srem", Key: key, Args: popped})
+	}
+
+	r.logger.Info("set members popped", zap.String("key", key), zap.Int("count", len(popped)))
+	return popped, nil
+}
+
+// SRandMember returns up to count random members of the set without repetitions
+// or, if count is negative, exactly -count members which can repeat, like in redis.
+func (r *Storage) SRandMember(key string, count int) ([]string, error) {
+	var members []string
+	err := r.read(key, func(s *shard) error {
+		st, err := s.setOf(key)
+		if err != nil {
+			return err
+		}
+		if count < 0 {
+			members = randomMembers(st, -count, true)
+		} else {
+			members = randomMembers(st, min(count, len(st)), false)
+		}
+		return nil
+	})
+	return members, err
+}
+
+func randomMembers(st set, count int, repeat bool) []string {
+	all := make([]string, 0, len(st))
+	for member := range st {
+		all = append(all, member)
+	}
+
+	members := make([]string, 0, count)
+	if repeat {
+		for len(members) < count {
+			members = append(members, all[rand.Intn(len(all))])
+		}
+		return members
+	}
+	rand.Shuffle(len(all), func(i, j int) {
+		all[i], all[j] = all[j], all[i]
+	})
+	return append(members, all[:count]...)
+}
+
+// setOperation combines the sets, missing keys are empty sets.
+type setOperation string
+
+const (
+	setInter = setOperation("inter")
+	setUnion = setOperation("union")
+	setDiff  = setOperation("diff")
+)
+
+// SInter returns the members of every set sorted.
+func (r *Storage) SInter(keys ...string) ([]string, error) {
+	return r.combine(setInter, keys)
+}
+
+// SUnion returns the members of any set sorted.
+func (r *Storage) SUnion(keys ...string) ([]string, error) {
+	return r.combine(setUnion, keys)
+}
+
+// SDiff returns the members of the first set which are not in the others sorted.
+func (r *Storage) SDiff(keys ...string) ([]string, error) {
+	return r.combine(setDiff, keys)
+}
+
+// SInterStore works like SInter, but stores the result at dst and returns its size.
+// The old value of dst of any type is replaced, an empty result deletes it.
+func (r *Storage) SInterStore(dst string, keys ...string) (int, error) {
+	return r.combineStore(setInter, dst, keys)
+}
+
+// SUnionStore works like SUnion, but stores the result like SInterStore.
+func (r *Storage) SUnionStore(dst string, keys ...string) (int, error) {
+	return r.combineStore(setUnion, dst, keys)
+}
+
+// SDiffStore works like SDiff, but stores the result like SInterStore.
+func (r *Storage) SDiffStore(dst string, keys ...string) (int, error) {
+	return r.combineStore(setDiff, dst, keys)
+}
+
+func (r *Storage) combine(op setOperation, keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, ErrIncorrectArgs
+	}
+
+	unlock := r.lockKeys(keys...)
+	defer unlock()
+
+	result, err := r.combineLocked(op, keys)
+	if err != nil {
+		return nil, err
+	}
+	return result.members(), nil
+}
+
+func (r *Storage) combineStore(op setOperation, dst string, keys []string) (int, error) {
+	if len(keys) == 0 {
+		return 0, ErrIncorrectArgs
+	}
+	if err := r.reserve(); err != nil {
+		return 0, err
+	}
+
+	unlock := r.lockKeys(append(slices.Clone(keys), dst)...)
+	defer unlock()
+
+	result, err := r.combineLocked(op, keys)
+	if err != nil {
+		return 0, err
+	}
+
+	to := r.shardOf(dst)
+	to.dropExpired(dst)
+	if to.keyType(dst) != TypeNone {
+		to.deleteKey(dst)
+	}
+	if len(result) > 0 {
+		size := int64(entryOverhead + len(dst) + setOverhead)
+		for member := range result {
+			size += setMemberSize(member)
+		}
+		to.sets[dst] = result
+		to.setExpiration(dst, 0)
+		to.setSize(dst, size)
+		to.touch(dst)
+	}
+	// the record repeats the operation, the sets are the same at that moment
+	r.propagate(aofRecord{Cmd: "s" + string(op) + "store", Key: dst, Args: keys})
+
+	r.logger.Info("sets combined", zap.String("operation", string(op)), zap.String("key", dst),
+		zap.Int("count of keys", len(keys)), zap.Int("size", len(result)))
+	return len(result), nil
+}
+
+// combineLocked returns a new set combined from the sets at keys, their shards must be locked.
+// Returns ErrKeyAlreadyExists if any key holds a value of another type.
+func (r *Storage) combineLocked(op setOperation, keys []string) (set, error) {
+	sets := make([]set, len(keys))
+	for i, key := range keys {
+		s := r.shardOf(key)
+		st, err := s.setOf(key)
+		if err != nil && !errors.Is(err, ErrKeyDoesntExist) {
+			return nil, err
+		}
+		if st != nil {
+			s.touch(key)
+		}
+		sets[i] = st
+	}
+
+	result := make(set)
+	switch op {
+	case setInter:
+		// the smallest set is walked, a missing one makes the result empty
+		smallest := sets[0]
+		for _, st := range sets {
+			if len(st) < len(smallest) {
+				smallest = st
+			}
+		}
+	members:
+		for member := range smallest {
+			for _, st := range sets {
+				if _, ok := st[member]; !ok {
+					continue members
+				}
+			}
+			result[member] = struct{}{}
+		}
+	case setUnion:
+		for _, st := range sets {
+			for member := range st {
+				result[member] = struct{}{}
+			}
+		}
+	case setDiff:
+	first:
+		for member := range sets[0] {
+			for _, st := range sets[1:] {
+				if _, ok := st[member]; ok {
+					continue first
+				}
+			}
+			result[member] = struct{}{}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSet(t *testing.T) {
+	r := newTestStorage(t)
+
+	added, err := r.SAdd("set", "a", "b", "1", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, added)
+	added, err = r.SAdd("set", "b", "c")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, added)
+	_, err = r.SAdd("set")
+	assert.ErrorIs(t, err, ErrIncorrectArgs)
+
+	members, err := r.SMembers("set")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "a", "b", "c"}, members)
+	n, err := r.SCard("set")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	found, err := r.SIsMember("set", "1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	found, err = r.SIsMember("set", "z")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	_, err = r.SIsMember("missing", "z")
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+
+	random, err := r.SRandMember("set", 10)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, members, random)
+	random, err = r.SRandMember("set", -10)
+	assert.NoError(t, err)
+	assert.Len(t, random, 10)
+	assert.Subset(t, members, random)
+
+	popped, err := r.SPop("set", 2)
+	assert.NoError(t, err)
+	assert.Len(t, popped, 2)
+	assert.Subset(t, members, popped)
+	n, _ = r.SCard("set")
+	assert.Equal(t, 2, n)
+
+	left, _ := r.SMembers("set")
+	removed, err := r.SRem("set", left[0], "missing")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	// the key is deleted with the last member
+	popped, err = r.SPop("set", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, left[1:], popped)
+	assert.Equal(t, TypeNone, r.Type("set"))
+	_, err = r.SPop("set", 1)
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+	assert.Equal(t, int64(0), r.MemoryStats().Used)
+}
+
+func TestSetOperations(t *testing.T) {
+	r := newTestStorage(t)
+
+	_, err := r.SAdd("a", "1", "2", "3", "4")
+	assert.NoError(t, err)
+	_, err = r.SAdd("b", "3", "4", "5")
+	assert.NoError(t, err)
+	_, err = r.SAdd("c", "4", "6")
+	assert.NoError(t, err)
+
+	members, err := r.SInter("a", "b", "c")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"4"}, members)
+	members, err = r.SInter("a", "missing")
+	assert.NoError(t, err)
+	assert.Empty(t, members)
+	members, err = r.SUnion("a", "b", "missing")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, members)
+	members, err = r.SDiff("a", "b", "c")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, members)
+	members, err = r.SDiff("missing", "a")
+	assert.NoError(t, err)
+	assert.Empty(t, members)
+
+	// the destination of any type is replaced
+	assert.NoError(t, r.Set("dst", "value", 100))
+	n, err := r.SUnionStore("dst", "b", "c")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, int64(-1), r.TTL("dst"))
+	members, _ = r.SMembers("dst")
+	assert.Equal(t, []string{"3", "4", "5", "6"}, members)
+
+	// the destination can be one of the sets
+	n, err = r.SDiffStore("a", "a", "dst")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	members, _ = r.SMembers("a")
+	assert.Equal(t, []string{"1", "2"}, members)
+
+	// an empty result deletes the destination
+	n, err = r.SInterStore("dst", "a", "c")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, TypeNone, r.Type("dst"))
+
+	assert.NoError(t, r.Set("string", "value"))
+	_, err = r.SUnion("a", "string")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	_, err = r.SInterStore("dst", "string")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	_, err = r.SInter()
+	assert.ErrorIs(t, err, ErrIncorrectArgs)
+}
+
+func TestSetTypeConflicts(t *testing.T) {
+	r := newTestStorage(t)
+
+	_, err := r.Rpush("list", "1")
+	assert.NoError(t, err)
+	_, err = r.SAdd("list", "a")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	_, err = r.SMembers("list")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+
+	_, err = r.SAdd("set", "a")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, r.Set("set", "value"), ErrKeyAlreadyExists)
+	_, err = r.Hset("set", "f", "v")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	_, err = r.ZAdd("set", ZAddOptions{}, ZMember{"a", 1})
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	assert.ErrorIs(t, r.Raddtoset("set", "1"), ErrKeyAlreadyExists)
+}
+
+func TestSetMarshal(t *testing.T) {
+	r := newTestStorage(t)
+
+	_, err := r.SAdd("set", "a", "1", "b")
+	assert.NoError(t, err)
+	assert.True(t, expire(t, r, "set", 100))
+	_, err = r.Copy("set", "copied", false)
+	assert.NoError(t, err)
+	_, err = r.SRem("copied", "a")
+	assert.NoError(t, err)
+
+	data, err := json.Marshal(r)
+	assert.NoError(t, err)
+
+	r2 := newTestStorage(t)
+	assert.NoError(t, json.Unmarshal(data, r2))
+	assertSameData(t, r, r2)
+	members, err := r2.SMembers("set")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "a", "b"}, members)
+	assert.Equal(t, int64(100), r2.TTL("set"))
+	assert.Equal(t, r.MemoryStats().Used, r2.MemoryStats().Used)
+}
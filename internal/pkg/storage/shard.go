@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	shardBits  = 6
+	shardCount = 1 << shardBits
+	// the top bits of the key hash select the shard, so the hash order of keys
+	// is also the order of shards, SCAN relies on it
+	shardShift = 64 - shardBits
+)
+
+// shard is a part of the keyspace with its own lock.
+//
+// Locking model: exported Storage methods lock the shards they touch for their
+// whole duration, shard methods expect the lock to be held by the caller and never take it.
+// Writers take the write lock and drop the expired key before working with it,
+// readers take the read lock and treat expired keys as missing, then delete them
+// under the write lock (see Storage.read). When several shards are locked,
+// they are locked in the order of their indexes. A transaction locks every shard
+// and runs on a storage marked as held, whose lock helpers do nothing (see Storage.Atomically).
+// Values never leave the storage by pointer, callers get copies.
+type shard struct {
+	mu             sync.RWMutex
+	inner          map[string]*val
+	arrays         map[string]*list
+	hashes         map[string]map[string]string
+	zsets          map[string]*zset
+	sets           map[string]set
+	expirationTime map[string]int64
+	expiry         *expiryIndex // keys with expiration ordered by it
+	meta           map[string]*entryMeta
+	deleted        uint64 // version of the last deletion in the shard, missing keys have it
+	db             string // name of the database the shard belongs to
+	memory         *memory
+	logger         *zap.Logger
+	waiters        map[string][]*waiter      // clients blocked on the lists, they stay when the data is replaced
+	keysVersion    uint64                    // changes when a key is added or deleted
+	scanIndex      atomic.Pointer[scanIndex] // the keys sorted for Scan, rebuilt when keysVersion changes
+}
+
+func newShards(logger *zap.Logger, mem *memory, db string) []*shard {
+	shards := make([]*shard, shardCount)
+	for i := range shards {
+		shards[i] = &shard{
+			inner:          make(map[string]*val),
+			arrays:         make(map[string]*list),
+			hashes:         make(map[string]map[string]string),
+			zsets:          make(map[string]*zset),
+			sets:           make(map[string]set),
+			expirationTime: make(map[string]int64),
+			expiry:         newExpiryIndex(),
+			meta:           make(map[string]*entryMeta),
+			db:             db,
+			memory:         mem,
+			logger:         logger,
+			waiters:        make(map[string][]*waiter),
+		}
+	}
+	return shards
+}
+
+func shardIndex(key string) int {
+	return int(keyHash(key) >> shardShift)
+}
+
+// lock write-locks the shard owning the key and returns it with the unlock function.
+func (r *Storage) lock(key string) (*shard, func()) {
+	s := r.shards[shardIndex(key)]
+	return s, r.lockShard(s)
+}
+
+// lockShard write-locks the shard and returns the unlock function.
+// Inside a transaction every shard is already locked, so nothing is done.
+func (r *Storage) lockShard(s *shard) func() {
+	if r.held {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// rlockShard works like lockShard, but takes the read lock.
+func (r *Storage) rlockShard(s *shard) func() {
+	if r.held {
+		return func() {}
+	}
+	s.mu.RLock()
+	return s.mu.RUnlock
+}
+
+// read runs fn under the read lock of the shard owning the key.
+// If the key turns out to be expired, it is deleted under the write lock afterwards.
+func (r *Storage) read(key string, fn func(s *shard) error) error {
+	s := r.shards[shardIndex(key)]
+
+	runlock := r.rlockShard(s)
+	err := fn(s)
+	expired := s.expired(key)
+	if !expired {
+		s.touch(key)
+	}
+	runlock()
+
+	if expired {
+		unlock := r.lockShard(s)
+		s.dropExpired(key)
+		unlock()
+	}
+	return err
+}
+
+// rlockAll read-locks every shard of the database and returns the function unlocking them.
+// The background work which covers all the databases uses lockDatabases instead.
+func (r *Storage) rlockAll() func() {
+	if r.held {
+		return func() {}
+	}
+	for _, s := range r.shards {
+		s.mu.RLock()
+	}
+	return func() {
+		for _, s := range r.shards {
+			s.mu.RUnlock()
+		}
+	}
+}
+
+// lockAll write-locks every shard of the database and returns the function unlocking them.
+func (r *Storage) lockAll() func() {
+	if r.held {
+		return func() {}
+	}
+	for _, s := range r.shards {
+		s.mu.Lock()
+	}
+	return func() {
+		for _, s := range r.shards {
+			s.mu.Unlock()
+		}
+	}
+}
+
+// expired reports whether the key has an expiration time which has passed.
+func (s *shard) expired(key string) bool {
+	expTime := s.expirationTime[key]
+	return expTime != 0 && expTime < time.Now().UnixMilli()
+}
+
+// dropExpired deletes the key if it is expired. Needs the write lock.
+func (s *shard) dropExpired(key string) {
+	if s.expired(key) {
+		s.deleteKey(key)
+	}
+}
+
+func (s *shard) deleteKey(key string) {
+	if _, exists := s.inner[key]; exists {
+		delete(s.inner, key)
+		s.logger.Info("Deleted expired key from inner", zap.String("key", key))
+	}
+	if _, exists := s.arrays[key]; exists {
+		delete(s.arrays, key)
+		s.logger.Info("Deleted expired key from arrays", zap.String("key", key))
+	}
+	if _, exists := s.hashes[key]; exists {
+		delete(s.hashes, key)
+		s.logger.Info("Deleted expired key from hashes", zap.String("key", key))
+	}
+	if _, exists := s.zsets[key]; exists {
+		delete(s.zsets, key)
+		s.logger.Info("Deleted expired key from zsets", zap.String("key", key))
+	}
+	if _, exists := s.sets[key]; exists {
+		delete(s.sets, key)
+		s.logger.Info("Deleted expired key from sets", zap.String("key", key))
+	}
+	s.forgetExpiration(key)
+	s.logger.Info("Deleted expiration entry for key", zap.String("key", key))
+	s.setSize(key, 0)
+	s.deleted = s.memory.versions.Add(1)
+}
+
+func (s *shard) checkArrKey(key string) error {
+	if _, exists := s.arrays[key]; !exists || s.expired(key) {
+		return ErrKeyDoesntExist
+	}
+	return nil
+}
+
+func (s *shard) checkHashKey(key string) error {
+	if _, exists := s.hashes[key]; !exists || s.expired(key) {
+		return ErrKeyDoesntExist
+	}
+	return nil
+}
+
+func (s *shard) getValue(key string) (*val, error) {
+	val, ok := s.inner[key]
+
+	if !ok || s.expired(key) {
+		s.logger.Info("key value doesnt exist", zap.String("key", key))
+		return nil, ErrKeyDoesntExist
+	}
+
+	s.logger.Info("storage request", zap.String("key", key),
+		zap.String("val", val.logValue()), zap.String("type", string(val.valueType)))
+
+	return val, nil
+}
+
+// alive reports whether the key holds a value of any type which is not expired.
+func (s *shard) alive(key string) bool {
+	return s.keyType(key) != TypeNone && !s.expired(key)
+}
+
+// keyType returns the type of the value stored at key without checking its expiration.
+func (s *shard) keyType(key string) string {
+	if _, ok := s.inner[key]; ok {
+		return TypeString
+	}
+	if _, ok := s.arrays[key]; ok {
+		return TypeList
+	}
+	if _, ok := s.hashes[key]; ok {
+		return TypeHash
+	}
+	if _, ok := s.zsets[key]; ok {
+		return TypeZSet
+	}
+	if _, ok := s.sets[key]; ok {
+		return TypeSet
+	}
+	return TypeNone
+}
+
+// checkType returns ErrKeyAlreadyExists if the key holds a not expired value of another type.
+func (s *shard) checkType(key string, typ string) error {
+	if t := s.keyType(key); t == TypeNone || t == typ || s.expired(key) {
+		return nil
+	}
+
+	s.logger.Error("по данному ключу существует значение другого типа", zap.String("key", key))
+	return ErrKeyAlreadyExists
+}
+
+// walkKeys calls fn for every key which is not expired.
+func (s *shard) walkKeys(fn func(key string)) {
+	curTime := time.Now().UnixMilli()
+	visit := func(key string) {
+		if expTime := s.expirationTime[key]; expTime != 0 && expTime < curTime {
+			return
+		}
+		fn(key)
+	}
+
+	for key := range s.inner {
+		visit(key)
+	}
+	for key := range s.arrays {
+		visit(key)
+	}
+	for key := range s.hashes {
+		visit(key)
+	}
+	for key := range s.zsets {
+		visit(key)
+	}
+	for key := range s.sets {
+		visit(key)
+	}
+}
@@ -0,0 +1,279 @@
+package storage
+
+import "math/rand"
+
+const (
+	skiplistMaxLevel = 32
+	// skiplistP is the probability of a node to have one more level
+	skiplistP = 0.25
+)
+
+// skiplist keeps the members of a sorted set ordered by score, then by member.
+// Like in redis, every link knows how many nodes it skips, so ranks are found in O(log n).
+type skiplist struct {
+	header *skiplistNode
+	tail   *skiplistNode
+	length int
+	level  int
+}
+
+type skiplistNode struct {
+	member   string
+	score    float64
+	backward *skiplistNode
+	levels   []skiplistLevel
+}
+
+type skiplistLevel struct {
+	forward *skiplistNode
+	span    int // number of nodes between this one and forward including forward
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{
+		header: &skiplistNode{levels: make([]skiplistLevel, skiplistMaxLevel)},
+		level:  1,
+	}
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Float64() < skiplistP {
+		level++
+	}
+	return level
+}
+
+// before reports whether the node goes before the member with the score.
+func (n *skiplistNode) before(score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+// insert adds the member, which must not be in the list.
+func (l *skiplist) insert(score float64, member string) {
+	var update [skiplistMaxLevel]*skiplistNode
+	var rank [skiplistMaxLevel]int
+
+	x := l.header
+	for i := l.level - 1; i >= 0; i-- {
+		if i < l.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.levels[i].forward != nil && x.levels[i].forward.before(score, member) {
+			rank[i] += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	if level > l.level {
+		for i := l.level; i < level; i++ {
+			update[i] = l.header
+			update[i].levels[i].span = l.length
+		}
+		l.level = level
+	}
+
+	x = &skiplistNode{member: member, score: score, levels: make([]skiplistLevel, level)}
+	for i := 0; i < level; i++ {
+		x.levels[i].forward = update[i].levels[i].forward
+		update[i].levels[i].forward = x
+		x.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < l.level; i++ {
+		update[i].levels[i].span++
+	}
+
+	if update[0] != l.header {
+		x.backward = update[0]
+	}
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x
+	} else {
+		l.tail = x
+	}
+	l.length++
+}
+
+// delete removes the member with the score, it returns false if there is no such member.
+func (l *skiplist) delete(score float64, member string) bool {
+	var update [skiplistMaxLevel]*skiplistNode
+
+	x := l.header
+	for i := l.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && x.levels[i].forward.before(score, member) {
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.levels[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+
+	for i := 0; i < l.level; i++ {
+		if update[i].levels[i].forward == x {
+			update[i].levels[i].span += x.levels[i].span - 1
+			update[i].levels[i].forward = x.levels[i].forward
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x.backward
+	} else {
+		l.tail = x.backward
+	}
+	for l.level > 1 && l.header.levels[l.level-1].forward == nil {
+		l.level--
+	}
+	l.length--
+	return true
+}
+
+// rank returns the rank of the member with the score starting from 1, 0 if there is no such member.
+func (l *skiplist) rank(score float64, member string) int {
+	rank := 0
+	x := l.header
+	for i := l.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil &&
+			(x.levels[i].forward.before(score, member) || x.levels[i].forward.member == member) {
+			rank += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if x != l.header && x.member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// byRank returns the node of the rank starting from 1, nil if the rank is out of the list.
+func (l *skiplist) byRank(rank int) *skiplistNode {
+	traversed := 0
+	x := l.header
+	for i := l.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && traversed+x.levels[i].span <= rank {
+			traversed += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if traversed == rank && x != l.header {
+			return x
+		}
+	}
+	return nil
+}
+
+// ScoreRange is an interval of scores, infinite bounds are math.Inf.
+type ScoreRange struct {
+	Min, Max                   float64
+	MinExclusive, MaxExclusive bool
+}
+
+func (r ScoreRange) aboveMin(score float64) bool {
+	if r.MinExclusive {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+func (r ScoreRange) belowMax(score float64) bool {
+	if r.MaxExclusive {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
+
+func (r ScoreRange) empty() bool {
+	return r.Min > r.Max || (r.Min == r.Max && (r.MinExclusive || r.MaxExclusive))
+}
+
+// firstInRange returns the first node with the score in the range, nil if there is none.
+func (l *skiplist) firstInRange(r ScoreRange) *skiplistNode {
+	if r.empty() {
+		return nil
+	}
+
+	x := l.header
+	for i := l.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && !r.aboveMin(x.levels[i].forward.score) {
+			x = x.levels[i].forward
+		}
+	}
+	x = x.levels[0].forward
+	if x == nil || !r.belowMax(x.score) {
+		return nil
+	}
+	return x
+}
+
+// lastInRange returns the last node with the score in the range, nil if there is none.
+func (l *skiplist) lastInRange(r ScoreRange) *skiplistNode {
+	if r.empty() {
+		return nil
+	}
+
+	x := l.header
+	for i := l.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && r.belowMax(x.levels[i].forward.score) {
+			x = x.levels[i].forward
+		}
+	}
+	if x == l.header || !r.aboveMin(x.score) {
+		return nil
+	}
+	return x
+}
+
+// zset is a sorted set: the scores by member and the members ordered by score.
+type zset struct {
+	scores map[string]float64
+	list   *skiplist
+}
+
+func newZSet() *zset {
+	return &zset{
+		scores: make(map[string]float64),
+		list:   newSkiplist(),
+	}
+}
+
+// set adds the member or changes its score, it returns true if the member is new.
+func (z *zset) set(member string, score float64) bool {
+	old, exists := z.scores[member]
+	if exists {
+		if old == score {
+			return false
+		}
+		z.list.delete(old, member)
+	}
+	z.scores[member] = score
+	z.list.insert(score, member)
+	return !exists
+}
+
+// remove deletes the member, it returns false if there is no such member.
+func (z *zset) remove(member string) bool {
+	score, exists := z.scores[member]
+	if !exists {
+		return false
+	}
+	delete(z.scores, member)
+	z.list.delete(score, member)
+	return true
+}
+
+func (z *zset) len() int {
+	return z.list.length
+}
+
+func (z *zset) clone() *zset {
+	c := newZSet()
+	for x := z.list.header.levels[0].forward; x != nil; x = x.levels[0].forward {
+		c.set(x.member, x.score)
+	}
+	return c
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"encoding/json"
+	"math"
 	"math/rand"
 	"os"
 	"strconv"
@@ -10,6 +12,16 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// newTestStorage creates a storage which keeps its snapshots in memory.
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	r, err := NewStorageWithPersister(time.Minute*20, time.Minute*60, NewMemoryPersister())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
 type testCase struct {
 	key   string
 	value string
@@ -120,6 +132,47 @@ func BenchmarkGetSet(b *testing.B) {
 // PASS
 // ok  	hw1/internal/pkg/storage	7.330s
 
+func BenchmarkGetParallel(b *testing.B) {
+	for in, tCase := range cases {
+		b.Run(strconv.Itoa(in), func(b *testing.B) {
+			s, _ := NewStorage(time.Minute*20, time.Minute*60, "test.json")
+
+			for i := 0; i < tCase.cnt; i++ {
+				s.Set(strconv.Itoa(i), strconv.Itoa(i))
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				rnd := rand.New(rand.NewSource(rand.Int63()))
+				for pb.Next() {
+					s.Get(strconv.Itoa(rnd.Intn(tCase.cnt)))
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkGetSetParallel(b *testing.B) {
+	for in, tCase := range cases {
+		b.Run(strconv.Itoa(in), func(b *testing.B) {
+			s, _ := NewStorage(time.Minute*20, time.Minute*60, "test.json")
+
+			for i := 0; i < tCase.cnt; i++ {
+				s.Set(strconv.Itoa(i), strconv.Itoa(i))
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				rnd := rand.New(rand.NewSource(rand.Int63()))
+				for i := 0; pb.Next(); i++ {
+					s.Set(strconv.Itoa(i), strconv.Itoa(i))
+					s.Get(strconv.Itoa(rnd.Intn(tCase.cnt)))
+				}
+			})
+		})
+	}
+}
+
 func TestSetGet(t *testing.T) {
 	cases := []testCase{
 		{"hello", "world", KindString},
@@ -215,3 +268,156 @@ func TestDatabaseSaveAndLoadWithGarbageCollector(t *testing.T) {
 	assert.False(t, err2 == nil, "key2 должен быть удален после garbage collection")
 	assert.True(t, err3 == nil, "key3 должен оставаться")
 }
+
+// expire calls Expire and fails the test on an error.
+func expire(t *testing.T, r *Storage, key string, ex int64) bool {
+	t.Helper()
+	ok, err := r.Expire(key, ex)
+	assert.NoError(t, err)
+	return ok
+}
+
+// pexpire calls PExpire and fails the test on an error.
+func pexpire(t *testing.T, r *Storage, key string, ms int64) bool {
+	t.Helper()
+	ok, err := r.PExpire(key, ms)
+	assert.NoError(t, err)
+	return ok
+}
+
+func TestExpireTTLPersist(t *testing.T) {
+	r := newTestStorage(t)
+
+	assert.Equal(t, int64(-2), r.TTL("scalar"))
+	assert.Equal(t, int64(-2), r.PTTL("scalar"))
+	assert.False(t, expire(t, r, "scalar", 10))
+	assert.False(t, r.Persist("scalar"))
+
+	r.Set("scalar", "value")
+	assert.Equal(t, int64(-1), r.TTL("scalar"))
+	assert.False(t, r.Persist("scalar"))
+
+	assert.True(t, expire(t, r, "scalar", 100))
+	assert.Equal(t, int64(100), r.TTL("scalar"))
+	pttl := r.PTTL("scalar")
+	assert.True(t, pttl > 99000 && pttl <= 100000, "pttl = %d", pttl)
+
+	assert.True(t, r.Persist("scalar"))
+	assert.Equal(t, int64(-1), r.TTL("scalar"))
+
+	r.Rpush("array", "1", "2")
+	assert.True(t, pexpire(t, r, "array", 1500))
+	assert.Equal(t, int64(2), r.TTL("array"))
+
+	r.SetPX("short", "value", 50)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int64(-2), r.TTL("short"))
+	assert.False(t, expire(t, r, "short", 10))
+	_, err := r.Get("short")
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+
+	assert.ErrorIs(t, r.SetPX("negative", "value", -1), ErrIncorrectArgs)
+
+	// the times which overflow time.Duration are rejected and keep the key
+	r.Set("long", "value")
+	_, err = r.Expire("long", math.MaxInt64/1000)
+	assert.ErrorIs(t, err, ErrIncorrectArgs)
+	_, err = r.Expire("long", 9223372036854775)
+	assert.ErrorIs(t, err, ErrIncorrectArgs)
+	_, err = r.PExpire("long", math.MinInt64)
+	assert.ErrorIs(t, err, ErrIncorrectArgs)
+	assert.ErrorIs(t, r.SetPX("long", "value", math.MaxInt64), ErrIncorrectArgs)
+	assert.ErrorIs(t, r.Set("long", "value", math.MaxInt64), ErrIncorrectArgs)
+	assert.Equal(t, int64(-1), r.TTL("long"))
+	assert.True(t, expire(t, r, "long", 9223372036))
+	assert.Greater(t, r.TTL("long"), int64(9223372000))
+}
+
+func TestHash(t *testing.T) {
+	r := newTestStorage(t)
+
+	_, err := r.Hset("user", "name")
+	assert.ErrorIs(t, err, ErrIncorrectArgs)
+
+	added, err := r.Hset("user", "name", "bob", "age", "20")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, added)
+
+	added, err = r.Hset("user", "name", "alice", "city", "nsk")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, added)
+
+	value, err := r.Hget("user", "name")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", value)
+
+	_, err = r.Hget("user", "unknown")
+	assert.ErrorIs(t, err, ErrFieldDoesntExist)
+	_, err = r.Hget("nouser", "name")
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+
+	length, err := r.Hlen("user")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, length)
+
+	hash, err := r.Hgetall("user")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"name": "alice", "age": "20", "city": "nsk"}, hash)
+
+	deleted, err := r.Hdel("user", "age", "unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	deleted, err = r.Hdel("user", "name", "city")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	_, err = r.Hlen("user")
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+}
+
+func TestHashTypeConflicts(t *testing.T) {
+	r := newTestStorage(t)
+
+	r.Set("scalar", "value")
+	r.Rpush("array", "1")
+	r.Hset("hash", "field", "value")
+
+	_, err := r.Hset("scalar", "field", "value")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	_, err = r.Hset("array", "field", "value")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+
+	assert.ErrorIs(t, r.Set("hash", "value"), ErrKeyAlreadyExists)
+	_, err = r.Rpush("hash", "1")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	_, err = r.Lpush("hash", "1")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	assert.ErrorIs(t, r.Lset("hash", 0, "1"), ErrKeyAlreadyExists)
+
+	assert.True(t, pexpire(t, r, "hash", 50))
+	time.Sleep(100 * time.Millisecond)
+	_, err = r.Hget("hash", "field")
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+	assert.NoError(t, r.Set("hash", "value"))
+}
+
+func TestHashMarshal(t *testing.T) {
+	r := newTestStorage(t)
+
+	r.Hset("user", "name", "bob")
+	data, err := json.Marshal(r)
+	assert.NoError(t, err)
+
+	r2 := newTestStorage(t)
+	assert.NoError(t, json.Unmarshal(data, r2))
+
+	value, err := r2.Hget("user", "name")
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", value)
+
+	// snapshot without hashes
+	assert.NoError(t, json.Unmarshal([]byte(`{"inner":{},"arrays":{},"ExpirationTime":{}}`), r2))
+	added, err := r2.Hset("user", "name", "bob")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, added)
+}
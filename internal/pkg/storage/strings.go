@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// maxStringSize limits the strings grown by Append and SetRange, like proto-max-bulk-len in redis.
+const maxStringSize = 512 << 20
+
+var ErrStringTooLong = errors.New("string exceeds maximum allowed size")
+
+// Append appends value to the scalar stored at key and returns its new length,
+// a missing key is created with the value. KindString and KindBinary values keep their kind, the result
+// of a number is a number again only if it is the canonical form of it, like "12" + "3", but not "0" + "7".
+func (r *Storage) Append(key string, value string) (int, error) {
+	if err := r.reserve(); err != nil {
+		return 0, err
+	}
+
+	s, unlock := r.lock(key)
+	defer unlock()
+
+	current, k, t, err := s.stringForWrite(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(current)+len(value) > maxStringSize {
+		return 0, ErrStringTooLong
+	}
+
+	result := current + value
+	r.writeString(s, key, result, k, t)
+	return len(result), nil
+}
+
+// Strlen returns the length of the scalar stored at key the way Get returns it, 0 if the key doesnt exist.
+func (r *Storage) Strlen(key string) (int, error) {
+	value, err := r.readString(key)
+	return len(value), err
+}
+
+// GetRange returns the substring of the scalar between the byte offsets start and end, both inclusive.
+// Negative offsets count from the end, the range is clamped to the string,
+// an empty string is returned for a missing key or an empty range.
+func (r *Storage) GetRange(key string, start, end int) (string, error) {
+	value, err := r.readString(key)
+	if err != nil {
+		return "", err
+	}
+
+	leng := len(value)
+	if start < 0 {
+		start = max(leng+start, 0)
+	}
+	if end < 0 {
+		end += leng
+	}
+	end = min(end, leng-1)
+	if start > end {
+		return "", nil
+	}
+	return value[start : end+1], nil
+}
+
+// SetRange overwrites the scalar stored at key with value starting at the byte offset and returns
+// the new length. The string is padded with zero bytes up to the offset, a missing key is created,
+// unless value is empty. The expiration of the key is kept, the kind changes like in Append.
+func (r *Storage) SetRange(key string, offset int, value string) (int, error) {
+	if offset < 0 {
+		return 0, ErrIndexOutOfRange
+	}
+	if offset+len(value) > maxStringSize {
+		return 0, ErrStringTooLong
+	}
+	if err := r.reserve(); err != nil {
+		return 0, err
+	}
+
+	s, unlock := r.lock(key)
+	defer unlock()
+
+	current, k, t, err := s.stringForWrite(key)
+	if err != nil {
+		return 0, err
+	}
+	if value == "" {
+		return len(current), nil
+	}
+
+	buf := []byte(current)
+	if end := offset + len(value); end > len(buf) {
+		buf = append(buf, make([]byte, end-len(buf))...)
+	}
+	copy(buf[offset:], value)
+
+	r.writeString(s, key, string(buf), k, t)
+	return len(buf), nil
+}
+
+// GetSet sets the scalar like Set without expiration and returns the old value,
+// exists is false if there was no value.
+func (r *Storage) GetSet(key string, value string) (old string, exists bool, err error) {
+	if err := r.reserve(); err != nil {
+		return "", false, err
+	}
+
+	s, unlock := r.lock(key)
+	defer unlock()
+
+	s.dropExpired(key)
+	if err := s.checkType(key, TypeString); err != nil {
+		return "", false, err
+	}
+	if v, ok := s.inner[key]; ok {
+		old, exists = v.string(), true
+	}
+
+	r.writeString(s, key, value, KindAuto, 0)
+	return old, exists, nil
+}
+
+// GetDel deletes the scalar stored at key and returns it.
+func (r *Storage) GetDel(key string) (string, error) {
+	s, unlock := r.lock(key)
+	defer unlock()
+
+	s.dropExpired(key)
+	if err := s.checkType(key, TypeString); err != nil {
+		return "", err
+	}
+	v, err := s.getValue(key)
+	if err != nil {
+		return "", err
+	}
+	value := v.string()
+
+	s.deleteKey(key)
+	r.propagate(aofRecord{Cmd: "del", Key: key})
+	r.logger.Info("key deleted", zap.String("key", key))
+	return value, nil
+}
+
+// readString returns the scalar stored at key as a string, "" if the key doesnt exist.
+func (r *Storage) readString(key string) (string, error) {
+	var value string
+	err := r.read(key, func(s *shard) error {
+		if err := s.checkType(key, TypeString); err != nil {
+			return err
+		}
+		if v, err := s.getValue(key); err == nil {
+			value = v.string()
+		}
+		return nil
+	})
+	return value, err
+}
+
+// stringForWrite returns the scalar stored at key as a string with its expiration time
+// and the kind to store the changed string as: the same one for KindString and KindBinary and KindAuto for numbers.
+// A missing key is "", KindAuto and 0. Needs the write lock.
+func (s *shard) stringForWrite(key string) (string, kind, int64, error) {
+	s.dropExpired(key)
+	if err := s.checkType(key, TypeString); err != nil {
+		return "", KindAuto, 0, err
+	}
+	v, ok := s.inner[key]
+	if !ok {
+		return "", KindAuto, 0, nil
+	}
+
+	k := KindAuto
+	if v.valueType == KindString || v.valueType == KindBinary {
+		k = v.valueType
+	}
+	return v.string(), k, s.expirationTime[key], nil
+}
+
+// writeString stores the scalar as the kind k with the absolute expiration time t and logs it as a set.
+// The type of the key must be checked already and the value must fit the kind.
+func (r *Storage) writeString(s *shard, key string, value string, k kind, t int64) {
+	s.set(key, value, k, t)
+	s.resize(key)
+	r.propagate(setRecord(key, value, k, t))
+}
@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendStrlen(t *testing.T) {
+	r := newTestStorage(t)
+
+	n, err := r.Append("key", "hello")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	n, err = r.Append("key", " world")
+	assert.NoError(t, err)
+	assert.Equal(t, 11, n)
+	n, err = r.Strlen("key")
+	assert.NoError(t, err)
+	assert.Equal(t, 11, n)
+
+	n, err = r.Strlen("missing")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// appending to a number gives a number only in its canonical form
+	assert.NoError(t, r.Set("int", "12"))
+	_, err = r.Append("int", "3")
+	assert.NoError(t, err)
+	kind, _ := r.GetKind("int")
+	assert.Equal(t, KindInt, kind)
+
+	assert.NoError(t, r.Set("zero", "0"))
+	_, err = r.Append("zero", "7")
+	assert.NoError(t, err)
+	value, _ := r.Get("zero")
+	assert.Equal(t, "07", value)
+	kind, _ = r.GetKind("zero")
+	assert.Equal(t, KindString, kind)
+
+	// numbers which are not canonical are not converted by Set either
+	assert.NoError(t, r.Set("padded", "007"))
+	value, _ = r.Get("padded")
+	assert.Equal(t, "007", value)
+
+	_, err = r.Rpush("list", "1")
+	assert.NoError(t, err)
+	_, err = r.Append("list", "1")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	_, err = r.Strlen("list")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+}
+
+func TestGetRangeSetRange(t *testing.T) {
+	r := newTestStorage(t)
+	assert.NoError(t, r.Set("key", "This is a string"))
+
+	for _, tc := range []struct {
+		start, end int
+		expected   string
+	}{
+		{0, 3, "This"},
+		{-3, -1, "ing"},
+		{0, -1, "This is a string"},
+		{10, 100, "string"},
+		{-100, 3, "This"},
+		{5, 2, ""},
+		{100, 200, ""},
+	} {
+		value, err := r.GetRange("key", tc.start, tc.end)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, value, "%d..%d", tc.start, tc.end)
+	}
+	value, err := r.GetRange("missing", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, "", value)
+
+	assert.NoError(t, r.Set("key", "Hello World", 100))
+	n, err := r.SetRange("key", 6, "Redis")
+	assert.NoError(t, err)
+	assert.Equal(t, 11, n)
+	value, _ = r.Get("key")
+	assert.Equal(t, "Hello Redis", value)
+	assert.Greater(t, r.TTL("key"), int64(90))
+
+	n, err = r.SetRange("padded", 3, "x")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	value, _ = r.Get("padded")
+	assert.Equal(t, "\x00\x00\x00x", value)
+
+	// an empty value does not create the key
+	n, err = r.SetRange("empty", 5, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	_, err = r.Get("empty")
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+
+	_, err = r.SetRange("key", -1, "x")
+	assert.ErrorIs(t, err, ErrIndexOutOfRange)
+	_, err = r.SetRange("key", maxStringSize, "x")
+	assert.ErrorIs(t, err, ErrStringTooLong)
+
+	assert.NoError(t, r.Set("int", "100"))
+	_, err = r.SetRange("int", 0, "2")
+	assert.NoError(t, err)
+	v, _ := r.GetValue("int")
+	assert.Equal(t, KindInt, v.valueType)
+	assert.Equal(t, 200, v.intValue)
+}
+
+func TestGetSetGetDel(t *testing.T) {
+	r := newTestStorage(t)
+
+	_, exists, err := r.GetSet("key", "1")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.True(t, expire(t, r, "key", 100))
+	old, exists, err := r.GetSet("key", "value")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, "1", old)
+	assert.Equal(t, int64(-1), r.TTL("key"))
+
+	value, err := r.GetDel("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", value)
+	_, err = r.GetDel("key")
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+
+	_, err = r.Hset("hash", "a", "1")
+	assert.NoError(t, err)
+	_, _, err = r.GetSet("hash", "1")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	_, err = r.GetDel("hash")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+}
+
+func TestSetTyped(t *testing.T) {
+	r := newTestStorage(t)
+
+	for _, tc := range []struct {
+		value    string
+		kind     kind
+		expected string
+		stored   kind
+	}{
+		{"123", KindString, "123", KindString},
+		{"007", KindString, "007", KindString},
+		{"123", KindAuto, "123", KindInt},
+		{"007", KindAuto, "007", KindString},
+		{"007", KindInt, "7", KindInt},
+		{"-5", KindInt, "-5", KindInt},
+	} {
+		assert.NoError(t, r.SetTyped("key", tc.value, tc.kind, 0))
+		value, k, err := r.GetTyped("key")
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, value, "%s as %q", tc.value, tc.kind)
+		assert.Equal(t, tc.stored, k, "%s as %q", tc.value, tc.kind)
+	}
+
+	assert.ErrorIs(t, r.SetTyped("key", "value", KindInt, 0), ErrNotInteger)
+	assert.ErrorIs(t, r.SetTyped("key", "value", KindUndefined, 0), ErrUnsupportedValueType)
+	assert.ErrorIs(t, r.SetTyped("key", "value", KindString, -1), ErrIncorrectArgs)
+
+	assert.NoError(t, r.SetTyped("ttl", "1", KindString, 100000))
+	assert.Greater(t, r.TTL("ttl"), int64(90))
+
+	// a string stays a string when it is changed
+	assert.NoError(t, r.SetTyped("key", "12", KindString, 0))
+	_, err := r.Append("key", "3")
+	assert.NoError(t, err)
+	_, k, _ := r.GetTyped("key")
+	assert.Equal(t, KindString, k)
+
+	_, _, err = r.GetTyped("missing")
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+	_, err = r.Rpush("list", "1")
+	assert.NoError(t, err)
+	_, _, err = r.GetTyped("list")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+}
+
+func TestFloatAndBinary(t *testing.T) {
+	r := newTestStorage(t)
+
+	for _, tc := range []struct {
+		value    string
+		kind     kind
+		expected string
+		stored   kind
+	}{
+		{"1.5", KindAuto, "1.5", KindFloat},
+		{"1.50", KindAuto, "1.50", KindString},
+		{"1e3", KindAuto, "1e3", KindString},
+		{"1e3", KindFloat, "1000", KindFloat},
+		{"2.5", KindFloat, "2.5", KindFloat},
+		{"\x00\xff", KindBinary, "\x00\xff", KindBinary},
+		{"12", KindBinary, "12", KindBinary},
+	} {
+		assert.NoError(t, r.SetTyped("key", tc.value, tc.kind, 0))
+		value, k, err := r.GetTyped("key")
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, value, "%q as %q", tc.value, tc.kind)
+		assert.Equal(t, tc.stored, k, "%q as %q", tc.value, tc.kind)
+	}
+
+	assert.ErrorIs(t, r.SetTyped("key", "x", KindFloat, 0), ErrNotFloat)
+	assert.ErrorIs(t, r.SetTyped("key", "NaN", KindFloat, 0), ErrNotFloat)
+
+	// binary values stay binary when they are changed
+	assert.NoError(t, r.SetTyped("binary", "\x00", KindBinary, 0))
+	_, err := r.Append("binary", "1")
+	assert.NoError(t, err)
+	value, k, _ := r.GetTyped("binary")
+	assert.Equal(t, "\x001", value)
+	assert.Equal(t, KindBinary, k)
+}
@@ -0,0 +1,27 @@
+package storage
+
+// Atomically runs fn with every shard of the database write-locked, so other clients see either none
+// or all of its writes. fn gets the storage to work with instead of r, its methods
+// do not lock the shards again. It must not be used after fn returns
+// and calls of r inside fn deadlock.
+func (r *Storage) Atomically(fn func(tx *Storage)) {
+	unlock := r.lockAll()
+	defer unlock()
+
+	fn(r.view(r.db, r.shards, true))
+}
+
+// KeyVersion returns the version of the key of any type, it changes when the key is written or deleted.
+// Missing keys have the version of the last deletion in their shard, so a key which is created
+// and deleted again gets another version too. Other keys may share the version of a missing key.
+func (r *Storage) KeyVersion(key string) uint64 {
+	s, unlock := r.lock(key)
+	defer unlock()
+
+	// an expired key is deleted first, so it gets the version of its deletion
+	s.dropExpired(key)
+	if m, ok := s.meta[key]; ok {
+		return m.version
+	}
+	return s.deleted
+}
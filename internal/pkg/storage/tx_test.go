@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAtomically(t *testing.T) {
+	r := newTestStorage(t)
+	assert.NoError(t, r.Set("counter", "0"))
+
+	// read-modify-write of several keys is not interleaved with other transactions
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				r.Atomically(func(tx *Storage) {
+					value, _ := tx.Get("counter")
+					n, _ := strconv.Atoi(value)
+					assert.NoError(t, tx.Set("counter", strconv.Itoa(n+1)))
+					_, err := tx.Rpush("log", strconv.Itoa(n))
+					assert.NoError(t, err)
+					assert.Equal(t, []string{"counter", "log"}, tx.Keys("*"))
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, err := r.Get("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, "400", value)
+	last, err := r.Lget("log", 399)
+	assert.NoError(t, err)
+	assert.Equal(t, "399", last)
+}
+
+func TestKeyVersion(t *testing.T) {
+	r := newTestStorage(t)
+
+	missing := r.KeyVersion("key")
+	assert.Equal(t, missing, r.KeyVersion("key"))
+
+	_, err := r.Hset("key", "field", "value")
+	assert.NoError(t, err)
+	v1 := r.KeyVersion("key")
+	assert.NotEqual(t, missing, v1)
+	assert.Equal(t, v1, r.KeyVersion("key"))
+
+	_, err = r.Hset("key", "field", "other")
+	assert.NoError(t, err)
+	v2 := r.KeyVersion("key")
+	assert.NotEqual(t, v1, v2)
+
+	// the deleted key does not get its old version back
+	assert.True(t, r.Delete("key"))
+	deleted := r.KeyVersion("key")
+	assert.NotEqual(t, missing, deleted)
+	assert.NotEqual(t, v2, deleted)
+
+	assert.NoError(t, r.SetPX("key", "value", 1))
+	v3 := r.KeyVersion("key")
+	time.Sleep(5 * time.Millisecond)
+	assert.NotEqual(t, v3, r.KeyVersion("key"), "expired key is deleted")
+}
@@ -0,0 +1,363 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+var ErrMemberDoesntExist = errors.New("sorted set member doesnt exist")
+
+// ZMember is a member of a sorted set with its score.
+type ZMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// ZAddOptions change how ZAdd treats the existing members, like the flags of redis ZADD.
+type ZAddOptions struct {
+	NX bool // only add new members
+	XX bool // only update existing members
+	GT bool // only update the scores which grow, new members are added
+	LT bool // only update the scores which drop, new members are added
+	CH bool // count the changed members in the result, not only the added ones
+}
+
+func (o ZAddOptions) valid() bool {
+	return !(o.NX && o.XX) && !(o.GT && o.LT) && !(o.NX && (o.GT || o.LT))
+}
+
+// zsetOf returns the sorted set stored at key. Returns ErrKeyAlreadyExists
+// if the key holds a value of another type and ErrKeyDoesntExist if there is no key.
+func (s *shard) zsetOf(key string) (*zset, error) {
+	if err := s.checkType(key, TypeZSet); err != nil {
+		return nil, err
+	}
+	z, ok := s.zsets[key]
+	if !ok || s.expired(key) {
+		return nil, ErrKeyDoesntExist
+	}
+	return z, nil
+}
+
+func zsetMemberSize(member string) int64 {
+	return int64(zsetMemberOverhead + len(member))
+}
+
+// ZAdd adds the members to the sorted set stored at key or updates their scores
+// and returns the number of added members, or of changed ones with CH.
+// Scores must be finite, ErrNotFloat is returned otherwise.
+func (r *Storage) ZAdd(key string, opts ZAddOptions, members ...ZMember) (int, error) {
+	if len(members) == 0 || !opts.valid() {
+		return 0, ErrIncorrectArgs
+	}
+	for _, m := range members {
+		if math.IsNaN(m.Score) || math.IsInf(m.Score, 0) {
+			return 0, ErrNotFloat
+		}
+	}
+	if err := r.reserve(); err != nil {
+		return 0, err
+	}
+
+	s, unlock := r.lock(key)
+	defer unlock()
+
+	s.dropExpired(key)
+	if err := s.checkType(key, TypeZSet); err != nil {
+		return 0, err
+	}
+
+	z, exists := s.zsets[key]
+	if !exists {
+		z = newZSet()
+	}
+
+	added, changed := 0, 0
+	size := int64(entryOverhead + len(key) + zsetOverhead)
+	if exists {
+		size = s.sizeOf(key)
+	}
+	var args []string
+	for _, m := range members {
+		old, ok := z.scores[m.Member]
+		switch {
+		case ok && (opts.NX || (opts.GT && m.Score <= old) || (opts.LT && m.Score >= old)):
+			continue
+		case !ok && opts.XX:
+			continue
+		}
+
+		if z.set(m.Member, m.Score) {
+			added++
+			size += zsetMemberSize(m.Member)
+		}
+		if !ok || old != m.Score {
+			changed++
+			args = append(args, formatFloat(m.Score), m.Member)
+		}
+	}
+	if z.len() == 0 {
+		// XX with only new members creates nothing
+		return 0, nil
+	}
+
+	if !exists {
+		s.zsets[key] = z
+		s.setExpiration(key, 0)
+	}
+	s.setSize(key, size)
+	s.touch(key)
+	if len(args) > 0 {
+		r.propagate(aofRecord{Cmd: "zadd", Key: key, Args: args})
+	}
+
+	r.logger.Info("sorted set members added", zap.String("key", key),
+		zap.Int("count of members", len(members)), zap.Int("added", added))
+	if opts.CH {
+		return changed, nil
+	}
+	return added, nil
+}
+
+// ZIncrBy adds delta to the score of the member and returns the new score.
+// A missing member is added with the score 0 first.
+// ErrFloatOverflow is returned if the new score is not finite.
+func (r *Storage) ZIncrBy(key string, delta float64, member string) (float64, error) {
+	if math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return 0, ErrNotFloat
+	}
+	if err := r.reserve(); err != nil {
+		return 0, err
+	}
+
+	s, unlock := r.lock(key)
+	defer unlock()
+
+	s.dropExpired(key)
+	if err := s.checkType(key, TypeZSet); err != nil {
+		return 0, err
+	}
+
+	z, exists := s.zsets[key]
+	if !exists {
+		z = newZSet()
+	}
+	result := z.scores[member] + delta
+	if math.IsInf(result, 0) {
+		r.logger.Info("float overflow", zap.String("key", key), zap.String("member", member),
+			zap.Float64("delta", delta))
+		return 0, ErrFloatOverflow
+	}
+
+	size := int64(entryOverhead + len(key) + zsetOverhead)
+	if exists {
+		size = s.sizeOf(key)
+	} else {
+		s.zsets[key] = z
+		s.setExpiration(key, 0)
+	}
+	if z.set(member, result) {
+		size += zsetMemberSize(member)
+	}
+	s.setSize(key, size)
+	s.touch(key)
+	r.propagate(aofRecord{Cmd: "zadd", Key: key, Args: []string{formatFloat(result), member}})
+
+	r.logger.Info("sorted set score incremented", zap.String("key", key), zap.String("member", member),
+		zap.Float64("delta", delta), zap.Float64("score", result))
+	return result, nil
+}
+
+// ZRem removes the members from the sorted set and returns the number of removed ones.
+// The key is deleted when the sorted set becomes empty.
+func (r *Storage) ZRem(key string, members ...string) (int, error) {
+	s, unlock := r.lock(key)
+	defer unlock()
+
+	s.dropExpired(key)
+	z, err := s.zsetOf(key)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	size := s.sizeOf(key)
+	for _, member := range members {
+		if z.remove(member) {
+			removed++
+			size -= zsetMemberSize(member)
+		}
+	}
+
+	if z.len() == 0 {
+		delete(s.zsets, key)
+		s.forgetExpiration(key)
+		size = 0
+	}
+	s.setSize(key, size)
+	s.touch(key)
+	if removed > 0 {
+		r.propagate(aofRecord{Cmd: "zrem", Key: key, Args: members})
+	}
+
+	r.logger.Info("sorted set members removed", zap.String("key", key), zap.Int("removed", removed))
+	return removed, nil
+}
+
+// ZScore returns the score of the member, ErrMemberDoesntExist if there is no such member.
+func (r *Storage) ZScore(key string, member string) (float64, error) {
+	var score float64
+	err := r.read(key, func(s *shard) error {
+		z, err := s.zsetOf(key)
+		if err != nil {
+			return err
+		}
+
+		var ok bool
+		if score, ok = z.scores[member]; !ok {
+			return ErrMemberDoesntExist
+		}
+		return nil
+	})
+	return score, err
+}
+
+// ZCard returns the number of members of the sorted set.
+func (r *Storage) ZCard(key string) (int, error) {
+	length := 0
+	err := r.read(key, func(s *shard) error {
+		z, err := s.zsetOf(key)
+		if err != nil {
+			return err
+		}
+		length = z.len()
+		return nil
+	})
+	return length, err
+}
+
+// ZRank returns the rank of the member starting from 0, the members are ordered by score
+// from the lowest one, or from the highest one with rev. Members with equal scores are ordered
+// by name. ErrMemberDoesntExist is returned if there is no such member.
+func (r *Storage) ZRank(key string, member string, rev bool) (int, error) {
+	rank := 0
+	err := r.read(key, func(s *shard) error {
+		z, err := s.zsetOf(key)
+		if err != nil {
+			return err
+		}
+
+		score, ok := z.scores[member]
+		if !ok {
+			return ErrMemberDoesntExist
+		}
+		rank = z.list.rank(score, member) - 1
+		if rev {
+			rank = z.len() - 1 - rank
+		}
+		return nil
+	})
+	return rank, err
+}
+
+// ZRange returns the members with ranks from start to stop inclusive ordered like in ZRank.
+// Negative indexes count from the end, -1 is the last member, the range is clamped to the set.
+func (r *Storage) ZRange(key string, start, stop int, rev bool) ([]ZMember, error) {
+	var members []ZMember
+	err := r.read(key, func(s *shard) error {
+		z, err := s.zsetOf(key)
+		if err != nil {
+			return err
+		}
+
+		length := z.len()
+		if start < 0 {
+			start = max(length+start, 0)
+		}
+		if stop < 0 {
+			stop = length + stop
+		}
+		stop = min(stop, length-1)
+		if start > stop {
+			members = []ZMember{}
+			return nil
+		}
+
+		members = make([]ZMember, 0, stop-start+1)
+		if rev {
+			for x := z.list.byRank(length - start); len(members) < cap(members); x = x.backward {
+				members = append(members, ZMember{Member: x.member, Score: x.score})
+			}
+		} else {
+			for x := z.list.byRank(start + 1); len(members) < cap(members); x = x.levels[0].forward {
+				members = append(members, ZMember{Member: x.member, Score: x.score})
+			}
+		}
+		return nil
+	})
+	return members, err
+}
+
+// ZRangeByScore returns the members with the scores in the range ordered by score,
+// from the highest one with rev. The first offset members are skipped and at most count
+// are returned, a negative count means all of them.
+func (r *Storage) ZRangeByScore(key string, sr ScoreRange, rev bool, offset, count int) ([]ZMember, error) {
+	if math.IsNaN(sr.Min) || math.IsNaN(sr.Max) || offset < 0 {
+		return nil, ErrIncorrectArgs
+	}
+
+	var members []ZMember
+	err := r.read(key, func(s *shard) error {
+		z, err := s.zsetOf(key)
+		if err != nil {
+			return err
+		}
+
+		first, next := z.list.firstInRange(sr), func(x *skiplistNode) *skiplistNode {
+			return x.levels[0].forward
+		}
+		inRange := func(x *skiplistNode) bool {
+			return sr.belowMax(x.score)
+		}
+		if rev {
+			first, next = z.list.lastInRange(sr), func(x *skiplistNode) *skiplistNode {
+				return x.backward
+			}
+			inRange = func(x *skiplistNode) bool {
+				return sr.aboveMin(x.score)
+			}
+		}
+
+		members = []ZMember{}
+		for x := first; x != nil && inRange(x) && count != 0; x = next(x) {
+			if offset > 0 {
+				offset--
+				continue
+			}
+			members = append(members, ZMember{Member: x.member, Score: x.score})
+			count--
+		}
+		return nil
+	})
+	return members, err
+}
+
+// applyZAdd repeats a recorded ZADD, the arguments are score member pairs.
+func (r *Storage) applyZAdd(key string, args []string) error {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return ErrIncorrectArgs
+	}
+	members := make([]ZMember, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		score, err := strconv.ParseFloat(args[i], 64)
+		if err != nil {
+			return ErrNotFloat
+		}
+		members = append(members, ZMember{Member: args[i+1], Score: score})
+	}
+	_, err := r.ZAdd(key, ZAddOptions{}, members...)
+	return err
+}
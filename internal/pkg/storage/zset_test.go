@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func memberNames(list []ZMember) []string {
+	names := make([]string, 0, len(list))
+	for _, m := range list {
+		names = append(names, m.Member)
+	}
+	return names
+}
+
+func TestSkiplist(t *testing.T) {
+	z := newZSet()
+	expected := make([]ZMember, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		m := ZMember{Member: strconv.Itoa(i), Score: float64(rand.Intn(100))}
+		assert.True(t, z.set(m.Member, m.Score))
+		expected = append(expected, m)
+	}
+	// every second member is moved, every fifth one is removed
+	for i := 0; i < 1000; i += 2 {
+		expected[i].Score = float64(rand.Intn(100))
+		z.set(expected[i].Member, expected[i].Score)
+	}
+	for i := 0; i < 1000; i += 5 {
+		assert.True(t, z.remove(expected[i].Member))
+		assert.False(t, z.remove(expected[i].Member))
+	}
+	kept := expected[:0]
+	for i, m := range expected {
+		if i%5 != 0 {
+			kept = append(kept, m)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		if kept[i].Score != kept[j].Score {
+			return kept[i].Score < kept[j].Score
+		}
+		return kept[i].Member < kept[j].Member
+	})
+
+	assert.Equal(t, len(kept), z.len())
+	for i, m := range kept {
+		assert.Equal(t, i+1, z.list.rank(m.Score, m.Member))
+		x := z.list.byRank(i + 1)
+		assert.Equal(t, m.Member, x.member)
+	}
+	assert.Nil(t, z.list.byRank(len(kept)+1))
+	assert.Equal(t, kept[len(kept)-1].Member, z.list.tail.member)
+
+	first := z.list.firstInRange(ScoreRange{Min: 50, Max: 60, MinExclusive: true})
+	last := z.list.lastInRange(ScoreRange{Min: 50, Max: 60, MaxExclusive: true})
+	assert.Greater(t, first.score, 50.0)
+	assert.Less(t, last.score, 60.0)
+	assert.LessOrEqual(t, first.backward.score, 50.0)
+	assert.GreaterOrEqual(t, last.levels[0].forward.score, 60.0)
+	assert.Nil(t, z.list.firstInRange(ScoreRange{Min: 1, Max: 1, MinExclusive: true}))
+	assert.Nil(t, z.list.lastInRange(ScoreRange{Min: 200, Max: 300}))
+}
+
+func TestZAddZScore(t *testing.T) {
+	r := newTestStorage(t)
+
+	added, err := r.ZAdd("board", ZAddOptions{}, ZMember{"alice", 10}, ZMember{"bob", 20}, ZMember{"alice", 15})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, added)
+	score, err := r.ZScore("board", "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 15.0, score)
+	n, err := r.ZCard("board")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// NX adds only new members, XX changes only existing ones
+	added, err = r.ZAdd("board", ZAddOptions{NX: true}, ZMember{"alice", 1}, ZMember{"carol", 5})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, added)
+	changed, err := r.ZAdd("board", ZAddOptions{XX: true, CH: true}, ZMember{"alice", 1}, ZMember{"dave", 5})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, changed)
+	_, err = r.ZScore("board", "dave")
+	assert.ErrorIs(t, err, ErrMemberDoesntExist)
+
+	// GT and LT only move the scores in their direction
+	changed, err = r.ZAdd("board", ZAddOptions{GT: true, CH: true}, ZMember{"alice", 0}, ZMember{"bob", 30})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, changed)
+	changed, err = r.ZAdd("board", ZAddOptions{LT: true, CH: true}, ZMember{"alice", 0}, ZMember{"bob", 40})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, changed)
+	score, _ = r.ZScore("board", "alice")
+	assert.Equal(t, 0.0, score)
+	score, _ = r.ZScore("board", "bob")
+	assert.Equal(t, 30.0, score)
+
+	score, err = r.ZIncrBy("board", 2.5, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 2.5, score)
+	score, err = r.ZIncrBy("board", 1, "new")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, score)
+	_, err = r.ZIncrBy("board", math.MaxFloat64, "bob")
+	assert.NoError(t, err)
+	_, err = r.ZIncrBy("board", math.MaxFloat64, "bob")
+	assert.ErrorIs(t, err, ErrFloatOverflow)
+
+	_, err = r.ZAdd("board", ZAddOptions{NX: true, XX: true}, ZMember{"alice", 1})
+	assert.ErrorIs(t, err, ErrIncorrectArgs)
+	_, err = r.ZAdd("board", ZAddOptions{}, ZMember{"alice", math.Inf(1)})
+	assert.ErrorIs(t, err, ErrNotFloat)
+	_, err = r.ZAdd("board", ZAddOptions{})
+	assert.ErrorIs(t, err, ErrIncorrectArgs)
+
+	// XX doesnt create the key
+	added, err = r.ZAdd("missing", ZAddOptions{XX: true}, ZMember{"alice", 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, added)
+	assert.Equal(t, TypeNone, r.Type("missing"))
+
+	removed, err := r.ZRem("board", "alice", "nobody", "bob", "carol")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, removed)
+	assert.Equal(t, TypeZSet, r.Type("board"))
+	// the key is deleted with the last member
+	removed, err = r.ZRem("board", "new")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	_, err = r.ZRem("board", "alice")
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+	assert.Equal(t, int64(0), r.MemoryStats().Used)
+}
+
+func TestZRange(t *testing.T) {
+	r := newTestStorage(t)
+
+	_, err := r.ZAdd("board", ZAddOptions{},
+		ZMember{"a", 1}, ZMember{"b", 2}, ZMember{"c", 2}, ZMember{"d", 3}, ZMember{"e", 5})
+	assert.NoError(t, err)
+
+	rank, err := r.ZRank("board", "c", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rank)
+	rank, err = r.ZRank("board", "c", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rank)
+	rank, err = r.ZRank("board", "e", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rank)
+	_, err = r.ZRank("board", "z", false)
+	assert.ErrorIs(t, err, ErrMemberDoesntExist)
+
+	list, err := r.ZRange("board", 0, -1, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, memberNames(list))
+	assert.Equal(t, ZMember{"a", 1}, list[0])
+	list, err = r.ZRange("board", 1, 2, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"d", "c"}, memberNames(list))
+	list, err = r.ZRange("board", -2, 100, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"d", "e"}, memberNames(list))
+	list, err = r.ZRange("board", 3, 1, false)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+
+	list, err = r.ZRangeByScore("board", ScoreRange{Min: 2, Max: 3}, false, 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c", "d"}, memberNames(list))
+	list, err = r.ZRangeByScore("board", ScoreRange{Min: 2, Max: 3, MinExclusive: true}, false, 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"d"}, memberNames(list))
+	list, err = r.ZRangeByScore("board", ScoreRange{Min: math.Inf(-1), Max: math.Inf(1)}, true, 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"d", "c"}, memberNames(list))
+	list, err = r.ZRangeByScore("board", ScoreRange{Min: 2, Max: 5, MaxExclusive: true}, true, 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"d", "c", "b"}, memberNames(list))
+	list, err = r.ZRangeByScore("board", ScoreRange{Min: 10, Max: 20}, false, 0, -1)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+
+	_, err = r.ZRange("missing", 0, -1, false)
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+}
+
+func TestZSetTypeConflicts(t *testing.T) {
+	r := newTestStorage(t)
+
+	assert.NoError(t, r.Set("string", "value"))
+	_, err := r.ZAdd("string", ZAddOptions{}, ZMember{"a", 1})
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	_, err = r.ZIncrBy("string", 1, "a")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	_, err = r.ZScore("string", "a")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	_, err = r.ZRange("string", 0, -1, false)
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+
+	_, err = r.ZAdd("zset", ZAddOptions{}, ZMember{"a", 1})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, r.Set("zset", "value"), ErrKeyAlreadyExists)
+	_, err = r.Hset("zset", "f", "v")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+	_, err = r.Rpush("zset", "1")
+	assert.ErrorIs(t, err, ErrKeyAlreadyExists)
+}
+
+func TestZSetExpiration(t *testing.T) {
+	r := newTestStorage(t)
+
+	_, err := r.ZAdd("zset", ZAddOptions{}, ZMember{"a", 1})
+	assert.NoError(t, err)
+	assert.True(t, pexpire(t, r, "zset", 1))
+	time.Sleep(5 * time.Millisecond)
+
+	_, err = r.ZCard("zset")
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+	// the expired set is replaced by a new one without expiration
+	_, err = r.ZAdd("zset", ZAddOptions{}, ZMember{"b", 2})
+	assert.NoError(t, err)
+	list, err := r.ZRange("zset", 0, -1, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, memberNames(list))
+	assert.Equal(t, int64(-1), r.TTL("zset"))
+
+	assert.True(t, expire(t, r, "zset", 100))
+	assert.True(t, pexpire(t, r, "zset", 1))
+	time.Sleep(5 * time.Millisecond)
+	r.GarbageCollect()
+	assert.Equal(t, int64(0), r.MemoryStats().Used)
+}
+
+func TestZSetMarshal(t *testing.T) {
+	r := newTestStorage(t)
+
+	_, err := r.ZAdd("zset", ZAddOptions{}, ZMember{"a", 1.5}, ZMember{"b", -2})
+	assert.NoError(t, err)
+	assert.True(t, expire(t, r, "zset", 100))
+	_, err = r.Copy("zset", "copied", false)
+	assert.NoError(t, err)
+	_, err = r.ZRem("copied", "a")
+	assert.NoError(t, err)
+
+	data, err := json.Marshal(r)
+	assert.NoError(t, err)
+
+	r2 := newTestStorage(t)
+	assert.NoError(t, json.Unmarshal(data, r2))
+	assertSameData(t, r, r2)
+	list, err := r2.ZRange("zset", 0, -1, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []ZMember{{"b", -2}, {"a", 1.5}}, list)
+	assert.Equal(t, int64(100), r2.TTL("zset"))
+	assert.Equal(t, r.MemoryStats().Used, r2.MemoryStats().Used)
+}